@@ -2,22 +2,42 @@ package main
 
 import (
 	pb "OrderManagement/ecommerce"
+	"admin"
 	"context"
+	"cost"
+	"cost/costpb"
+	"envelope"
+	"flag"
 	wrappers "github.com/golang/protobuf/ptypes/wrappers"
-	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/encoding/gzip"
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
+	"grpc_prod/tracer"
 	"io"
 	"log"
+	"rpcerrors"
 	"time"
 )
 
 const (
 	address = "localhost:8000"
+	// keysFile is the keyring sealing the sensitive fields of the orders, shared with
+	// the server. Create or rotate it with envelope/cmd/keygen.
+	keysFile = "../keys.json"
+)
+
+var (
+	exporter     = flag.String("exporter", tracer.ExporterNone, "where the spans go: otlp, stdout or none")
+	otlpEndpoint = flag.String("otlp-endpoint", tracer.DefaultOTLPEndpoint, "host:port of the OpenTelemetry collector")
+	adminAddr    = flag.String("admin", "", "address of the channelz page with the channel of the client, e.g. :8083, served until interrupted; off if empty")
+	caller       = flag.String("caller", "order-client", "name of the client in the cost accounting of the server")
+	costReport   = flag.Bool("cost-report", false, "print the cost report of the server after the calls")
+	lang         = flag.String("lang", "en", "languages of the error messages, as an Accept-Language header, e.g. \"fr-CH, fr;q=0.9\"")
 )
 
 func orderUnaryClientInterceptor(ctx context.Context,
@@ -68,21 +88,52 @@ func clientStreamInterceptor(ctx context.Context, desc *grpc.StreamDesc,
 }
 
 func main() {
+	flag.Parse()
+	tp, err := tracer.Init(context.Background(), tracer.Config{
+		ServiceName:  "ecommerce.OrderManagement.client",
+		Exporter:     *exporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: true,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	// export the spans still buffered
+	defer tp.Shutdown(context.Background())
+
 	// Set up a connection with the server from the
 	// provided address ("localhost: 8000")
 
+	// The codec encrypts the price and the destination of the orders, and decrypts
+	// them in the orders received. The interceptors only see the plain orders.
+	codec, err := envelope.NewCodec(keysFile, envelope.DefaultReloadInterval)
+	if err != nil {
+		log.Fatalf("failed to load the keyring: %v", err)
+	}
+	defer codec.Close()
+
 	// Setting up a connection to the server.
 	conn, err := grpc.Dial(
 		address,
 		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.ForceCodec(codec)),
+		// a span for every call, with an event for every message of the streams
+		grpc.WithStatsHandler(tracer.NewClientHandler()),
 		grpc.WithUnaryInterceptor(orderUnaryClientInterceptor),
-		grpc.WithStreamInterceptor(clientStreamInterceptor))
+		grpc.WithStreamInterceptor(clientStreamInterceptor),
+		// the caller metadata, the server accounts for the cost of the calls by caller
+		grpc.WithChainUnaryInterceptor(cost.UnaryClientInterceptor(*caller)),
+		grpc.WithChainStreamInterceptor(cost.StreamClientInterceptor(*caller)))
 	// conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
 
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
+	if *adminAddr != "" {
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+		defer admin.Linger(*adminAddr)
+	}
 	// Pass the connection and create a stub. This stub
 	// instance contains all the remote methods to invoke the server.
 	ordMgmtClient := pb.NewOrderManagementClient(conn)
@@ -107,6 +158,8 @@ func main() {
 	md := metadata.Pairs(
 		"timestamp", time.Now().Format(time.StampNano),
 		"hello", "world", // key - value
+		// the languages of the messages of the errors
+		rpcerrors.AcceptLanguageKey, *lang,
 	)
 	// make a new context with the metadata
 	newMdCtx := metadata.NewOutgoingContext(context.Background(), md)
@@ -122,23 +175,19 @@ func main() {
 	res, addOrderError := ordMgmtClient.AddOrder(newMdCtx, &order1, grpc.UseCompressor(gzip.Name))
 
 	if addOrderError != nil {
-		// extract the error code out of status received
-		errorCode := status.Code(addOrderError)
-		// match the error code for InvlidArgumet
-		if errorCode == codes.InvalidArgument {
-			log.Printf("Invalid Argument Error : %s", errorCode)
-			// convert the error response to get more details or print as is.
-			errorStatus := status.Convert(addOrderError)
-			for _, d := range errorStatus.Details() {
-				switch info := d.(type) {
-				case *epb.BadRequest_FieldViolation:
-					log.Printf("Request Field Invalid: %s", info)
-				default:
-					log.Printf("Unexpected error type: %s", info)
-				}
+		// decode the code out of the status received, and its details
+		d := rpcerrors.Decode(addOrderError)
+		// match the error code for InvalidArgument
+		if d.Code == codes.InvalidArgument {
+			log.Printf("Invalid Argument Error : %s", d.Code)
+			// the BadRequest details tell which fields of the request are invalid
+			for _, v := range d.BadRequest.GetFieldViolations() {
+				log.Printf("Request Field Invalid: %s", v)
 			}
+			// the message to show to the user, in their language
+			log.Printf("Localized Message (%s): %s", d.Localized.GetLocale(), d.Localized.GetMessage())
 		} else {
-			log.Printf("Unhandled error : %s ", errorCode)
+			log.Printf("Unhandled error : %s ", d)
 		}
 	} else {
 		log.Print("AddOrder Response -> ", res.Value)
@@ -216,19 +265,16 @@ func main() {
 
 	log.Print("\n-----------------------------------------------------------------------------\n")
 	// ======== bidirectional streaming client ========
-	streamProcOrder, err := ordMgmtClient.ProcessOrders(ctx)
+	// the span of the session, the parent of the span of the stream
+	procCtx, procSpan := otel.Tracer("OrderManagement/client").Start(ctx, "ecommerce.client.ProcessOrders")
+	defer procSpan.End()
+	streamProcOrder, err := ordMgmtClient.ProcessOrders(procCtx)
 	if err != nil {
 		log.Fatalf("%v.ProcessOrders(_) = _, %v", ordMgmtClient, err)
 	}
 
-	if err := streamProcOrder.Send(&wrappers.StringValue{Value: "102"}); err != nil {
-		log.Fatalf("%v.Send(%v) = %v", ordMgmtClient, "102", err)
-	}
-	if err := streamProcOrder.Send(&wrappers.StringValue{Value: "103"}); err != nil {
-		log.Fatalf("%v.Send(%v) = %v", ordMgmtClient, "103", err)
-	}
-	if err := streamProcOrder.Send(&wrappers.StringValue{Value: "104"}); err != nil {
-		log.Fatalf("%v.Send(%v) = %v", ordMgmtClient, "104", err)
+	for _, id := range []string{"102", "103", "104"} {
+		sendOrderID(streamProcOrder, id)
 	}
 
 	// make a channel to let the goroutine wait before fetching new record from
@@ -239,14 +285,44 @@ func main() {
 	// Mimic a delay when sending some messages to the service.
 	time.Sleep(time.Millisecond * 500)
 
-	if err := streamProcOrder.Send(&wrappers.StringValue{Value: "101"}); err != nil {
-		log.Fatalf("%v.Send(%v) = %v", ordMgmtClient, "101", err)
-	}
+	sendOrderID(streamProcOrder, "101")
 	// Mark the end of stream for the client stream (order IDs).
 	if err := streamProcOrder.CloseSend(); err != nil {
 		log.Fatal(err)
 	}
 	channel <- struct{}{}
+
+	if *costReport {
+		printCostReport(conn)
+	}
+}
+
+// printCostReport prints the cost of the calls of every caller of the server, the
+// costliest first.
+func printCostReport(conn *grpc.ClientConn) {
+	report, err := costpb.NewCostReportClient(conn).GetReport(context.Background(), &costpb.ReportRequest{})
+	if err != nil {
+		log.Printf("Could not get the cost report: %v", err)
+		return
+	}
+	log.Printf("Cost report since %s", report.Since.AsTime().Format(time.RFC3339))
+	for _, u := range report.Usages {
+		log.Printf("%s by %s: %d calls, received %d messages %d bytes on the wire (%d uncompressed, ratio %.2f), sent %d messages %d bytes on the wire (%d uncompressed, ratio %.2f), CPU %s",
+			u.Method, u.Caller, u.Calls,
+			u.Received.Messages, u.Received.WireBytes, u.Received.UncompressedBytes, u.Received.CompressionRatio,
+			u.Sent.Messages, u.Sent.WireBytes, u.Sent.UncompressedBytes, u.Sent.CompressionRatio,
+			u.CpuTime.AsDuration())
+	}
+}
+
+// sendOrderID sends an order ID to process, and records the message id of the order on
+// the span of the stream: the shipment spans of the server link to the message ids.
+func sendOrderID(stream pb.OrderManagement_ProcessOrdersClient, id string) {
+	if err := stream.Send(&wrappers.StringValue{Value: id}); err != nil {
+		log.Fatalf("%v.Send(%v) = %v", stream, id, err)
+	}
+	trace.SpanFromContext(stream.Context()).AddEvent("order sent", trace.WithAttributes(
+		attribute.String("order.id", id), attribute.Int64("message.id", tracer.Sent(stream.Context()))))
 }
 
 func asyncClientBidirectionalRPC(streamProcOrder pb.OrderManagement_ProcessOrdersClient, c chan struct{}) {
@@ -0,0 +1,49 @@
+// Command keygen creates the keyring of the envelope codec, or rotates it: the new key
+// becomes the primary key and the previous ones stay to open the messages they sealed.
+// The running servers and clients reload the keyring without restarting.
+//
+//	envelope$ go run ./cmd/keygen
+//	envelope$ go run ./cmd/keygen -retire k-0c1d7b38
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"envelope"
+)
+
+var (
+	file   = flag.String("keys", "../keys.json", "keyring file")
+	retire = flag.String("retire", "", "remove this key instead of rotating, once nothing sealed by it is left")
+)
+
+func main() {
+	flag.Parse()
+	kr, err := envelope.LoadKeyring(*file)
+	switch {
+	case os.IsNotExist(err):
+		if kr, err = envelope.NewKeyring(); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("created a keyring with the key %s", kr.Primary)
+	case err != nil:
+		log.Fatalf("failed to load the keyring: %v", err)
+	case *retire != "":
+		if err := kr.Retire(*retire); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("retired the key %s", *retire)
+	default:
+		id, err := kr.Rotate()
+		if err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("rotated, the primary key is now %s", id)
+	}
+	if err := kr.WriteFile(*file); err != nil {
+		log.Fatalf("failed to write the keyring: %v", err)
+	}
+	log.Printf("%s : primary key %s, keys %v", *file, kr.Primary, kr.IDs())
+}
@@ -0,0 +1,129 @@
+package envelope
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+)
+
+// DefaultReloadInterval is how often a Codec checks its keyring file.
+const DefaultReloadInterval = 10 * time.Second
+
+// Codec is a gRPC codec (google.golang.org/grpc/encoding.Codec) sealing the messages
+// it marshals and opening the messages it unmarshals, with a keyring reloaded from a
+// file. The server and the client force it, the content type stays application/grpc:
+//
+//	grpc.NewServer(grpc.ForceServerCodec(codec))
+//	grpc.Dial(address, grpc.WithDefaultCallOptions(grpc.ForceCodec(codec)))
+//
+// A keyring rotated in the file is used within the reload interval: add the new key to
+// the keyring of every peer before it becomes the primary key of one of them, or the
+// others can't open its messages.
+type Codec struct {
+	file    string
+	keyring atomic.Pointer[Keyring]
+	data    []byte // content of the file, only read by the reloading goroutine
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewCodec loads the keyring file and reloads it every interval, DefaultReloadInterval
+// if 0. Call Close to stop reloading.
+func NewCodec(file string, interval time.Duration) (*Codec, error) {
+	if interval == 0 {
+		interval = DefaultReloadInterval
+	}
+	c := &Codec{file: file, done: make(chan struct{})}
+	if _, err := c.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load the keyring %s: %v", file, err)
+	}
+	c.wg.Add(1)
+	go c.run(interval)
+	return c, nil
+}
+
+func (c *Codec) run(interval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				log.Printf("[envelope] keeping the current keyring, failed to reload %s: %v", c.file, err)
+			} else if reloaded {
+				kr := c.Keyring()
+				log.Printf("[envelope] reloaded %s : primary key %s, keys %v", c.file, kr.Primary, kr.IDs())
+			}
+		}
+	}
+}
+
+func (c *Codec) reload() (bool, error) {
+	data, err := os.ReadFile(c.file)
+	if err != nil {
+		return false, err
+	}
+	if c.data != nil && bytes.Equal(data, c.data) {
+		return false, nil
+	}
+	kr, err := parseKeyring(data)
+	if err != nil {
+		return false, err
+	}
+	c.keyring.Store(kr)
+	c.data = data
+	return true, nil
+}
+
+// Keyring returns the current keyring.
+func (c *Codec) Keyring() *Keyring {
+	return c.keyring.Load()
+}
+
+// Close stops reloading the keyring.
+func (c *Codec) Close() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+// Marshal seals the sensitive fields of v with the primary key and marshals it, v is
+// left unchanged.
+func (c *Codec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	sealed, err := Seal(c.Keyring(), m)
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(sealed)
+}
+
+// Unmarshal unmarshals data into v and opens its sealed fields.
+func (c *Codec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+	return Open(c.Keyring(), m)
+}
+
+// Name returns the name of the proto codec, the messages are protobuf messages.
+func (c *Codec) Name() string {
+	return "proto"
+}
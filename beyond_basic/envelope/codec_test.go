@@ -0,0 +1,97 @@
+package envelope
+
+import (
+	"testing"
+	"time"
+
+	"envelope/internal/testpb"
+	"google.golang.org/protobuf/proto"
+)
+
+// Two peers sharing a keyring file read each other's messages, before and after a rotation.
+func TestCodec(t *testing.T) {
+	file := t.TempDir() + "/keys.json"
+	kr := newTestKeyring(t)
+	if err := kr.WriteFile(file); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	server, err := NewCodec(file, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewCodec failed: %v", err)
+	}
+	defer server.Close()
+	client, err := NewCodec(file, 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewCodec failed: %v", err)
+	}
+	defer client.Close()
+
+	roundTrip := func() string {
+		sent := &testpb.Payment{Id: "1", Card: "4111", Amount: 10}
+		data, err := client.Marshal(sent)
+		if err != nil {
+			t.Fatalf("Marshal failed: %v", err)
+		}
+		if sent.Sealed != nil {
+			t.Errorf("Marshal changed the message")
+		}
+		var sealed testpb.Payment
+		proto.Unmarshal(data, &sealed)
+		var received testpb.Payment
+		if err := server.Unmarshal(data, &received); err != nil {
+			t.Fatalf("Unmarshal failed: %v", err)
+		}
+		if !proto.Equal(&received, sent) {
+			t.Errorf("received %v, want %v", &received, sent)
+		}
+		return sealed.Sealed.GetKeyId()
+	}
+
+	if keyID := roundTrip(); keyID != kr.Primary {
+		t.Errorf("sealed with %q, want %q", keyID, kr.Primary)
+	}
+
+	old := kr.Primary
+	kr.Rotate()
+	if err := kr.WriteFile(file); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for client.Keyring().Primary == old || server.Keyring().Primary == old {
+		if time.Now().After(deadline) {
+			t.Fatalf("the rotated keyring was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if keyID := roundTrip(); keyID != kr.Primary {
+		t.Errorf("sealed with %q after the rotation, want %q", keyID, kr.Primary)
+	}
+
+	if _, err := client.Marshal("not a message"); err == nil {
+		t.Errorf("Marshal of a string succeeded, want error")
+	}
+}
+
+// A keyring which fails to load is not used: the codec keeps the current one.
+func TestCodec_KeepsCurrentOnError(t *testing.T) {
+	file := t.TempDir() + "/keys.json"
+	kr := newTestKeyring(t)
+	if err := kr.WriteFile(file); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	c, err := NewCodec(file, time.Hour)
+	if err != nil {
+		t.Fatalf("NewCodec failed: %v", err)
+	}
+	defer c.Close()
+	broken := &Keyring{Primary: "missing", Keys: kr.Keys}
+	if err := broken.WriteFile(file); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := c.reload(); err == nil {
+		t.Errorf("reload of a keyring without its primary key succeeded, want error")
+	}
+	if c.Keyring().Primary != kr.Primary {
+		t.Errorf("keyring changed after a failed reload")
+	}
+}
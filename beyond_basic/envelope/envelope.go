@@ -0,0 +1,251 @@
+// Package envelope encrypts the sensitive fields of protobuf messages, so that they stay
+// encrypted through the intermediaries which terminate TLS (an ingress, a proxy logging
+// the payloads) and in the stored messages.
+//
+// The fields are marked in the proto file, and the message gets an Envelope field to
+// hold them encrypted:
+//
+//	import "envelope/envelope.proto";
+//
+//	message Order {
+//	  string id = 1;
+//	  float price = 4 [(envelope.sensitive) = true];
+//	  string destination = 5 [(envelope.sensitive) = true];
+//	  envelope.Envelope sealed = 6;
+//	}
+//
+// Seal moves the sensitive fields of a message, and of the messages it holds, into their
+// Envelope, encrypted with AES-GCM by a new data key which is itself encrypted by the
+// primary key of a Keyring. Open puts them back. Codec does both for gRPC, so the
+// handlers and the clients only see the plain messages.
+package envelope
+
+import (
+	"fmt"
+	"sync"
+
+	"envelope/envelopepb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+)
+
+// Seal returns a copy of m whose sensitive fields are encrypted by the primary key of
+// kr, or m itself if it has none. m is left unchanged.
+func Seal(kr *Keyring, m proto.Message) (proto.Message, error) {
+	p, err := planFor(m.ProtoReflect().Descriptor())
+	if err != nil {
+		return nil, err
+	}
+	if p.empty() {
+		return m, nil
+	}
+	sealed := proto.Clone(m)
+	if err := p.seal(kr, sealed.ProtoReflect()); err != nil {
+		return nil, err
+	}
+	return sealed, nil
+}
+
+// Open decrypts the sealed fields of m in place. The sensitive fields of a message
+// without an Envelope are left as they are.
+func Open(kr *Keyring, m proto.Message) error {
+	p, err := planFor(m.ProtoReflect().Descriptor())
+	if err != nil {
+		return err
+	}
+	if p.empty() {
+		return nil
+	}
+	return p.open(kr, m.ProtoReflect())
+}
+
+// plan lists the fields of a message type to encrypt, and the fields holding messages
+// which have some.
+type plan struct {
+	name      protoreflect.FullName
+	sensitive []protoreflect.FieldDescriptor
+	envelope  protoreflect.FieldDescriptor
+	nested    []nestedField
+	// reaches is whether the message or the messages it holds have sensitive fields.
+	reaches bool
+}
+
+type nestedField struct {
+	fd   protoreflect.FieldDescriptor
+	plan *plan
+}
+
+var envelopeName = (&envelopepb.Envelope{}).ProtoReflect().Descriptor().FullName()
+
+// plans caches the plan of each message type, by full name.
+var plans sync.Map
+
+func planFor(md protoreflect.MessageDescriptor) (*plan, error) {
+	if p, ok := plans.Load(md.FullName()); ok {
+		return p.(*plan), nil
+	}
+	built := make(map[protoreflect.FullName]*plan)
+	p, err := newPlan(md, built)
+	if err != nil {
+		return nil, err
+	}
+	// A message reaches sensitive fields through the messages it holds, which may hold
+	// it back: propagate until nothing changes, then drop the nested fields which don't.
+	for changed := true; changed; {
+		changed = false
+		for _, bp := range built {
+			for _, n := range bp.nested {
+				if n.plan.reaches && !bp.reaches {
+					bp.reaches, changed = true, true
+				}
+			}
+		}
+	}
+	for _, bp := range built {
+		kept := bp.nested[:0]
+		for _, n := range bp.nested {
+			if n.plan.reaches {
+				kept = append(kept, n)
+			}
+		}
+		bp.nested = kept
+	}
+	plans.Store(md.FullName(), p)
+	return p, nil
+}
+
+// newPlan builds the plan of md and of the messages it holds into built.
+func newPlan(md protoreflect.MessageDescriptor, built map[protoreflect.FullName]*plan) (*plan, error) {
+	p := &plan{name: md.FullName()}
+	built[md.FullName()] = p
+	fields := md.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		fd := fields.Get(i)
+		if proto.GetExtension(fd.Options(), envelopepb.E_Sensitive).(bool) {
+			p.sensitive = append(p.sensitive, fd)
+			continue
+		}
+		held := fd.Message()
+		if fd.IsMap() {
+			held = fd.MapValue().Message()
+		}
+		if held == nil {
+			continue
+		}
+		if held.FullName() == envelopeName && fd.Cardinality() != protoreflect.Repeated {
+			p.envelope = fd
+			continue
+		}
+		nested, ok := built[held.FullName()]
+		if !ok {
+			var err error
+			if nested, err = newPlan(held, built); err != nil {
+				return nil, err
+			}
+		}
+		p.nested = append(p.nested, nestedField{fd: fd, plan: nested})
+	}
+	if len(p.sensitive) > 0 && p.envelope == nil {
+		return nil, fmt.Errorf("%s has sensitive fields but no envelope.Envelope field to seal them", md.FullName())
+	}
+	p.reaches = len(p.sensitive) > 0
+	return p, nil
+}
+
+func (p *plan) empty() bool {
+	return !p.reaches
+}
+
+func (p *plan) seal(kr *Keyring, m protoreflect.Message) error {
+	if err := p.each(m, func(n nestedField, nm protoreflect.Message) error { return n.plan.seal(kr, nm) }); err != nil {
+		return err
+	}
+	plain := m.Type().New()
+	for _, fd := range p.sensitive {
+		if m.Has(fd) {
+			plain.Set(fd, m.Get(fd))
+		}
+	}
+	if !hasFields(plain) {
+		return nil
+	}
+	plaintext, err := proto.Marshal(plain.Interface())
+	if err != nil {
+		return err
+	}
+	env, err := kr.seal(plaintext, []byte(p.name))
+	if err != nil {
+		return err
+	}
+	for _, fd := range p.sensitive {
+		m.Clear(fd)
+	}
+	m.Set(p.envelope, protoreflect.ValueOfMessage(env.ProtoReflect()))
+	return nil
+}
+
+func (p *plan) open(kr *Keyring, m protoreflect.Message) error {
+	if err := p.each(m, func(n nestedField, nm protoreflect.Message) error { return n.plan.open(kr, nm) }); err != nil {
+		return err
+	}
+	if p.envelope == nil || !m.Has(p.envelope) {
+		return nil
+	}
+	env, ok := m.Get(p.envelope).Message().Interface().(*envelopepb.Envelope)
+	if !ok {
+		return fmt.Errorf("%s: unexpected envelope type %T", p.name, m.Get(p.envelope).Message().Interface())
+	}
+	plaintext, err := kr.open(env, []byte(p.name))
+	if err != nil {
+		return fmt.Errorf("%s: %v", p.name, err)
+	}
+	plain := m.Type().New()
+	if err := proto.Unmarshal(plaintext, plain.Interface()); err != nil {
+		return fmt.Errorf("%s: invalid sealed fields: %v", p.name, err)
+	}
+	for _, fd := range p.sensitive {
+		if plain.Has(fd) {
+			m.Set(fd, plain.Get(fd))
+		}
+	}
+	m.Clear(p.envelope)
+	return nil
+}
+
+// each calls f with the messages held by the nested fields of m.
+func (p *plan) each(m protoreflect.Message, f func(nestedField, protoreflect.Message) error) error {
+	for _, n := range p.nested {
+		if !m.Has(n.fd) {
+			continue
+		}
+		v := m.Mutable(n.fd)
+		var err error
+		switch {
+		case n.fd.IsList():
+			list := v.List()
+			for i := 0; i < list.Len() && err == nil; i++ {
+				err = f(n, list.Get(i).Message())
+			}
+		case n.fd.IsMap():
+			v.Map().Range(func(_ protoreflect.MapKey, mv protoreflect.Value) bool {
+				err = f(n, mv.Message())
+				return err == nil
+			})
+		default:
+			err = f(n, v.Message())
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasFields(m protoreflect.Message) bool {
+	has := false
+	m.Range(func(protoreflect.FieldDescriptor, protoreflect.Value) bool {
+		has = true
+		return false
+	})
+	return has
+}
@@ -0,0 +1,165 @@
+package envelope
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"envelope/internal/testpb"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+func newTestKeyring(t *testing.T) *Keyring {
+	kr, err := NewKeyring()
+	if err != nil {
+		t.Fatalf("NewKeyring failed: %v", err)
+	}
+	return kr
+}
+
+func seal(t *testing.T, kr *Keyring, m proto.Message) proto.Message {
+	t.Helper()
+	sealed, err := Seal(kr, m)
+	if err != nil {
+		t.Fatalf("Seal failed: %v", err)
+	}
+	return sealed
+}
+
+func TestSealOpen(t *testing.T) {
+	kr := newTestKeyring(t)
+	payment := &testpb.Payment{Id: "1", Card: "4111 1111 1111 1111", Amount: 42.5, Tags: []string{"vip"}}
+	batch := &testpb.Batch{
+		Id:       "b",
+		Payments: []*testpb.Payment{payment, {Id: "2"}},
+		ByCard:   map[string]*testpb.Payment{"visa": {Id: "3", Card: "4000 0000 0000 0002"}},
+	}
+	want := proto.Clone(batch)
+
+	sealed := seal(t, kr, batch).(*testpb.Batch)
+	if !proto.Equal(batch, want) {
+		t.Errorf("Seal changed its input: %v", batch)
+	}
+	data, err := proto.Marshal(sealed)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+	if bytes.Contains(data, []byte("4111")) || bytes.Contains(data, []byte("vip")) {
+		t.Errorf("the sealed message holds the sensitive fields in clear")
+	}
+	sealedPayment := sealed.Payments[0]
+	if sealedPayment.Id != "1" || sealedPayment.Card != "" || sealedPayment.Amount != 0 || sealedPayment.Sealed.GetKeyId() != kr.Primary {
+		t.Errorf("sealed payment = %v, want the ID in clear and the rest in an envelope of %s", sealedPayment, kr.Primary)
+	}
+	if sealed.Payments[1].Sealed != nil {
+		t.Errorf("payment without sensitive fields got an envelope")
+	}
+	if sealed.ByCard["visa"].Sealed == nil {
+		t.Errorf("payment of the map not sealed")
+	}
+
+	opened := new(testpb.Batch)
+	if err := proto.Unmarshal(data, opened); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if err := Open(kr, opened); err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	if !proto.Equal(opened, want) {
+		t.Errorf("opened = %v, want %v", opened, want)
+	}
+}
+
+func TestSeal_NoSensitiveFields(t *testing.T) {
+	kr := newTestKeyring(t)
+	m := wrapperspb.String("order 101")
+	if sealed := seal(t, kr, m); sealed != m {
+		t.Errorf("Seal copied a message without sensitive fields")
+	}
+	if _, err := Seal(kr, &testpb.Broken{Secret: "s"}); err == nil || !strings.Contains(err.Error(), "no envelope.Envelope field") {
+		t.Errorf("Seal(Broken) = %v, want an error about the missing envelope", err)
+	}
+}
+
+// The messages sealed before a rotation open until their key is retired.
+func TestRotation(t *testing.T) {
+	kr := newTestKeyring(t)
+	old := kr.Primary
+	before := seal(t, kr, &testpb.Payment{Card: "before"}).(*testpb.Payment)
+	if _, err := kr.Rotate(); err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	after := seal(t, kr, &testpb.Payment{Card: "after"}).(*testpb.Payment)
+	if after.Sealed.KeyId == old || after.Sealed.KeyId != kr.Primary {
+		t.Errorf("sealed with %s after the rotation, want the new primary key %s", after.Sealed.KeyId, kr.Primary)
+	}
+	for _, m := range []*testpb.Payment{proto.Clone(before).(*testpb.Payment), after} {
+		if err := Open(kr, m); err != nil {
+			t.Errorf("Open failed: %v", err)
+		}
+	}
+
+	if err := kr.Retire(kr.Primary); err == nil {
+		t.Errorf("Retire of the primary key succeeded, want error")
+	}
+	if err := kr.Retire(old); err != nil {
+		t.Fatalf("Retire failed: %v", err)
+	}
+	if err := Open(kr, before); err == nil || !strings.Contains(err.Error(), "unknown key ID") {
+		t.Errorf("Open with a retired key = %v, want unknown key ID", err)
+	}
+}
+
+func TestOpen_Tampered(t *testing.T) {
+	kr := newTestKeyring(t)
+	for name, tamper := range map[string]func(*testpb.Payment){
+		"ciphertext": func(p *testpb.Payment) { p.Sealed.Ciphertext[0] ^= 1 },
+		"key ID":     func(p *testpb.Payment) { kr.Keys["other"] = kr.Keys[kr.Primary]; p.Sealed.KeyId = "other" },
+		"wrapped key": func(p *testpb.Payment) {
+			p.Sealed.WrappedKey[len(p.Sealed.WrappedKey)-1] ^= 1
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			sealed := seal(t, kr, &testpb.Payment{Card: "4111"}).(*testpb.Payment)
+			tamper(sealed)
+			if err := Open(kr, sealed); err == nil {
+				t.Errorf("Open of a tampered envelope succeeded")
+			}
+		})
+	}
+
+	// an envelope only opens in the message type it was sealed for
+	sealed := seal(t, kr, &testpb.Payment{Card: "4111"}).(*testpb.Payment)
+	kr2 := &Keyring{Primary: sealed.Sealed.KeyId, Keys: kr.Keys}
+	plaintext, err := kr2.open(sealed.Sealed, []byte("envelope.test.Other"))
+	if err == nil {
+		t.Errorf("envelope opened for another message type: %q", plaintext)
+	}
+}
+
+func TestLoadKeyring(t *testing.T) {
+	file := t.TempDir() + "/keys.json"
+	kr := newTestKeyring(t)
+	kr.Rotate()
+	if err := kr.WriteFile(file); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	loaded, err := LoadKeyring(file)
+	if err != nil {
+		t.Fatalf("LoadKeyring failed: %v", err)
+	}
+	if loaded.Primary != kr.Primary || len(loaded.Keys) != 2 || !bytes.Equal(loaded.Keys[kr.Primary], kr.Keys[kr.Primary]) {
+		t.Errorf("loaded keyring differs: primary %s, keys %v", loaded.Primary, loaded.IDs())
+	}
+
+	for _, data := range []string{
+		`{"primary": "missing", "keys": {}}`,
+		`{"primary": "short", "keys": {"short": "AAAA"}}`,
+		`not json`,
+	} {
+		if _, err := parseKeyring([]byte(data)); err == nil {
+			t.Errorf("parseKeyring(%s) succeeded, want error", data)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+module envelope
+
+go 1.20
+
+require google.golang.org/protobuf v1.30.0
@@ -0,0 +1,208 @@
+package envelope
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"envelope/envelopepb"
+)
+
+// keySize is the size of the keys of the keyring and of the data keys: AES-256.
+const keySize = 32
+
+// Keyring holds the key encryption keys, by ID. The primary key encrypts the data keys
+// of the new envelopes, the others only decrypt the envelopes sealed before a rotation.
+//
+// It is stored as JSON, the keys base64 encoded:
+//
+//	{"primary": "k-5f0e2a91", "keys": {"k-5f0e2a91": "...", "k-0c1d7b38": "..."}}
+type Keyring struct {
+	Primary string            `json:"primary"`
+	Keys    map[string][]byte `json:"keys"`
+}
+
+// NewKeyring returns a keyring with a new primary key.
+func NewKeyring() (*Keyring, error) {
+	kr := &Keyring{Keys: make(map[string][]byte)}
+	if _, err := kr.Rotate(); err != nil {
+		return nil, err
+	}
+	return kr, nil
+}
+
+// LoadKeyring reads a keyring written by WriteFile.
+func LoadKeyring(file string) (*Keyring, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return parseKeyring(data)
+}
+
+func parseKeyring(data []byte) (*Keyring, error) {
+	var kr Keyring
+	if err := json.Unmarshal(data, &kr); err != nil {
+		return nil, fmt.Errorf("invalid keyring: %v", err)
+	}
+	if err := kr.validate(); err != nil {
+		return nil, err
+	}
+	return &kr, nil
+}
+
+func (kr *Keyring) validate() error {
+	if _, ok := kr.Keys[kr.Primary]; !ok {
+		return fmt.Errorf("the primary key %q is not in the keyring", kr.Primary)
+	}
+	for id, key := range kr.Keys {
+		if len(key) != keySize {
+			return fmt.Errorf("key %q is %d bytes long, want %d", id, len(key), keySize)
+		}
+	}
+	return nil
+}
+
+// Rotate adds a new key and makes it the primary one, the previous keys still decrypt
+// the envelopes they sealed.
+func (kr *Keyring) Rotate() (id string, err error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", fmt.Errorf("failed to generate a key: %v", err)
+	}
+	for id == "" || kr.Keys[id] != nil {
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", fmt.Errorf("failed to generate a key ID: %v", err)
+		}
+		id = "k-" + hex.EncodeToString(suffix)
+	}
+	kr.Keys[id] = key
+	kr.Primary = id
+	return id, nil
+}
+
+// Retire removes a key once no envelope sealed by it is left. The primary key can't be retired.
+func (kr *Keyring) Retire(id string) error {
+	if id == kr.Primary {
+		return errors.New("the primary key can't be retired, rotate first")
+	}
+	if _, ok := kr.Keys[id]; !ok {
+		return fmt.Errorf("unknown key ID %q", id)
+	}
+	delete(kr.Keys, id)
+	return nil
+}
+
+// IDs returns the key IDs, sorted.
+func (kr *Keyring) IDs() []string {
+	ids := make([]string, 0, len(kr.Keys))
+	for id := range kr.Keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+// WriteFile writes the keyring, readable by its owner only. The keyring is written to a
+// temporary file renamed to file, so that a Codec never reloads a partial keyring.
+func (kr *Keyring) WriteFile(file string) error {
+	data, err := json.MarshalIndent(kr, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(append(data, '\n')); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), file)
+}
+
+// seal encrypts plaintext with a new data key, encrypted by the primary key. aad is
+// authenticated along with the key ID: an envelope only opens for the same aad.
+func (kr *Keyring) seal(plaintext, aad []byte) (*envelopepb.Envelope, error) {
+	dataKey := make([]byte, keySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate a data key: %v", err)
+	}
+	wrappedKey, err := encrypt(kr.Keys[kr.Primary], dataKey, []byte(kr.Primary))
+	if err != nil {
+		return nil, err
+	}
+	env := &envelopepb.Envelope{KeyId: kr.Primary, WrappedKey: wrappedKey}
+	ciphertext, err := encrypt(dataKey, plaintext, append([]byte(env.KeyId+"/"), aad...))
+	if err != nil {
+		return nil, err
+	}
+	env.Nonce, env.Ciphertext = ciphertext[:nonceSize], ciphertext[nonceSize:]
+	return env, nil
+}
+
+// open decrypts an envelope sealed by any key of the keyring.
+func (kr *Keyring) open(env *envelopepb.Envelope, aad []byte) ([]byte, error) {
+	key, ok := kr.Keys[env.KeyId]
+	if !ok {
+		return nil, fmt.Errorf("unknown key ID %q", env.KeyId)
+	}
+	dataKey, err := decrypt(key, env.WrappedKey, []byte(env.KeyId))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the data key: %v", err)
+	}
+	ciphertext := append(append([]byte(nil), env.Nonce...), env.Ciphertext...)
+	plaintext, err := decrypt(dataKey, ciphertext, append([]byte(env.KeyId+"/"), aad...))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt the envelope: %v", err)
+	}
+	return plaintext, nil
+}
+
+// nonceSize is the standard AES-GCM nonce size, the nonces are random.
+const nonceSize = 12
+
+// encrypt returns the nonce followed by the AES-GCM ciphertext.
+func encrypt(key, plaintext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate a nonce: %v", err)
+	}
+	return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// decrypt opens the output of encrypt.
+func decrypt(key, ciphertext, aad []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ciphertext) < nonceSize {
+		return nil, errors.New("ciphertext too short")
+	}
+	return gcm.Open(nil, ciphertext[:nonceSize], ciphertext[nonceSize:], aad)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,336 @@
+// Package balancers registers custom load balancing policies with balancer.Register:
+//
+//   - static_weighted_round_robin: round robin where each backend gets a share of the
+//     RPCs proportional to the weight set by the name resolver (see package endpoint).
+//   - least_outstanding_requests: each RPC goes to the backend with the fewest RPCs in flight.
+//   - power_of_two_choices: each RPC goes to the least loaded of two backends picked at random.
+//   - order_ring_hash: consistent hashing, the RPCs with the same hash key (e.g. an order ID)
+//     go to the same backend (see ringhash.go).
+//   - zone_aware: the RPCs go to the backends in the zone of the client, and spill over to
+//     the other zones when it is unhealthy or overloaded (see zoneaware.go).
+//
+// Import the package for its side effect and select a policy per service in the service config:
+//
+//	grpc.WithDefaultServiceConfig(`{"loadBalancingConfig":[{"least_outstanding_requests":{}}]}`)
+//
+// Every policy only picks among the backends passing their health check, when the service
+// config has a healthCheckConfig, and supports outlier detection (see outlier.go).
+package balancers
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// Names of the policies, as used in the service config.
+const (
+	WeightedRoundRobinName = "static_weighted_round_robin"
+	LeastRequestName       = "least_outstanding_requests"
+	PowerOfTwoChoicesName  = "power_of_two_choices"
+	RingHashName           = "order_ring_hash"
+	ZoneAwareName          = "zone_aware"
+)
+
+// Names are the names of the policies of the package, the only ones taking a Config.
+var Names = []string{WeightedRoundRobinName, LeastRequestName, PowerOfTwoChoicesName, RingHashName, ZoneAwareName}
+
+func init() {
+	balancer.Register(NewBuilder(WeightedRoundRobinName, newWRRPicker))
+	balancer.Register(NewBuilder(LeastRequestName, newLeastRequestPicker))
+	balancer.Register(NewBuilder(PowerOfTwoChoicesName, newP2CPicker))
+	balancer.Register(&builder{name: RingHashName, newPicker: newRingHashPicker, parseConfig: parseRingHashConfig})
+	balancer.Register(&builder{name: ZoneAwareName, newPicker: newZonePicker, parseConfig: parseZoneAwareConfig})
+}
+
+// Config is the config of every policy of the package in the service config:
+//
+//	{"loadBalancingConfig":[{"least_outstanding_requests":{"outlierDetection":{"interval":"10s"}}}]}
+type Config struct {
+	serviceconfig.LoadBalancingConfig `json:"-"`
+
+	// OutlierDetection ejects the backends failing or answering slowly for a while,
+	// disabled if nil.
+	OutlierDetection *OutlierDetectionConfig `json:"outlierDetection,omitempty"`
+}
+
+// outlierConfigured is implemented by the configs embedding Config.
+type outlierConfigured interface {
+	outlierDetection() *OutlierDetectionConfig
+}
+
+func (c *Config) outlierDetection() *OutlierDetectionConfig { return c.OutlierDetection }
+
+func (c *Config) validate(policy string) error {
+	if c.OutlierDetection == nil {
+		return nil
+	}
+	if err := c.OutlierDetection.setDefaults(); err != nil {
+		return fmt.Errorf("%s: invalid outlierDetection: %v", policy, err)
+	}
+	return nil
+}
+
+func parseConfig(policy string) func(json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	return func(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+		cfg := &Config{}
+		if err := json.Unmarshal(js, cfg); err != nil {
+			return nil, fmt.Errorf("%s: invalid config %s: %v", policy, js, err)
+		}
+		if err := cfg.validate(policy); err != nil {
+			return nil, err
+		}
+		return cfg, nil
+	}
+}
+
+// Duration is a duration in the service config, e.g. "10s" or "0.5s".
+type Duration time.Duration
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// Backend is a ready SubConn along with the latest address the resolver sent for it.
+type Backend struct {
+	SubConn balancer.SubConn
+	Address resolver.Address
+	// number of RPCs in flight on the backend, shared by all the pickers of a balancer
+	inflight *int64
+	// outlier detection the outcome of the RPCs is reported to, nil if disabled
+	detector *outlierDetector
+}
+
+// Inflight returns the number of RPCs in flight on the backend.
+func (b *Backend) Inflight() int64 { return atomic.LoadInt64(b.inflight) }
+
+// Pick returns the PickResult sending the RPC to b, and counts it as in flight until it is done.
+func (b *Backend) Pick() balancer.PickResult {
+	atomic.AddInt64(b.inflight, 1)
+	start := time.Now()
+	return balancer.PickResult{
+		SubConn: b.SubConn,
+		Done: func(info balancer.DoneInfo) {
+			atomic.AddInt64(b.inflight, -1)
+			if b.detector != nil {
+				b.detector.record(b.Address.Addr, info.Err, time.Since(start))
+			}
+		},
+	}
+}
+
+// NewPickerFunc creates the picker of a policy from the ready backends, sorted by address.
+type NewPickerFunc func(backends []*Backend) balancer.Picker
+
+// pickerInfo is what the picker of a policy is built from.
+type pickerInfo struct {
+	// ready backends which are not ejected, sorted by address
+	backends []*Backend
+	// every address sent by the resolver, ready or not, sorted
+	addrs []resolver.Address
+	// config of the policy in the service config
+	config serviceconfig.LoadBalancingConfig
+}
+
+type builder struct {
+	name        string
+	newPicker   func(pickerInfo) balancer.Picker
+	parseConfig func(json.RawMessage) (serviceconfig.LoadBalancingConfig, error)
+}
+
+// NewBuilder returns a balancer.Builder named name, which keeps one SubConn per address
+// and builds its picker with newPicker every time the set of ready backends or their
+// addresses change. The policy takes a Config in the service config.
+func NewBuilder(name string, newPicker NewPickerFunc) balancer.Builder {
+	return &builder{
+		name:        name,
+		newPicker:   func(info pickerInfo) balancer.Picker { return newPicker(info.backends) },
+		parseConfig: parseConfig(name),
+	}
+}
+
+func (b *builder) Name() string { return b.name }
+
+func (b *builder) ParseConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	return b.parseConfig(js)
+}
+
+func (b *builder) Build(cc balancer.ClientConn, opts balancer.BuildOptions) balancer.Balancer {
+	pb := &policyBalancer{
+		name:      b.name,
+		cc:        cc,
+		newPicker: b.newPicker,
+		addrs:     make(map[string]resolver.Address),
+		inflight:  make(map[balancer.SubConn]*int64),
+	}
+	// base manages the SubConns and the connectivity state, and calls buildPicker when
+	// the ready SubConns change. One policyBalancer per ClientConn so that the in flight
+	// counters and the outlier detection are not shared between services.
+	pb.Balancer = base.NewBalancerBuilder(b.name, pickerBuilderFunc(pb.buildPicker), base.Config{HealthCheck: true}).
+		Build(&stateRecorder{ClientConn: cc, b: pb}, opts)
+	return pb
+}
+
+type pickerBuilderFunc func(base.PickerBuildInfo) balancer.Picker
+
+func (f pickerBuilderFunc) Build(info base.PickerBuildInfo) balancer.Picker { return f(info) }
+
+// policyBalancer wraps base to give the pickers more than the ready SubConns:
+//   - the latest attributes of every address. base only keeps the address a SubConn was
+//     created with, so a new weight or zone sent by the resolver for a known backend
+//     would never reach the picker.
+//   - the config of the policy.
+//   - the outlier detection, the picker is rebuilt without a backend when it is ejected.
+type policyBalancer struct {
+	balancer.Balancer
+	name      string
+	cc        balancer.ClientConn
+	newPicker func(pickerInfo) balancer.Picker
+
+	mu       sync.Mutex
+	addrs    map[string]resolver.Address
+	config   serviceconfig.LoadBalancingConfig
+	inflight map[balancer.SubConn]*int64
+	ready    map[balancer.SubConn]base.SubConnInfo
+	state    connectivity.State
+	detector *outlierDetector
+}
+
+func (b *policyBalancer) UpdateClientConnState(s balancer.ClientConnState) error {
+	addrs := make(map[string]resolver.Address, len(s.ResolverState.Addresses))
+	for _, a := range s.ResolverState.Addresses {
+		addrs[a.Addr] = a
+	}
+	b.mu.Lock()
+	b.addrs = addrs
+	b.config = s.BalancerConfig
+	b.updateDetector()
+	b.mu.Unlock()
+	return b.Balancer.UpdateClientConnState(s)
+}
+
+// updateDetector starts, restarts or stops the outlier detection to match the config,
+// b.mu must be held.
+func (b *policyBalancer) updateDetector() {
+	var cfg *OutlierDetectionConfig
+	if c, ok := b.config.(outlierConfigured); ok {
+		cfg = c.outlierDetection()
+	}
+	if b.detector != nil && (cfg == nil || *cfg != *b.detector.cfg) {
+		// stop without holding b.mu, a running evaluation may be regenerating the picker
+		d := b.detector
+		b.detector = nil
+		b.mu.Unlock()
+		d.stop()
+		b.mu.Lock()
+	}
+	if cfg != nil && b.detector == nil {
+		b.detector = newOutlierDetector(b.name, cfg, b.regeneratePicker)
+	}
+	if b.detector != nil {
+		b.detector.setAddrs(b.addrs)
+	}
+}
+
+func (b *policyBalancer) Close() {
+	b.mu.Lock()
+	d := b.detector
+	b.detector = nil
+	b.mu.Unlock()
+	if d != nil {
+		d.stop()
+	}
+	b.Balancer.Close()
+}
+
+func (b *policyBalancer) buildPicker(info base.PickerBuildInfo) balancer.Picker {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.ready = info.ReadySCs
+	return b.picker()
+}
+
+// regeneratePicker pushes a new picker after a backend was ejected or came back.
+func (b *policyBalancer) regeneratePicker() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state != connectivity.Ready {
+		return
+	}
+	b.cc.UpdateState(balancer.State{ConnectivityState: b.state, Picker: b.picker()})
+}
+
+// picker builds the picker of the policy from the ready backends, b.mu must be held.
+func (b *policyBalancer) picker() balancer.Picker {
+	var backends, ejected []*Backend
+	inflight := make(map[balancer.SubConn]*int64, len(b.ready))
+	for sc, sci := range b.ready {
+		addr, ok := b.addrs[sci.Address.Addr]
+		if !ok {
+			addr = sci.Address
+		}
+		n := b.inflight[sc]
+		if n == nil {
+			n = new(int64)
+		}
+		inflight[sc] = n
+		backend := &Backend{SubConn: sc, Address: addr, inflight: n, detector: b.detector}
+		if b.detector != nil && b.detector.isEjected(addr.Addr) {
+			ejected = append(ejected, backend)
+			continue
+		}
+		backends = append(backends, backend)
+	}
+	b.inflight = inflight
+	if len(backends) == 0 {
+		// every ready backend is ejected, an outlier is better than no backend at all
+		backends = ejected
+	}
+	if len(backends) == 0 {
+		return base.NewErrPicker(balancer.ErrNoSubConnAvailable)
+	}
+	sort.Slice(backends, func(i, j int) bool { return backends[i].Address.Addr < backends[j].Address.Addr })
+
+	addrs := make([]resolver.Address, 0, len(b.addrs))
+	for _, a := range b.addrs {
+		addrs = append(addrs, a)
+	}
+	sort.Slice(addrs, func(i, j int) bool { return addrs[i].Addr < addrs[j].Addr })
+	return b.newPicker(pickerInfo{backends: backends, addrs: addrs, config: b.config})
+}
+
+// stateRecorder records the connectivity state base sends to the ClientConn, and swaps
+// the picker for one built under b.mu, so that an ejection which happened between
+// base building its picker and sending it is not lost.
+type stateRecorder struct {
+	balancer.ClientConn
+	b *policyBalancer
+}
+
+func (r *stateRecorder) UpdateState(s balancer.State) {
+	r.b.mu.Lock()
+	defer r.b.mu.Unlock()
+	r.b.state = s.ConnectivityState
+	if s.ConnectivityState != connectivity.TransientFailure {
+		s.Picker = r.b.picker()
+	}
+	r.b.cc.UpdateState(s)
+}
@@ -0,0 +1,186 @@
+package balancers
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+	"google.golang.org/grpc/status"
+	"loadBalancing/endpoint"
+)
+
+type ecServer struct {
+	ecpb.UnimplementedEchoServer
+	addr  string
+	delay time.Duration
+	// fail makes every call fail with Unavailable
+	fail atomic.Bool
+}
+
+func (s *ecServer) UnaryEcho(ctx context.Context, req *ecpb.EchoRequest) (*ecpb.EchoResponse, error) {
+	time.Sleep(s.delay)
+	if s.fail.Load() {
+		return nil, status.Errorf(codes.Unavailable, "%s is failing", s.addr)
+	}
+	return &ecpb.EchoResponse{Message: s.addr}, nil
+}
+
+type testBackend struct {
+	addr   string
+	server *grpc.Server
+	echo   *ecServer
+	health *health.Server
+}
+
+// startBackend starts an echo backend like startServer in the server example,
+// answering with its own address after delay, along with the health service.
+func startBackend(t *testing.T, delay time.Duration) *testBackend {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	b := &testBackend{
+		addr:   lis.Addr().String(),
+		server: grpc.NewServer(),
+		echo:   &ecServer{addr: lis.Addr().String(), delay: delay},
+		health: health.NewServer(),
+	}
+	ecpb.RegisterEchoServer(b.server, b.echo)
+	healthpb.RegisterHealthServer(b.server, b.health)
+	go b.server.Serve(lis)
+	t.Cleanup(b.server.Stop)
+	return b
+}
+
+// startBackends starts one echo backend per delay.
+func startBackends(t *testing.T, delays ...time.Duration) []string {
+	var addrs []string
+	for _, delay := range delays {
+		addrs = append(addrs, startBackend(t, delay).addr)
+	}
+	return addrs
+}
+
+// dial connects to the backends with policy, through a manual resolver returned to update them.
+func dial(t *testing.T, policy string, endpoints []endpoint.Endpoint, opts ...grpc.DialOption) (ecpb.EchoClient, *manual.Resolver) {
+	return dialConfig(t, fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, policy), endpoints, opts...)
+}
+
+func dialConfig(t *testing.T, serviceConfig string, endpoints []endpoint.Endpoint, opts ...grpc.DialOption) (ecpb.EchoClient, *manual.Resolver) {
+	r := manual.NewBuilderWithScheme("test")
+	r.InitialState(resolver.State{Addresses: endpoint.Addresses(endpoints)})
+	conn, err := grpc.Dial(r.Scheme()+":///lb.example.grpc.io", append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(serviceConfig),
+	}, opts...)...)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := ecpb.NewEchoClient(conn)
+	waitForAll(t, c, len(endpoints))
+	return c, r
+}
+
+// waitForAll calls until n backends have answered, so that all of them are ready.
+func waitForAll(t *testing.T, c ecpb.EchoClient, n int) {
+	seen := make(map[string]bool)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(seen) < n {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d backends answered", len(seen), n)
+		}
+		seen[call(t, c)] = true
+	}
+}
+
+func call(t *testing.T, c ecpb.EchoClient) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		t.Errorf("UnaryEcho failed: %v", err)
+		return ""
+	}
+	return r.Message
+}
+
+// distribution makes n calls from each of workers goroutines and counts the calls per backend.
+func distribution(t *testing.T, c ecpb.EchoClient, workers, n int) map[string]int {
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	hits := make(map[string]int)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < n; i++ {
+				addr := call(t, c)
+				mu.Lock()
+				hits[addr]++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return hits
+}
+
+func TestWeightedRoundRobin(t *testing.T) {
+	addrs := startBackends(t, 0, 0, 0)
+	endpoints := []endpoint.Endpoint{{Addr: addrs[0], Weight: 1}, {Addr: addrs[1], Weight: 2}, {Addr: addrs[2], Weight: 3}}
+	c, r := dial(t, WeightedRoundRobinName, endpoints)
+
+	hits := distribution(t, c, 1, 600)
+	for _, e := range endpoints {
+		if want := 100 * int(e.Weight); hits[e.Addr] < want-2 || hits[e.Addr] > want+2 {
+			t.Errorf("backend with weight %d got %d calls, want %d", e.Weight, hits[e.Addr], want)
+		}
+	}
+
+	// new weights for the same backends apply without reconnecting
+	endpoints[0].Weight, endpoints[2].Weight = 3, 1
+	r.UpdateState(resolver.State{Addresses: endpoint.Addresses(endpoints)})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hits = distribution(t, c, 1, 600)
+		if hits[addrs[0]] >= 298 && hits[addrs[0]] <= 302 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("after the weight update hits = %v, want 300 on %s", hits, addrs[0])
+		}
+	}
+}
+
+// A slow backend has more RPCs in flight, the load aware policies send it less traffic
+// than its fair share.
+func TestLoadAwarePolicies(t *testing.T) {
+	for _, policy := range []string{LeastRequestName, PowerOfTwoChoicesName} {
+		t.Run(policy, func(t *testing.T) {
+			addrs := startBackends(t, 20*time.Millisecond, 0, 0)
+			endpoints := []endpoint.Endpoint{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}}
+			c, _ := dial(t, policy, endpoints)
+
+			hits := distribution(t, c, 6, 50)
+			slow, fast := hits[addrs[0]], (hits[addrs[1]]+hits[addrs[2]])/2
+			t.Logf("%s : slow backend %d calls, fast backends %d calls on average", policy, slow, fast)
+			if slow*2 > fast {
+				t.Errorf("slow backend got %d calls, want less than half of the %d of a fast one", slow, fast)
+			}
+		})
+	}
+}
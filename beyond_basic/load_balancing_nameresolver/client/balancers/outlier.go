@@ -0,0 +1,275 @@
+package balancers
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+)
+
+// OutlierDetectionConfig ejects a backend from the picker when, over one interval, its
+// error rate or its average latency crosses a threshold. The backend comes back after
+// baseEjectionTime, times the number of ejections in a row (up to maxEjectionTime),
+// so that a backend failing again and again is kept out longer each time.
+//
+//	"outlierDetection": {
+//	  "interval": "10s",
+//	  "baseEjectionTime": "30s",
+//	  "maxEjectionTime": "300s",
+//	  "maxEjectionPercent": 50,
+//	  "errorRateThreshold": 0.5,
+//	  "latencyThreshold": "500ms",
+//	  "minimumRequests": 5
+//	}
+//
+// Only the codes telling that the backend failed count as errors (Unavailable, Internal, ...),
+// not the ones about the request such as NotFound or InvalidArgument. The latency of an RPC
+// is measured from the pick until it is done, which includes the whole life of a stream:
+// use latencyThreshold on unary methods only.
+type OutlierDetectionConfig struct {
+	// Interval is how often the backends are evaluated, 10s if empty.
+	Interval Duration `json:"interval,omitempty"`
+	// BaseEjectionTime is how long a backend is ejected the first time, 30s if empty.
+	BaseEjectionTime Duration `json:"baseEjectionTime,omitempty"`
+	// MaxEjectionTime caps the ejection time, 300s if empty.
+	MaxEjectionTime Duration `json:"maxEjectionTime,omitempty"`
+	// MaxEjectionPercent is the share of the backends which can be ejected at the same time, 50 if 0.
+	MaxEjectionPercent int `json:"maxEjectionPercent,omitempty"`
+	// ErrorRateThreshold is the share of failed RPCs ejecting a backend, 0.5 if 0.
+	// A value above 1 disables the error rate check.
+	ErrorRateThreshold float64 `json:"errorRateThreshold,omitempty"`
+	// LatencyThreshold is the average latency ejecting a backend, disabled if empty.
+	LatencyThreshold Duration `json:"latencyThreshold,omitempty"`
+	// MinimumRequests is the number of RPCs a backend needs in an interval to be evaluated, 5 if 0.
+	MinimumRequests int64 `json:"minimumRequests,omitempty"`
+}
+
+func (c *OutlierDetectionConfig) setDefaults() error {
+	if c.Interval == 0 {
+		c.Interval = Duration(10 * time.Second)
+	}
+	if c.BaseEjectionTime == 0 {
+		c.BaseEjectionTime = Duration(30 * time.Second)
+	}
+	if c.MaxEjectionTime == 0 {
+		c.MaxEjectionTime = Duration(300 * time.Second)
+	}
+	if c.MaxEjectionPercent == 0 {
+		c.MaxEjectionPercent = 50
+	}
+	if c.ErrorRateThreshold == 0 {
+		c.ErrorRateThreshold = 0.5
+	}
+	if c.MinimumRequests == 0 {
+		c.MinimumRequests = 5
+	}
+	switch {
+	case c.Interval < 0 || c.BaseEjectionTime < 0 || c.MaxEjectionTime < 0 || c.LatencyThreshold < 0:
+		return fmt.Errorf("durations must be positive")
+	case c.MaxEjectionPercent < 0 || c.MaxEjectionPercent > 100:
+		return fmt.Errorf("maxEjectionPercent must be between 0 and 100, got %d", c.MaxEjectionPercent)
+	case c.ErrorRateThreshold < 0:
+		return fmt.Errorf("errorRateThreshold must be positive, got %v", c.ErrorRateThreshold)
+	case c.MinimumRequests < 0:
+		return fmt.Errorf("minimumRequests must be positive, got %d", c.MinimumRequests)
+	}
+	return nil
+}
+
+var (
+	outlierEjections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "lb_outlier_ejections_total",
+		Help: "Number of times a backend was ejected by outlier detection.",
+	}, []string{"policy", "backend", "reason"})
+	outlierEjected = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "lb_outlier_ejected_backends",
+		Help: "Number of backends currently ejected by outlier detection.",
+	}, []string{"policy"})
+)
+
+// Collectors returns the metrics of the outlier detection and of the zone_aware policy,
+// register them with a prometheus.Registry.
+func Collectors() []prometheus.Collector {
+	return []prometheus.Collector{outlierEjections, outlierEjected, zonePicks}
+}
+
+// backendFailed tells whether an RPC failed because of the backend rather than the request.
+func backendFailed(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.Internal, codes.Unknown, codes.DeadlineExceeded, codes.DataLoss, codes.ResourceExhausted:
+		return true
+	}
+	return false
+}
+
+type outlierStats struct {
+	// outcome of the RPCs of the current interval
+	requests int64
+	failures int64
+	latency  time.Duration
+
+	ejectedUntil time.Time // zero when not ejected
+	ejections    int       // ejections in a row, goes down while the backend behaves
+}
+
+type outlierDetector struct {
+	policy   string
+	cfg      *OutlierDetectionConfig
+	onChange func()
+
+	mu       sync.Mutex
+	backends map[string]*outlierStats
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// newOutlierDetector starts evaluating the backends every interval, onChange is called
+// when a backend is ejected or comes back.
+func newOutlierDetector(policy string, cfg *OutlierDetectionConfig, onChange func()) *outlierDetector {
+	d := &outlierDetector{
+		policy:   policy,
+		cfg:      cfg,
+		onChange: onChange,
+		backends: make(map[string]*outlierStats),
+		done:     make(chan struct{}),
+	}
+	d.wg.Add(1)
+	go d.run()
+	return d
+}
+
+func (d *outlierDetector) run() {
+	defer d.wg.Done()
+	ticker := time.NewTicker(time.Duration(d.cfg.Interval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-d.done:
+			return
+		case now := <-ticker.C:
+			if d.evaluate(now) {
+				d.onChange()
+			}
+		}
+	}
+}
+
+func (d *outlierDetector) stop() {
+	close(d.done)
+	d.wg.Wait()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.backends {
+		if !s.ejectedUntil.IsZero() {
+			outlierEjected.WithLabelValues(d.policy).Dec()
+		}
+	}
+}
+
+// setAddrs keeps the stats of the backends sent by the resolver and forgets the others.
+func (d *outlierDetector) setAddrs(addrs map[string]resolver.Address) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for addr := range addrs {
+		if d.backends[addr] == nil {
+			d.backends[addr] = &outlierStats{}
+		}
+	}
+	for addr, s := range d.backends {
+		if _, ok := addrs[addr]; !ok {
+			if !s.ejectedUntil.IsZero() {
+				outlierEjected.WithLabelValues(d.policy).Dec()
+			}
+			delete(d.backends, addr)
+		}
+	}
+}
+
+func (d *outlierDetector) record(addr string, err error, latency time.Duration) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.backends[addr]
+	if s == nil {
+		return
+	}
+	s.requests++
+	if backendFailed(err) {
+		s.failures++
+	}
+	s.latency += latency
+}
+
+func (d *outlierDetector) isEjected(addr string) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	s := d.backends[addr]
+	return s != nil && !s.ejectedUntil.IsZero()
+}
+
+// evaluate ejects the outliers of the interval ending at now, brings back the backends
+// whose ejection is over, and tells whether the set of ejected backends changed.
+func (d *outlierDetector) evaluate(now time.Time) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	changed := false
+	ejected := 0
+	addrs := make([]string, 0, len(d.backends))
+	for addr, s := range d.backends {
+		addrs = append(addrs, addr)
+		switch {
+		case !s.ejectedUntil.IsZero() && !now.Before(s.ejectedUntil):
+			s.ejectedUntil = time.Time{}
+			outlierEjected.WithLabelValues(d.policy).Dec()
+			log.Printf("[outlier detection] %s : backend %s is back", d.policy, addr)
+			changed = true
+		case !s.ejectedUntil.IsZero():
+			ejected++
+		case s.ejections > 0:
+			s.ejections--
+		}
+	}
+	sort.Strings(addrs)
+
+	maxEjected := len(d.backends) * d.cfg.MaxEjectionPercent / 100
+	for _, addr := range addrs {
+		s := d.backends[addr]
+		reason := d.outlierReason(s)
+		s.requests, s.failures, s.latency = 0, 0, 0
+		if reason == "" || !s.ejectedUntil.IsZero() || ejected >= maxEjected {
+			continue
+		}
+		s.ejections++
+		ejectionTime := time.Duration(d.cfg.BaseEjectionTime) * time.Duration(s.ejections)
+		if ejectionTime > time.Duration(d.cfg.MaxEjectionTime) {
+			ejectionTime = time.Duration(d.cfg.MaxEjectionTime)
+		}
+		s.ejectedUntil = now.Add(ejectionTime)
+		ejected++
+		outlierEjections.WithLabelValues(d.policy, addr, reason).Inc()
+		outlierEjected.WithLabelValues(d.policy).Inc()
+		log.Printf("[outlier detection] %s : backend %s ejected for %v (%s)", d.policy, addr, ejectionTime, reason)
+		changed = true
+	}
+	return changed
+}
+
+// outlierReason returns why the backend is an outlier in the interval, "" if it is not.
+func (d *outlierDetector) outlierReason(s *outlierStats) string {
+	if s.requests == 0 || s.requests < d.cfg.MinimumRequests {
+		return ""
+	}
+	if float64(s.failures)/float64(s.requests) >= d.cfg.ErrorRateThreshold {
+		return "error_rate"
+	}
+	if d.cfg.LatencyThreshold > 0 && s.latency/time.Duration(s.requests) > time.Duration(d.cfg.LatencyThreshold) {
+		return "latency"
+	}
+	return ""
+}
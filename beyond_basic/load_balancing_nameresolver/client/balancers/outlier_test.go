@@ -0,0 +1,126 @@
+package balancers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"loadBalancing/endpoint"
+)
+
+func outlierConfig(policy string) string {
+	return fmt.Sprintf(`{"loadBalancingConfig":[{%q:{"outlierDetection":{
+		"interval":"0.1s","baseEjectionTime":"0.5s","minimumRequests":5,"latencyThreshold":"50ms"}}}]}`, policy)
+}
+
+func tryCall(c ecpb.EchoClient) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{})
+	if err != nil {
+		return "", err
+	}
+	return r.Message, nil
+}
+
+// waitUntil makes batches of calls until ok accepts the backends which answered
+// and the number of failed calls of a batch.
+func waitUntil(t *testing.T, c ecpb.EchoClient, ok func(hits map[string]int, failures int) bool) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hits, failures := make(map[string]int), 0
+		for i := 0; i < 30; i++ {
+			addr, err := tryCall(c)
+			if err != nil {
+				failures++
+				continue
+			}
+			hits[addr]++
+		}
+		if ok(hits, failures) {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still %d failures, hits = %v", failures, hits)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestOutlierDetection_ErrorRate(t *testing.T) {
+	backends := []*testBackend{startBackend(t, 0), startBackend(t, 0), startBackend(t, 0)}
+	endpoints := []endpoint.Endpoint{{Addr: backends[0].addr}, {Addr: backends[1].addr}, {Addr: backends[2].addr}}
+	c, _ := dialConfig(t, outlierConfig(WeightedRoundRobinName), endpoints)
+	ejections := outlierEjections.WithLabelValues(WeightedRoundRobinName, backends[0].addr, "error_rate")
+	before := testutil.ToFloat64(ejections)
+
+	// round robin keeps sending a third of the calls to the failing backend, until it is ejected
+	backends[0].echo.fail.Store(true)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool { return failures == 0 })
+	if got := testutil.ToFloat64(ejections) - before; got != 1 {
+		t.Errorf("lb_outlier_ejections_total increased by %v, want 1", got)
+	}
+
+	// once it recovers, it gets traffic again after the ejection time
+	backends[0].echo.fail.Store(false)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool { return hits[backends[0].addr] > 0 })
+}
+
+func TestOutlierDetection_Latency(t *testing.T) {
+	slow := startBackend(t, 100*time.Millisecond)
+	addrs := append(startBackends(t, 0, 0), slow.addr)
+	endpoints := []endpoint.Endpoint{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}}
+	// the slow backend only answers a few calls per interval, evaluate it over a longer one
+	c, _ := dialConfig(t, `{"loadBalancingConfig":[{"static_weighted_round_robin":{"outlierDetection":{
+		"interval":"0.5s","baseEjectionTime":"2s","minimumRequests":3,"latencyThreshold":"50ms"}}}]}`, endpoints)
+
+	waitUntil(t, c, func(hits map[string]int, failures int) bool { return hits[slow.addr] == 0 })
+}
+
+// Ejections stop at maxEjectionPercent, here one backend out of three.
+func TestOutlierDetection_MaxEjectionPercent(t *testing.T) {
+	backends := []*testBackend{startBackend(t, 0), startBackend(t, 0), startBackend(t, 0)}
+	endpoints := []endpoint.Endpoint{{Addr: backends[0].addr}, {Addr: backends[1].addr}, {Addr: backends[2].addr}}
+	c, _ := dialConfig(t, outlierConfig(PowerOfTwoChoicesName), endpoints)
+	ejected := outlierEjected.WithLabelValues(PowerOfTwoChoicesName)
+
+	backends[0].echo.fail.Store(true)
+	backends[1].echo.fail.Store(true)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool { return testutil.ToFloat64(ejected) == 1 })
+	time.Sleep(300 * time.Millisecond)
+	if got := testutil.ToFloat64(ejected); got != 1 {
+		t.Errorf("lb_outlier_ejected_backends = %v, want 1", got)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	backends := []*testBackend{startBackend(t, 0), startBackend(t, 0)}
+	endpoints := []endpoint.Endpoint{{Addr: backends[0].addr}, {Addr: backends[1].addr}}
+	c, _ := dialConfig(t, `{"loadBalancingConfig":[{"least_outstanding_requests":{}}],"healthCheckConfig":{"serviceName":""}}`, endpoints)
+
+	backends[0].health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool { return failures == 0 && hits[backends[0].addr] == 0 })
+
+	backends[0].health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool { return hits[backends[0].addr] > 0 })
+}
+
+func TestParseConfig_OutlierDetection(t *testing.T) {
+	cfg, err := parseConfig(LeastRequestName)([]byte(`{"outlierDetection":{"interval":"1s"}}`))
+	if err != nil {
+		t.Fatalf("parseConfig failed: %v", err)
+	}
+	od := cfg.(*Config).OutlierDetection
+	if time.Duration(od.Interval) != time.Second || time.Duration(od.BaseEjectionTime) != 30*time.Second || od.MaxEjectionPercent != 50 {
+		t.Errorf("outlierDetection = %+v, want interval 1s and the defaults", od)
+	}
+	for _, js := range []string{`{"outlierDetection":{"interval":"soon"}}`, `{"outlierDetection":{"maxEjectionPercent":150}}`} {
+		if _, err := parseConfig(LeastRequestName)([]byte(js)); err == nil {
+			t.Errorf("parseConfig(%s) succeeded, want error", js)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package balancers
+
+import (
+	"math/rand"
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/balancer"
+	"loadBalancing/endpoint"
+)
+
+// wrrPicker is a smooth weighted round robin: with weights 3 and 1 it picks a, a, b, a
+// rather than a, a, a, b, so that a heavy backend doesn't receive bursts.
+type wrrPicker struct {
+	mu       sync.Mutex
+	backends []*Backend
+	weights  []int64
+	current  []int64
+	total    int64
+}
+
+func newWRRPicker(backends []*Backend) balancer.Picker {
+	p := &wrrPicker{backends: backends, weights: make([]int64, len(backends)), current: make([]int64, len(backends))}
+	for i, b := range backends {
+		p.weights[i] = int64(endpoint.Weight(b.Address))
+		p.total += p.weights[i]
+	}
+	return p
+}
+
+func (p *wrrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.mu.Lock()
+	best := 0
+	for i := range p.backends {
+		p.current[i] += p.weights[i]
+		if p.current[i] > p.current[best] {
+			best = i
+		}
+	}
+	p.current[best] -= p.total
+	p.mu.Unlock()
+	return p.backends[best].Pick(), nil
+}
+
+// leastRequestPicker sends each RPC to the backend with the fewest RPCs in flight,
+// ties are broken in round robin order.
+type leastRequestPicker struct {
+	backends []*Backend
+	next     uint32
+}
+
+func newLeastRequestPicker(backends []*Backend) balancer.Picker {
+	return &leastRequestPicker{backends: backends}
+}
+
+func (p *leastRequestPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	return leastLoaded(p.backends, atomic.AddUint32(&p.next, 1)).Pick(), nil
+}
+
+// leastLoaded returns the backend with the fewest RPCs in flight, ties are broken
+// in round robin order starting at next.
+func leastLoaded(backends []*Backend, next uint32) *Backend {
+	n := len(backends)
+	start := int(next % uint32(n))
+	best := backends[start]
+	for i := 1; i < n; i++ {
+		if b := backends[(start+i)%n]; b.Inflight() < best.Inflight() {
+			best = b
+		}
+	}
+	return best
+}
+
+// p2cPicker picks two backends at random and sends the RPC to the one with fewer RPCs
+// in flight. Close to least requests, but without scanning every backend and without
+// every client rushing to the same least loaded backend.
+type p2cPicker struct {
+	backends []*Backend
+}
+
+func newP2CPicker(backends []*Backend) balancer.Picker {
+	return &p2cPicker{backends: backends}
+}
+
+func (p *p2cPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	n := len(p.backends)
+	if n == 1 {
+		return p.backends[0].Pick(), nil
+	}
+	i := rand.Intn(n)
+	j := rand.Intn(n - 1)
+	if j >= i {
+		j++
+	}
+	a, b := p.backends[i], p.backends[j]
+	if b.Inflight() < a.Inflight() {
+		a = b
+	}
+	return a.Pick(), nil
+}
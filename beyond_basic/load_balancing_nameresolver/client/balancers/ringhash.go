@@ -0,0 +1,185 @@
+package balancers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"sort"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/serviceconfig"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"loadBalancing/endpoint"
+)
+
+const (
+	// DefaultHashHeader is the metadata header holding the hash key of an RPC.
+	DefaultHashHeader = "x-order-id"
+	// DefaultVirtualNodes is the number of points a backend of weight 1 has on the ring.
+	DefaultVirtualNodes = 100
+	maxVirtualNodes     = 10000
+	// maxRingSize bounds the points of all the backends, the virtual nodes of every
+	// backend are scaled down to fit. The ring is rebuilt with every picker.
+	maxRingSize = 100000
+)
+
+// RingHashConfig is the config of the order_ring_hash policy in the service config:
+//
+//	{"loadBalancingConfig":[{"order_ring_hash":{"hashHeader":"x-order-id","virtualNodes":100}}]}
+type RingHashConfig struct {
+	Config
+
+	// HashHeader is the metadata header holding the hash key, DefaultHashHeader if empty.
+	HashHeader string `json:"hashHeader,omitempty"`
+	// VirtualNodes is the number of points on the ring per unit of weight of a backend,
+	// more points spread the keys more evenly. DefaultVirtualNodes if 0.
+	VirtualNodes int `json:"virtualNodes,omitempty"`
+}
+
+func parseRingHashConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &RingHashConfig{}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("%s: invalid config %s: %v", RingHashName, js, err)
+	}
+	if cfg.HashHeader == "" {
+		cfg.HashHeader = DefaultHashHeader
+	}
+	// metadata keys are lower case
+	cfg.HashHeader = strings.ToLower(cfg.HashHeader)
+	if cfg.VirtualNodes == 0 {
+		cfg.VirtualNodes = DefaultVirtualNodes
+	}
+	if cfg.VirtualNodes < 0 || cfg.VirtualNodes > maxVirtualNodes {
+		return nil, fmt.Errorf("%s: virtualNodes must be between 1 and %d, got %d", RingHashName, maxVirtualNodes, cfg.VirtualNodes)
+	}
+	if err := cfg.validate(RingHashName); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+type ringEntry struct {
+	hash uint64
+	addr string
+}
+
+// ringHashPicker places every backend sent by the resolver on a ring, at VirtualNodes
+// points per unit of weight. An RPC goes to the first backend found clockwise from the
+// hash of its key:
+//   - when a backend is added or removed, only the keys of its own segments of the ring
+//     move, the other keys stay on their backend and keep its cache warm.
+//   - when the chosen backend is not ready (connection or health check failing), the RPC
+//     falls back to the next backend on the ring, and the key comes back once it recovers.
+type ringHashPicker struct {
+	header   string
+	ring     []ringEntry
+	ready    map[string]*Backend
+	backends []*Backend
+}
+
+func newRingHashPicker(info pickerInfo) balancer.Picker {
+	cfg, ok := info.config.(*RingHashConfig)
+	if !ok {
+		cfg = &RingHashConfig{HashHeader: DefaultHashHeader, VirtualNodes: DefaultVirtualNodes}
+	}
+	p := &ringHashPicker{header: cfg.HashHeader, ready: make(map[string]*Backend), backends: info.backends}
+	for _, b := range info.backends {
+		p.ready[b.Address.Addr] = b
+	}
+	// The ring is built from every address, ready or not, so that a backend going down
+	// for a while doesn't move the keys of the others.
+	total := 0
+	for _, a := range info.addrs {
+		total += cfg.VirtualNodes * int(endpoint.Weight(a))
+	}
+	for _, a := range info.addrs {
+		points := cfg.VirtualNodes * int(endpoint.Weight(a))
+		if total > maxRingSize {
+			// keep the shares of the backends, and at least a point each
+			points = points*maxRingSize/total + 1
+		}
+		for i := 0; i < points; i++ {
+			p.ring = append(p.ring, ringEntry{hash: hashKey(fmt.Sprintf("%s_%d", a.Addr, i)), addr: a.Addr})
+		}
+	}
+	sort.Slice(p.ring, func(i, j int) bool { return p.ring[i].hash < p.ring[j].hash })
+	return p
+}
+
+func (p *ringHashPicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	md, _ := metadata.FromOutgoingContext(info.Ctx)
+	keys := md.Get(p.header)
+	if len(keys) == 0 || len(p.ring) == 0 {
+		// no key, any backend will do
+		return p.backends[rand.Intn(len(p.backends))].Pick(), nil
+	}
+	h := hashKey(keys[0])
+	start := sort.Search(len(p.ring), func(i int) bool { return p.ring[i].hash >= h })
+	for i := 0; i < len(p.ring); i++ {
+		if b, ok := p.ready[p.ring[(start+i)%len(p.ring)].addr]; ok {
+			return b.Pick(), nil
+		}
+	}
+	return balancer.PickResult{}, balancer.ErrNoSubConnAvailable
+}
+
+// hashKey is FNV-1a followed by the splitmix64 finalizer, which spreads the hashes of
+// close strings like "localhost:50051_1" and "localhost:50051_2" over the whole ring.
+func hashKey(key string) uint64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	x := h.Sum64()
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// HashKeyUnaryInterceptor sets the hash key header from a field of the request, e.g.
+// the value of the StringValue of GetOrder:
+//
+//	balancers.HashKeyUnaryInterceptor(balancers.DefaultHashHeader, map[string]string{
+//		"/ecommerce.OrderManagement/getOrder": "value",
+//	})
+//
+// fields maps a full method name to the name of a top level field of its request.
+// A key already set in the outgoing metadata is kept, an unset field sets no key.
+// The backend of a stream is picked before its first message is sent, so streams like
+// UpdateOrders have to set the header themselves with metadata.AppendToOutgoingContext.
+func HashKeyUnaryInterceptor(header string, fields map[string]string) grpc.UnaryClientInterceptor {
+	header = strings.ToLower(header)
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if field, ok := fields[method]; ok {
+			md, _ := metadata.FromOutgoingContext(ctx)
+			if key, ok := fieldValue(req, field); ok && len(md.Get(header)) == 0 {
+				ctx = metadata.AppendToOutgoingContext(ctx, header, key)
+			}
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// fieldValue returns the value of the singular field named field of req, if it is set.
+func fieldValue(req interface{}, field string) (string, bool) {
+	m, ok := req.(proto.Message)
+	if !ok {
+		return "", false
+	}
+	fd := m.ProtoReflect().Descriptor().Fields().ByName(protoreflect.Name(field))
+	if fd == nil || fd.Cardinality() == protoreflect.Repeated || fd.Kind() == protoreflect.MessageKind {
+		return "", false
+	}
+	// an unset field is no key, the RPC can go anywhere
+	if !m.ProtoReflect().Has(fd) {
+		return "", false
+	}
+	return m.ProtoReflect().Get(fd).String(), true
+}
@@ -0,0 +1,177 @@
+package balancers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/status"
+	"loadBalancing/endpoint"
+)
+
+const ringHashConfig = `{"loadBalancingConfig":[{"order_ring_hash":{"hashHeader":"x-order-id"}}]}`
+
+// backendsByKey calls once per order ID and returns the backend of each.
+func backendsByKey(t *testing.T, c ecpb.EchoClient, keys int) map[string]string {
+	backends := make(map[string]string)
+	for i := 0; i < keys; i++ {
+		key := fmt.Sprintf("order-%d", i)
+		ctx := metadata.AppendToOutgoingContext(context.Background(), DefaultHashHeader, key)
+		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{Message: "hello"}, grpc.WaitForReady(true))
+		if status.Code(err) == codes.Unavailable {
+			// the backend was stopped while the RPC was on its way, the retry is picked again
+			r, err = c.UnaryEcho(ctx, &ecpb.EchoRequest{Message: "hello"}, grpc.WaitForReady(true))
+		}
+		cancel()
+		if err != nil {
+			t.Fatalf("UnaryEcho failed: %v", err)
+		}
+		backends[key] = r.Message
+	}
+	return backends
+}
+
+func TestRingHash_SameKeySameBackend(t *testing.T) {
+	addrs := startBackends(t, 0, 0, 0)
+	endpoints := []endpoint.Endpoint{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}}
+	c, r := dialConfig(t, ringHashConfig, endpoints)
+
+	before := backendsByKey(t, c, 300)
+	perBackend := make(map[string]int)
+	for key, addr := range backendsByKey(t, c, 300) {
+		if before[key] != addr {
+			t.Fatalf("%s went to %s then %s", key, before[key], addr)
+		}
+		perBackend[addr]++
+	}
+	if len(perBackend) != 3 {
+		t.Errorf("keys per backend = %v, want keys on every backend", perBackend)
+	}
+
+	// a fourth backend only takes keys, the others keep theirs
+	added := startBackend(t, 0).addr
+	r.UpdateState(resolver.State{Addresses: endpoint.Addresses(append(endpoints, endpoint.Endpoint{Addr: added}))})
+	var after map[string]string
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		after = backendsByKey(t, c, 300)
+		moved := 0
+		for key := range after {
+			if after[key] != before[key] {
+				moved++
+			}
+		}
+		if moved > 0 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	moved := 0
+	for key, addr := range after {
+		if addr != before[key] {
+			moved++
+			if addr != added {
+				t.Errorf("%s moved from %s to %s, want only moves to the new backend", key, before[key], addr)
+			}
+		}
+	}
+	if moved == 0 || moved > 300/2 {
+		t.Errorf("%d of 300 keys moved, want about a quarter", moved)
+	}
+}
+
+func TestRingHash_FallbackWhenUnhealthy(t *testing.T) {
+	downBackend := startBackend(t, 0)
+	down := downBackend.addr
+	addrs := append(startBackends(t, 0, 0), down)
+	endpoints := []endpoint.Endpoint{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}}
+	c, _ := dialConfig(t, ringHashConfig, endpoints)
+	before := backendsByKey(t, c, 300)
+
+	downBackend.server.Stop()
+	var after map[string]string
+	for deadline := time.Now().Add(5 * time.Second); ; {
+		after = backendsByKey(t, c, 300)
+		onDown := 0
+		for _, addr := range after {
+			if addr == down {
+				onDown++
+			}
+		}
+		if onDown == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d keys still on the stopped backend", onDown)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	for key, addr := range after {
+		if before[key] != down && addr != before[key] {
+			t.Errorf("%s moved from healthy %s to %s", key, before[key], addr)
+		}
+	}
+}
+
+func TestHashKeyUnaryInterceptor(t *testing.T) {
+	addrs := startBackends(t, 0, 0, 0)
+	endpoints := []endpoint.Endpoint{{Addr: addrs[0]}, {Addr: addrs[1]}, {Addr: addrs[2]}}
+	interceptor := HashKeyUnaryInterceptor("X-Order-ID", map[string]string{
+		"/grpc.examples.echo.Echo/UnaryEcho": "message",
+	})
+	c, _ := dialConfig(t, ringHashConfig, endpoints, grpc.WithUnaryInterceptor(interceptor))
+	byHeader := backendsByKey(t, c, 50)
+
+	for i := 0; i < 50; i++ {
+		key := fmt.Sprintf("order-%d", i)
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{Message: key})
+		cancel()
+		if err != nil {
+			t.Fatalf("UnaryEcho failed: %v", err)
+		}
+		if r.Message != byHeader[key] {
+			t.Errorf("%s from the request field went to %s, want %s as with the header", key, r.Message, byHeader[key])
+		}
+	}
+}
+
+func TestParseRingHashConfig(t *testing.T) {
+	cfg, err := parseRingHashConfig([]byte(`{"hashHeader":"X-Order-ID"}`))
+	if err != nil {
+		t.Fatalf("parseRingHashConfig failed: %v", err)
+	}
+	if got := cfg.(*RingHashConfig); got.HashHeader != "x-order-id" || got.VirtualNodes != DefaultVirtualNodes {
+		t.Errorf("config = %+v, want lower case header and default virtual nodes", got)
+	}
+	if _, err := parseRingHashConfig([]byte(`{"virtualNodes":-1}`)); err == nil {
+		t.Error("parseRingHashConfig with negative virtualNodes succeeded, want error")
+	}
+}
+
+// The weights are bounded, and so is the ring, whatever the resolver sends.
+func TestRingHash_RingSize(t *testing.T) {
+	heavy := endpoint.Endpoint{Addr: "localhost:50051", Weight: 1000000}.Address()
+	light := endpoint.Endpoint{Addr: "localhost:50052"}.Address()
+	p := newRingHashPicker(pickerInfo{
+		addrs:  []resolver.Address{heavy, light},
+		config: &RingHashConfig{HashHeader: DefaultHashHeader, VirtualNodes: maxVirtualNodes},
+	}).(*ringHashPicker)
+	if len(p.ring) > maxRingSize+2 {
+		t.Errorf("the ring has %d points, want %d at most", len(p.ring), maxRingSize+2)
+	}
+	points := make(map[string]int)
+	for _, e := range p.ring {
+		points[e.addr]++
+	}
+	// the shares of the backends are kept, with the weight lowered to MaxWeight
+	if share := points[heavy.Addr] / points[light.Addr]; share < endpoint.MaxWeight*9/10 || share > endpoint.MaxWeight {
+		t.Errorf("points per backend = %v, want a share of %d", points, endpoint.MaxWeight)
+	}
+}
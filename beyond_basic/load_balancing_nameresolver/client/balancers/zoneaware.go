@@ -0,0 +1,142 @@
+package balancers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/serviceconfig"
+	"loadBalancing/endpoint"
+)
+
+// DefaultMinHealthyPercent is the share of the local backends which must be ready
+// for the local zone to take all the traffic.
+const DefaultMinHealthyPercent = 50
+
+// ZoneAwareConfig is the config of the zone_aware policy in the service config:
+//
+//	{"loadBalancingConfig":[{"zone_aware":{"localZone":"us-east-1a","minHealthyPercent":50,"maxInflightPerBackend":10}}]}
+type ZoneAwareConfig struct {
+	Config
+
+	// LocalZone is the zone of the client, its backends are picked first.
+	// Without it every backend is local.
+	LocalZone string `json:"localZone,omitempty"`
+	// MinHealthyPercent is the share of the backends of the local zone which must be
+	// ready (connected, passing their health check and not ejected), below it the
+	// traffic spills over to every zone. DefaultMinHealthyPercent if 0.
+	MinHealthyPercent int `json:"minHealthyPercent,omitempty"`
+	// MaxInflightPerBackend is the number of RPCs in flight above which a local backend
+	// is overloaded: when every local backend is, the RPC goes to a less loaded backend
+	// of another zone. Disabled if 0.
+	MaxInflightPerBackend int64 `json:"maxInflightPerBackend,omitempty"`
+}
+
+func parseZoneAwareConfig(js json.RawMessage) (serviceconfig.LoadBalancingConfig, error) {
+	cfg := &ZoneAwareConfig{}
+	if err := json.Unmarshal(js, cfg); err != nil {
+		return nil, fmt.Errorf("%s: invalid config %s: %v", ZoneAwareName, js, err)
+	}
+	if cfg.MinHealthyPercent == 0 {
+		cfg.MinHealthyPercent = DefaultMinHealthyPercent
+	}
+	if cfg.MinHealthyPercent < 0 || cfg.MinHealthyPercent > 100 {
+		return nil, fmt.Errorf("%s: minHealthyPercent must be between 0 and 100, got %d", ZoneAwareName, cfg.MinHealthyPercent)
+	}
+	if cfg.MaxInflightPerBackend < 0 {
+		return nil, fmt.Errorf("%s: maxInflightPerBackend must be positive, got %d", ZoneAwareName, cfg.MaxInflightPerBackend)
+	}
+	if err := cfg.validate(ZoneAwareName); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+var zonePicks = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Name: "lb_zone_picks_total",
+	Help: "Number of RPCs sent to each zone by the zone_aware policy.",
+}, []string{"zone", "local"})
+
+type zoneReportKey struct{}
+
+// WithZoneReport returns a context recording the zone of the backend the RPC is sent to
+// by the zone_aware policy, read it with ServedZone once the RPC is done.
+func WithZoneReport(ctx context.Context) context.Context {
+	return context.WithValue(ctx, zoneReportKey{}, new(atomic.Value))
+}
+
+// ServedZone returns the zone which served the RPC made with ctx, "" if unknown.
+func ServedZone(ctx context.Context) string {
+	if v, ok := ctx.Value(zoneReportKey{}).(*atomic.Value); ok {
+		zone, _ := v.Load().(string)
+		return zone
+	}
+	return ""
+}
+
+// zonePicker sends the RPCs to the least loaded backend of the local zone. It spills
+// over to every zone when too few local backends are ready, and sends an RPC to another
+// zone when every local backend is overloaded.
+type zonePicker struct {
+	localZone   string
+	maxInflight int64
+	// candidates of every RPC, the local backends or all of them when the local zone is degraded
+	preferred []*Backend
+	// backends of the other zones, for the RPCs overloading the local zone
+	remote []*Backend
+	next   uint32
+}
+
+func newZonePicker(info pickerInfo) balancer.Picker {
+	cfg, ok := info.config.(*ZoneAwareConfig)
+	if !ok {
+		cfg = &ZoneAwareConfig{MinHealthyPercent: DefaultMinHealthyPercent}
+	}
+	p := &zonePicker{localZone: cfg.LocalZone, maxInflight: cfg.MaxInflightPerBackend}
+	var local []*Backend
+	for _, b := range info.backends {
+		if p.isLocal(b) {
+			local = append(local, b)
+		} else {
+			p.remote = append(p.remote, b)
+		}
+	}
+	localTotal := 0
+	for _, a := range info.addrs {
+		if cfg.LocalZone == "" || endpoint.Zone(a) == cfg.LocalZone {
+			localTotal++
+		}
+	}
+
+	p.preferred = local
+	if len(local) == 0 || len(local)*100 < localTotal*cfg.MinHealthyPercent {
+		// the local zone lost too much capacity, spread the traffic over every zone
+		p.preferred = info.backends
+		p.remote = nil
+	}
+	return p
+}
+
+func (p *zonePicker) isLocal(b *Backend) bool {
+	return p.localZone == "" || endpoint.Zone(b.Address) == p.localZone
+}
+
+func (p *zonePicker) Pick(info balancer.PickInfo) (balancer.PickResult, error) {
+	b := leastLoaded(p.preferred, atomic.AddUint32(&p.next, 1))
+	if p.maxInflight > 0 && b.Inflight() >= p.maxInflight && len(p.remote) > 0 {
+		if r := leastLoaded(p.remote, atomic.LoadUint32(&p.next)); r.Inflight() < b.Inflight() {
+			b = r
+		}
+	}
+
+	zone := endpoint.Zone(b.Address)
+	zonePicks.WithLabelValues(zone, strconv.FormatBool(p.isLocal(b))).Inc()
+	if v, ok := info.Ctx.Value(zoneReportKey{}).(*atomic.Value); ok {
+		v.Store(zone)
+	}
+	return b.Pick(), nil
+}
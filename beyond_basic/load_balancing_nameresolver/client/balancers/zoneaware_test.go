@@ -0,0 +1,133 @@
+package balancers
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"loadBalancing/endpoint"
+)
+
+// startZones starts two backends in zone-a and two in zone-b.
+func startZones(t *testing.T, delays ...time.Duration) ([]*testBackend, []endpoint.Endpoint) {
+	var backends []*testBackend
+	var endpoints []endpoint.Endpoint
+	for i, zone := range []string{"zone-a", "zone-a", "zone-b", "zone-b"} {
+		var delay time.Duration
+		if i < len(delays) {
+			delay = delays[i]
+		}
+		b := startBackend(t, delay)
+		backends = append(backends, b)
+		endpoints = append(endpoints, endpoint.Endpoint{Addr: b.addr, Zone: zone})
+	}
+	return backends, endpoints
+}
+
+func zoneConfig(cfg string) string {
+	return fmt.Sprintf(`{"loadBalancingConfig":[{"zone_aware":%s}],"healthCheckConfig":{"serviceName":""}}`, cfg)
+}
+
+// zoneHits makes n calls and counts the calls per zone reported by ServedZone.
+func zoneHits(t *testing.T, c ecpb.EchoClient, n int) map[string]int {
+	hits := make(map[string]int)
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(WithZoneReport(context.Background()), 5*time.Second)
+		if _, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{}, grpc.WaitForReady(true)); err != nil {
+			t.Errorf("UnaryEcho failed: %v", err)
+		}
+		hits[ServedZone(ctx)]++
+		cancel()
+	}
+	return hits
+}
+
+// zoneOf maps the backends which answered to their zone.
+func zoneOf(endpoints []endpoint.Endpoint, hits map[string]int) map[string]int {
+	zones := make(map[string]int)
+	for _, e := range endpoints {
+		zones[e.Zone] += hits[e.Addr]
+	}
+	return zones
+}
+
+func TestZoneAware_PrefersLocalZone(t *testing.T) {
+	_, endpoints := startZones(t)
+	// waitForAll would never see zone-b, dial only the local backends first
+	c, r := dialConfig(t, zoneConfig(`{"localZone":"zone-a"}`), endpoints[:2])
+	r.UpdateState(resolver.State{Addresses: endpoint.Addresses(endpoints)})
+	remote := zonePicks.WithLabelValues("zone-b", "false")
+	before := testutil.ToFloat64(remote)
+
+	hits := zoneHits(t, c, 100)
+	if hits["zone-a"] != 100 {
+		t.Errorf("calls per zone = %v, want all of them in zone-a", hits)
+	}
+	if got := testutil.ToFloat64(remote) - before; got != 0 {
+		t.Errorf("lb_zone_picks_total{zone=zone-b} increased by %v, want 0", got)
+	}
+}
+
+func TestZoneAware_FailoverWhenUnhealthy(t *testing.T) {
+	backends, endpoints := startZones(t)
+	c, r := dialConfig(t, zoneConfig(`{"localZone":"zone-a","minHealthyPercent":100}`), endpoints[:2])
+	r.UpdateState(resolver.State{Addresses: endpoint.Addresses(endpoints)})
+
+	// with one local backend out of two, the local zone is below minHealthyPercent and
+	// the traffic spreads over the three backends left
+	backends[0].health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool {
+		return failures == 0 && hits[backends[0].addr] == 0 && zoneOf(endpoints, hits)["zone-b"] > 0
+	})
+
+	backends[1].health.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool {
+		return failures == 0 && zoneOf(endpoints, hits)["zone-b"] == 30
+	})
+
+	// once the local zone recovers, it takes all the traffic back
+	backends[0].health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	backends[1].health.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	waitUntil(t, c, func(hits map[string]int, failures int) bool {
+		return zoneOf(endpoints, hits)["zone-a"] == 30
+	})
+}
+
+// A slow local zone piles up RPCs in flight, the ones above maxInflightPerBackend go
+// to the other zone.
+func TestZoneAware_SpillsOverWhenOverloaded(t *testing.T) {
+	_, endpoints := startZones(t, 20*time.Millisecond, 20*time.Millisecond)
+	c, r := dialConfig(t, zoneConfig(`{"localZone":"zone-a","maxInflightPerBackend":2}`), endpoints[:2])
+	r.UpdateState(resolver.State{Addresses: endpoint.Addresses(endpoints)})
+
+	// one call at a time never overloads the local zone
+	if hits := zoneOf(endpoints, distribution(t, c, 1, 20)); hits["zone-b"] != 0 {
+		t.Errorf("sequential calls per zone = %v, want all of them in zone-a", hits)
+	}
+	hits := zoneOf(endpoints, distribution(t, c, 8, 20))
+	t.Logf("concurrent calls per zone = %v", hits)
+	if hits["zone-b"] == 0 {
+		t.Errorf("concurrent calls per zone = %v, want some of them in zone-b", hits)
+	}
+}
+
+func TestParseZoneAwareConfig(t *testing.T) {
+	cfg, err := parseZoneAwareConfig([]byte(`{"localZone":"zone-a"}`))
+	if err != nil {
+		t.Fatalf("parseZoneAwareConfig failed: %v", err)
+	}
+	if got := cfg.(*ZoneAwareConfig); got.LocalZone != "zone-a" || got.MinHealthyPercent != DefaultMinHealthyPercent {
+		t.Errorf("config = %+v, want localZone zone-a and the default minHealthyPercent", got)
+	}
+	for _, js := range []string{`{"minHealthyPercent":150}`, `{"maxInflightPerBackend":-1}`, `{"localZone":1}`} {
+		if _, err := parseZoneAwareConfig([]byte(js)); err == nil {
+			t.Errorf("parseZoneAwareConfig(%s) succeeded, want error", js)
+		}
+	}
+}
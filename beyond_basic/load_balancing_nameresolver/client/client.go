@@ -1,15 +1,26 @@
 package main
 
 import (
+	"admin"
 	"context"
+	"encoding/json"
+	"flag"
 	"fmt"
 	"log"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
 	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	_ "google.golang.org/grpc/health" // enables the client side health checks
 	"google.golang.org/grpc/resolver"
+	"loadBalancing/balancers" // registers the custom load balancing policies
+	"loadBalancing/fileresolver"
+	"loadBalancing/registryresolver"
 )
 
 const (
@@ -19,6 +30,23 @@ const (
 
 var addrs = []string{"localhost:50051", "localhost:50052"}
 
+var (
+	endpointsFile = flag.String("endpoints", "", "JSON file with the backends of each service, watched for changes (e.g. endpoints.json)")
+	registryAddr  = flag.String("registry", "", "address of the registry the backends register with, e.g. localhost:50050")
+	lbPolicy      = flag.String("lb", "round_robin", "load balancing policy used with -endpoints or -registry, e.g. static_weighted_round_robin, least_outstanding_requests, power_of_two_choices, zone_aware")
+	zone          = flag.String("zone", "", "zone of the client, the zone_aware policy prefers the backends of this zone")
+
+	healthCheck      = flag.Bool("health-check", true, "only send RPCs to the backends reporting SERVING with grpc.health.v1")
+	outlierDetection = flag.Bool("outlier-detection", false, "eject the failing or slow backends, with the policies of package balancers")
+	metricsAddr      = flag.String("metrics", "", "address serving the outlier detection metrics on /metrics, e.g. :9094")
+	adminAddr        = flag.String("admin", "", "address of the channelz page with the channels and subchannels of the client, e.g. :8083; off if empty")
+
+	streams        = flag.Int("streams", 0, "open this many bidirectional streams instead of making unary calls, and report how they are spread over the backends")
+	streamInterval = flag.Duration("stream-interval", 500*time.Millisecond, "interval between the messages of each stream")
+	streamMaxAge   = flag.Duration("stream-max-age", 0, "reopen the streams after this duration so that they rebalance over the backends, never if 0")
+	reportInterval = flag.Duration("report-interval", 2*time.Second, "interval between the reports of the stream distribution")
+)
+
 func callUnaryEcho(c ecpb.EchoClient, message string) {
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
@@ -37,6 +65,27 @@ func makeRPCs(cc *grpc.ClientConn, n int) {
 }
 
 func main() {
+	flag.Parse()
+	if err := checkFlags(); err != nil {
+		log.Fatal(err)
+	}
+	if *adminAddr != "" {
+		// the subchannel of every backend, its state, its calls and its connection
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
+	if *endpointsFile != "" {
+		watchEndpoints(fileresolver.Scheme, fileresolver.NewBuilder(*endpointsFile, fileresolver.DefaultPollInterval))
+		return
+	}
+	if *registryAddr != "" {
+		watchEndpoints(registryresolver.Scheme, registryresolver.NewBuilder(*registryAddr))
+		return
+	}
+	if *streams > 0 {
+		watchEndpoints(exampleScheme, &exampleResolverBuilder{})
+		return
+	}
+
 	pickfirstConn, err := grpc.Dial(
 		fmt.Sprintf("%s:///%s", exampleScheme, exampleServiceName), // "example:///lb.example.grpc.io"
 		// grpc.WithBalancerName("pick_first"), // "pick_first" is the default, so this DialOption is not necessary.
@@ -64,6 +113,101 @@ func main() {
 
 	log.Println("==== Calling helloworld.Greeter/SayHello with round_robin ====")
 	makeRPCs(roundrobinConn, 10)
+	if *adminAddr != "" {
+		admin.Linger(*adminAddr)
+	}
+}
+
+// watchEndpoints resolves the service with a dynamic resolver and keeps calling it,
+// or streaming with -streams, add or remove backends while it runs.
+func watchEndpoints(scheme string, builder resolver.Builder) {
+	conn, err := grpc.Dial(
+		fmt.Sprintf("%s:///%s", scheme, exampleServiceName), // "file:///lb.example.grpc.io" or "registry:///lb.example.grpc.io"
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(builder),
+		grpc.WithDefaultServiceConfig(serviceConfig()),
+	)
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	if *metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(balancers.Collectors()...)
+		http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		go func() {
+			if err := http.ListenAndServe(*metricsAddr, nil); err != nil {
+				log.Fatalf("failed to serve metrics: %v", err)
+			}
+		}()
+	}
+
+	log.Printf("==== Calling %s:///%s with %s ====", scheme, exampleServiceName, serviceConfig())
+	if *streams > 0 {
+		runStreams(conn, *streams)
+		return
+	}
+	hwc := ecpb.NewEchoClient(conn)
+	for {
+		// keep going when no backend is up, the resolver reports it as soon as one comes back
+		ctx, cancel := context.WithTimeout(balancers.WithZoneReport(context.Background()), time.Second)
+		r, err := hwc.UnaryEcho(ctx, &ecpb.EchoRequest{Message: "this is examples/load_balancing"})
+		cancel()
+		switch {
+		case err != nil:
+			log.Printf("could not greet: %v", err)
+		case balancers.ServedZone(ctx) != "":
+			fmt.Printf("%s [zone %s]\n", r.Message, balancers.ServedZone(ctx))
+		default:
+			fmt.Println(r.Message)
+		}
+		time.Sleep(500 * time.Millisecond)
+	}
+}
+
+// checkFlags rejects the flags which would be silently ignored.
+func checkFlags() error {
+	if !*outlierDetection {
+		return nil
+	}
+	// round_robin and the other policies of gRPC would ignore the outlierDetection config
+	for _, name := range balancers.Names {
+		if *lbPolicy == name {
+			return nil
+		}
+	}
+	return fmt.Errorf("-outlier-detection needs a policy of package balancers, one of %s, not -lb %s",
+		strings.Join(balancers.Names, ", "), *lbPolicy)
+}
+
+// serviceConfig selects the load balancing policy with the zone of the client,
+// and turns on the health checks and the outlier detection.
+func serviceConfig() string {
+	policyConfig := map[string]interface{}{}
+	if *outlierDetection {
+		policyConfig["outlierDetection"] = map[string]interface{}{
+			"interval":           "5s",
+			"baseEjectionTime":   "10s",
+			"errorRateThreshold": 0.5,
+			"latencyThreshold":   "200ms",
+			// the client only makes 2 calls per second
+			"minimumRequests": 2,
+		}
+	}
+	if *lbPolicy == balancers.ZoneAwareName {
+		policyConfig["localZone"] = *zone
+		// spill over when more than 5 calls wait on every backend of the zone
+		policyConfig["maxInflightPerBackend"] = 5
+	}
+	sc := map[string]interface{}{
+		"loadBalancingConfig": []interface{}{map[string]interface{}{*lbPolicy: policyConfig}},
+	}
+	if *healthCheck {
+		sc["healthCheckConfig"] = map[string]string{"serviceName": ""}
+	}
+	js, _ := json.Marshal(sc)
+	return string(js)
 }
 
 // Name resolver implementation
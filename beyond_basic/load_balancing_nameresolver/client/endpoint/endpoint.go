@@ -0,0 +1,69 @@
+// Package endpoint describes the backends of a service handed out by the name resolvers,
+// along with the attributes (weight, zone) the load balancing policies read from them.
+package endpoint
+
+import (
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/resolver"
+)
+
+// DefaultWeight is used for endpoints which don't set a weight.
+const DefaultWeight = 1
+
+// MaxWeight is the highest weight of an endpoint, a higher one is lowered to it: the
+// weights come from files and registrants, and the ring hash policy places points on
+// its ring per unit of weight.
+const MaxWeight = 1000
+
+type weightKey struct{}
+type zoneKey struct{}
+
+// Endpoint is one backend of a service.
+type Endpoint struct {
+	Addr string `json:"addr"`
+	// Weight is the share of the traffic relative to the other endpoints, 0 means DefaultWeight.
+	Weight uint32 `json:"weight,omitempty"`
+	// Zone the backend runs in, e.g. us-east-1a
+	Zone string `json:"zone,omitempty"`
+}
+
+// Address converts e to the address passed to the balancer.
+// The weight and zone are kept in BalancerAttributes so that changing them
+// doesn't create a new connection to the backend.
+func (e Endpoint) Address() resolver.Address {
+	weight := e.Weight
+	if weight == 0 {
+		weight = DefaultWeight
+	}
+	return resolver.Address{
+		Addr:               e.Addr,
+		BalancerAttributes: attributes.New(weightKey{}, weight).WithValue(zoneKey{}, e.Zone),
+	}
+}
+
+// Addresses converts every endpoint to its address.
+func Addresses(endpoints []Endpoint) []resolver.Address {
+	addrs := make([]resolver.Address, len(endpoints))
+	for i, e := range endpoints {
+		addrs[i] = e.Address()
+	}
+	return addrs
+}
+
+// Weight returns the weight of addr, DefaultWeight if it has none, MaxWeight at most.
+func Weight(addr resolver.Address) uint32 {
+	w, ok := addr.BalancerAttributes.Value(weightKey{}).(uint32)
+	switch {
+	case !ok || w == 0:
+		return DefaultWeight
+	case w > MaxWeight:
+		return MaxWeight
+	}
+	return w
+}
+
+// Zone returns the zone of addr, "" if it is unknown.
+func Zone(addr resolver.Address) string {
+	z, _ := addr.BalancerAttributes.Value(zoneKey{}).(string)
+	return z
+}
@@ -0,0 +1,157 @@
+// Package fileresolver implements a name resolver which reads the backends of a service
+// from a JSON file, and pushes a new state to the ClientConn every time the file changes.
+//
+// The file maps a service name to its endpoints:
+//
+//	{
+//	  "lb.example.grpc.io": [
+//	    {"addr": "localhost:50051", "weight": 3, "zone": "us-east-1a"},
+//	    {"addr": "localhost:50052", "weight": 1, "zone": "us-east-1b"}
+//	  ]
+//	}
+//
+// and the service is dialed with "file:///lb.example.grpc.io".
+package fileresolver
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"loadBalancing/endpoint"
+)
+
+// Scheme of the targets served by this resolver.
+const Scheme = "file"
+
+// DefaultPollInterval is how often the file is checked for changes.
+const DefaultPollInterval = time.Second
+
+type builder struct {
+	path         string
+	pollInterval time.Duration
+}
+
+// NewBuilder returns a resolver.Builder reading the endpoints from the file at path,
+// pass it to grpc.WithResolvers or resolver.Register.
+func NewBuilder(path string, pollInterval time.Duration) resolver.Builder {
+	if pollInterval <= 0 {
+		pollInterval = DefaultPollInterval
+	}
+	return &builder{path: path, pollInterval: pollInterval}
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &fileResolver{
+		service:      target.Endpoint(),
+		path:         b.path,
+		pollInterval: b.pollInterval,
+		cc:           cc,
+		resolveNow:   make(chan struct{}, 1),
+		done:         make(chan struct{}),
+	}
+	// fail the Dial right away if the file can't be read
+	if err := r.resolve(); err != nil {
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+func (b *builder) Scheme() string { return Scheme }
+
+type fileResolver struct {
+	service      string
+	path         string
+	pollInterval time.Duration
+	cc           resolver.ClientConn
+
+	// content of the file when the state was last pushed
+	last      []byte
+	endpoints []endpoint.Endpoint
+
+	resolveNow chan struct{}
+	done       chan struct{}
+	closeOnce  sync.Once
+	wg         sync.WaitGroup
+}
+
+// watch re-reads the file every pollInterval, or right away when gRPC asks for it.
+func (r *fileResolver) watch() {
+	defer r.wg.Done()
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+		case <-r.resolveNow:
+		}
+		if err := r.resolve(); err != nil {
+			// keep the last good list of backends, the balancer keeps using them
+			log.Printf("[file resolver] %s : %v", r.service, err)
+			r.cc.ReportError(err)
+		}
+	}
+}
+
+// resolve reads the file and pushes the endpoints of the service when the file has changed.
+func (r *fileResolver) resolve() error {
+	content, err := os.ReadFile(r.path)
+	if err != nil {
+		return fmt.Errorf("reading endpoints file: %v", err)
+	}
+	if r.last != nil && bytes.Equal(content, r.last) {
+		return nil
+	}
+	services := make(map[string][]endpoint.Endpoint)
+	if err := json.Unmarshal(content, &services); err != nil {
+		return fmt.Errorf("parsing endpoints file %s: %v", r.path, err)
+	}
+	endpoints, ok := services[r.service]
+	if !ok {
+		return fmt.Errorf("service %q not found in %s", r.service, r.path)
+	}
+	// Backends missing from the new state are removed by the balancer: their connection
+	// is drained, RPCs already running on it finish while new RPCs go to the others.
+	if err := r.cc.UpdateState(resolver.State{Addresses: endpoint.Addresses(endpoints)}); err != nil {
+		// the file is pushed again on the next poll
+		return err
+	}
+	r.logChanges(endpoints)
+	r.last = content
+	r.endpoints = endpoints
+	return nil
+}
+
+func (r *fileResolver) logChanges(endpoints []endpoint.Endpoint) {
+	current := make(map[string]bool)
+	for _, e := range endpoints {
+		current[e.Addr] = true
+	}
+	for _, e := range r.endpoints {
+		if !current[e.Addr] {
+			log.Printf("[file resolver] %s : backend %s removed", r.service, e.Addr)
+		}
+	}
+	log.Printf("[file resolver] %s : %v", r.service, endpoints)
+}
+
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (r *fileResolver) Close() {
+	r.closeOnce.Do(func() { close(r.done) })
+	r.wg.Wait()
+}
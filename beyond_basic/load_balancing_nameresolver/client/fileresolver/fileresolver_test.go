@@ -0,0 +1,232 @@
+package fileresolver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/resolver"
+	"loadBalancing/endpoint"
+)
+
+const serviceName = "lb.example.grpc.io"
+
+// ecServer answers with its own address, once block is set the next call
+// is held until release is closed.
+type ecServer struct {
+	ecpb.UnimplementedEchoServer
+	addr    string
+	block   atomic.Bool
+	blocked chan struct{}
+	release chan struct{}
+}
+
+func (s *ecServer) UnaryEcho(ctx context.Context, req *ecpb.EchoRequest) (*ecpb.EchoResponse, error) {
+	if s.block.CompareAndSwap(true, false) {
+		close(s.blocked)
+		<-s.release
+	}
+	return &ecpb.EchoResponse{Message: s.addr}, nil
+}
+
+func startBackend(t *testing.T) *ecServer {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	ec := &ecServer{addr: lis.Addr().String(), blocked: make(chan struct{}), release: make(chan struct{})}
+	s := grpc.NewServer()
+	ecpb.RegisterEchoServer(s, ec)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return ec
+}
+
+func writeEndpoints(t *testing.T, path string, endpoints ...endpoint.Endpoint) {
+	content, _ := json.Marshal(map[string][]endpoint.Endpoint{serviceName: endpoints})
+	// write and rename so that the resolver never reads a half written file
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, content, 0o644); err != nil {
+		t.Fatalf("failed to write endpoints: %v", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("failed to write endpoints: %v", err)
+	}
+}
+
+// backendsHit makes n calls and returns the backends which answered.
+func backendsHit(t *testing.T, c ecpb.EchoClient, n int) map[string]int {
+	hits := make(map[string]int)
+	for i := 0; i < n; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{Message: "hello"})
+		cancel()
+		if err != nil {
+			t.Fatalf("UnaryEcho failed: %v", err)
+		}
+		hits[r.Message]++
+	}
+	return hits
+}
+
+// waitForBackends calls until exactly the want backends answer.
+func waitForBackends(t *testing.T, c ecpb.EchoClient, want ...string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hits := backendsHit(t, c, 10)
+		match := len(hits) == len(want)
+		for _, addr := range want {
+			match = match && hits[addr] > 0
+		}
+		if match {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backends hit = %v, want %v", hits, want)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestFileResolver_WatchesChanges(t *testing.T) {
+	b1, b2 := startBackend(t), startBackend(t)
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	writeEndpoints(t, path, endpoint.Endpoint{Addr: b1.addr, Weight: 3, Zone: "a"})
+
+	conn, err := grpc.Dial(fmt.Sprintf("%s:///%s", Scheme, serviceName),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(NewBuilder(path, 10*time.Millisecond)),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+	)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := ecpb.NewEchoClient(conn)
+	waitForBackends(t, c, b1.addr)
+
+	// a backend is added
+	writeEndpoints(t, path, endpoint.Endpoint{Addr: b1.addr}, endpoint.Endpoint{Addr: b2.addr})
+	waitForBackends(t, c, b1.addr, b2.addr)
+
+	// b1 is removed while an RPC is running on it
+	b1.block.Store(true)
+	done := make(chan error)
+	go func() {
+		for {
+			// round robin, retry until the call lands on b1
+			r, err := c.UnaryEcho(context.Background(), &ecpb.EchoRequest{Message: "hello"})
+			if err != nil || r.Message == b1.addr {
+				done <- err
+				return
+			}
+		}
+	}()
+	<-b1.blocked
+	writeEndpoints(t, path, endpoint.Endpoint{Addr: b2.addr})
+	waitForBackends(t, c, b2.addr)
+
+	close(b1.release)
+	if err := <-done; err != nil {
+		t.Errorf("in-flight RPC on the removed backend failed: %v", err)
+	}
+}
+
+func TestFileResolver_BadFileKeepsBackends(t *testing.T) {
+	b1 := startBackend(t)
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+
+	target := fmt.Sprintf("%s:///%s", Scheme, serviceName)
+	creds := grpc.WithTransportCredentials(insecure.NewCredentials())
+	if _, err := grpc.Dial(target, creds, grpc.WithResolvers(NewBuilder(path, 0))); err == nil ||
+		!strings.Contains(err.Error(), "reading endpoints file") {
+		t.Errorf("Dial with a missing file = %v, want error", err)
+	}
+
+	writeEndpoints(t, path, endpoint.Endpoint{Addr: b1.addr})
+	conn, err := grpc.Dial(target, creds, grpc.WithResolvers(NewBuilder(path, 10*time.Millisecond)))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := ecpb.NewEchoClient(conn)
+	waitForBackends(t, c, b1.addr)
+
+	if err := os.WriteFile(path, []byte("{not json"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if hits := backendsHit(t, c, 5); hits[b1.addr] != 5 {
+		t.Errorf("backends hit = %v, want %s after a bad update", hits, b1.addr)
+	}
+}
+
+// fakeClientConn records the states pushed by the resolver, and fails them with err.
+type fakeClientConn struct {
+	resolver.ClientConn
+	err    error
+	states []resolver.State
+}
+
+func (cc *fakeClientConn) UpdateState(s resolver.State) error {
+	cc.states = append(cc.states, s)
+	return cc.err
+}
+
+// A state the ClientConn rejects is pushed again, even when the file hasn't changed.
+func TestFileResolver_UpdateStateFails(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints.json")
+	writeEndpoints(t, path, endpoint.Endpoint{Addr: "localhost:50051"})
+	cc := &fakeClientConn{err: errors.New("bad state")}
+	r := &fileResolver{service: serviceName, path: path, cc: cc}
+
+	if err := r.resolve(); err != cc.err {
+		t.Fatalf("resolve() = %v, want %v", err, cc.err)
+	}
+	if r.last != nil || r.endpoints != nil {
+		t.Errorf("the rejected state was kept: %s, %v", r.last, r.endpoints)
+	}
+
+	cc.err = nil
+	if err := r.resolve(); err != nil {
+		t.Fatalf("resolve() = %v", err)
+	}
+	if len(cc.states) != 2 {
+		t.Fatalf("%d states pushed, want 2", len(cc.states))
+	}
+	if addrs := cc.states[1].Addresses; len(addrs) != 1 || addrs[0].Addr != "localhost:50051" {
+		t.Errorf("state pushed again = %v, want localhost:50051", addrs)
+	}
+
+	// unchanged, once accepted
+	if err := r.resolve(); err != nil || len(cc.states) != 2 {
+		t.Errorf("resolve() = %v with %d states pushed, want nil and 2", err, len(cc.states))
+	}
+}
+
+func TestEndpoint_Attributes(t *testing.T) {
+	addr := endpoint.Endpoint{Addr: "localhost:50051", Weight: 3, Zone: "us-east-1a"}.Address()
+	if w := endpoint.Weight(addr); w != 3 {
+		t.Errorf("Weight = %d, want 3", w)
+	}
+	if z := endpoint.Zone(addr); z != "us-east-1a" {
+		t.Errorf("Zone = %q, want us-east-1a", z)
+	}
+	if w := endpoint.Weight(endpoint.Endpoint{Addr: "localhost:50052"}.Address()); w != endpoint.DefaultWeight {
+		t.Errorf("Weight = %d, want default %d", w, endpoint.DefaultWeight)
+	}
+	if w := endpoint.Weight(endpoint.Endpoint{Addr: "localhost:50052", Weight: 1000000}.Address()); w != endpoint.MaxWeight {
+		t.Errorf("Weight = %d, want the maximum %d", w, endpoint.MaxWeight)
+	}
+}
@@ -0,0 +1,125 @@
+// Package registryresolver implements a name resolver which watches the instances of a
+// service in the Registry service, and pushes a new state to the ClientConn every time
+// an instance registers, deregisters or misses its heartbeats.
+//
+// The service is dialed with "registry:///lb.example.grpc.io".
+package registryresolver
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/resolver"
+	"loadBalancing/endpoint"
+	pb "loadBalancing/registrypb"
+)
+
+// Scheme of the targets served by this resolver.
+const Scheme = "registry"
+
+const (
+	minBackoff = 100 * time.Millisecond
+	maxBackoff = 5 * time.Second
+)
+
+type builder struct {
+	registryAddr string
+}
+
+// NewBuilder returns a resolver.Builder watching the registry at registryAddr,
+// pass it to grpc.WithResolvers or resolver.Register.
+func NewBuilder(registryAddr string) resolver.Builder {
+	return &builder{registryAddr: registryAddr}
+}
+
+func (b *builder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	conn, err := grpc.Dial(b.registryAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	r := &registryResolver{
+		service: target.Endpoint(),
+		cc:      cc,
+		conn:    conn,
+		client:  pb.NewRegistryClient(conn),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+	r.wg.Add(1)
+	go r.watch()
+	return r, nil
+}
+
+func (b *builder) Scheme() string { return Scheme }
+
+type registryResolver struct {
+	service string
+	cc      resolver.ClientConn
+	conn    *grpc.ClientConn
+	client  pb.RegistryClient
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// watch streams the membership of the service, and opens the stream again
+// with a backoff when it breaks (e.g. the registry restarted).
+func (r *registryResolver) watch() {
+	defer r.wg.Done()
+	backoff := minBackoff
+	for {
+		err := r.watchOnce(func() { backoff = minBackoff })
+		if r.ctx.Err() != nil {
+			return
+		}
+		// keep the last known instances, the balancer keeps using them
+		log.Printf("[registry resolver] %s : watch failed, retrying in %v : %v", r.service, backoff, err)
+		r.cc.ReportError(err)
+		select {
+		case <-r.ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// watchOnce pushes every membership received on one Watch stream, until the stream breaks.
+func (r *registryResolver) watchOnce(received func()) error {
+	stream, err := r.client.Watch(r.ctx, &pb.WatchRequest{Service: r.service}, grpc.WaitForReady(true))
+	if err != nil {
+		return err
+	}
+	for {
+		m, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		received()
+		endpoints := make([]endpoint.Endpoint, len(m.Instances))
+		for i, inst := range m.Instances {
+			endpoints[i] = endpoint.Endpoint{Addr: inst.Addr, Weight: inst.Weight, Zone: inst.Zone}
+		}
+		log.Printf("[registry resolver] %s : %v", r.service, endpoints)
+		// Instances missing from the new state are removed by the balancer,
+		// RPCs already running on them finish.
+		r.cc.UpdateState(resolver.State{Addresses: endpoint.Addresses(endpoints)})
+	}
+}
+
+// ResolveNow does nothing, the registry pushes every change on the Watch stream.
+func (*registryResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *registryResolver) Close() {
+	r.cancel()
+	r.wg.Wait()
+	r.conn.Close()
+}
@@ -0,0 +1,130 @@
+package registryresolver
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	pb "loadBalancing/registrypb"
+)
+
+const serviceName = "lb.example.grpc.io"
+
+type ecServer struct {
+	ecpb.UnimplementedEchoServer
+	addr string
+}
+
+func (s *ecServer) UnaryEcho(ctx context.Context, req *ecpb.EchoRequest) (*ecpb.EchoResponse, error) {
+	return &ecpb.EchoResponse{Message: s.addr}, nil
+}
+
+// fakeRegistry sends the memberships written to updates on every Watch stream.
+type fakeRegistry struct {
+	pb.UnimplementedRegistryServer
+	updates chan *pb.Membership
+}
+
+func (r *fakeRegistry) Watch(req *pb.WatchRequest, stream pb.Registry_WatchServer) error {
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case m := <-r.updates:
+			if err := stream.Send(m); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+func listen(t *testing.T) net.Listener {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	return lis
+}
+
+func startBackend(t *testing.T) string {
+	lis := listen(t)
+	s := grpc.NewServer()
+	ecpb.RegisterEchoServer(s, &ecServer{addr: lis.Addr().String()})
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	return lis.Addr().String()
+}
+
+func membership(addrs ...string) *pb.Membership {
+	m := &pb.Membership{}
+	for _, addr := range addrs {
+		m.Instances = append(m.Instances, &pb.Instance{Service: serviceName, Addr: addr, Weight: 1})
+	}
+	return m
+}
+
+// waitForBackends calls until exactly the want backends answer.
+func waitForBackends(t *testing.T, c ecpb.EchoClient, want ...string) {
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		hits := make(map[string]int)
+		for i := 0; i < 10; i++ {
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+			r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{Message: "hello"}, grpc.WaitForReady(true))
+			cancel()
+			if err != nil {
+				t.Fatalf("UnaryEcho failed: %v", err)
+			}
+			hits[r.Message]++
+		}
+		match := len(hits) == len(want)
+		for _, addr := range want {
+			match = match && hits[addr] > 0
+		}
+		if match {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("backends hit = %v, want %v", hits, want)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestRegistryResolver_FollowsMembership(t *testing.T) {
+	b1, b2 := startBackend(t), startBackend(t)
+
+	registry := &fakeRegistry{updates: make(chan *pb.Membership)}
+	lis := listen(t)
+	s := grpc.NewServer()
+	pb.RegisterRegistryServer(s, registry)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial(fmt.Sprintf("%s:///%s", Scheme, serviceName),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(NewBuilder(lis.Addr().String())),
+		grpc.WithDefaultServiceConfig(`{"loadBalancingPolicy":"round_robin"}`),
+	)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	c := ecpb.NewEchoClient(conn)
+
+	registry.updates <- membership(b1)
+	waitForBackends(t, c, b1)
+
+	// b2 registers
+	registry.updates <- membership(b1, b2)
+	waitForBackends(t, c, b1, b2)
+
+	// b1 deregisters or misses its heartbeats
+	registry.updates <- membership(b2)
+	waitForBackends(t, c, b2)
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+)
+
+// runStreams opens n bidirectional streams, sends a message on each of them every
+// -stream-interval and reports how the streams are spread over the backends.
+//
+// The backend of a stream is picked once, when it opens. A stream cut by a backend
+// restart is reopened on the backend picked by the policy, but the streams which were
+// not cut stay where they are: a restarted backend gets no stream back until the others
+// end, unless -stream-max-age recycles them.
+func runStreams(cc *grpc.ClientConn, n int) {
+	c := ecpb.NewEchoClient(cc)
+	t := newStreamTracker()
+	for id := 0; id < n; id++ {
+		go t.run(context.Background(), c, id)
+		// spread the openings over an interval, rather than racing the connections
+		// to the backends and landing on the first one ready
+		time.Sleep(*streamInterval / time.Duration(n))
+	}
+	ticker := time.NewTicker(*reportInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		log.Println(t.report())
+	}
+}
+
+// streamTracker records the backend serving each stream.
+type streamTracker struct {
+	mu      sync.Mutex
+	current map[int]string // backend of the open streams
+	last    map[int]string // last backend of every stream, to tell when it moved
+	opened  int            // streams reopened after the first one
+	moved   int            // reopened streams which landed on another backend
+}
+
+func newStreamTracker() *streamTracker {
+	return &streamTracker{current: make(map[int]string), last: make(map[int]string)}
+}
+
+// run keeps the stream id open until ctx is done, reopening it when it ends.
+func (t *streamTracker) run(ctx context.Context, c ecpb.EchoClient, id int) {
+	for i := 0; ctx.Err() == nil; i++ {
+		if i > 0 {
+			t.mu.Lock()
+			t.opened++
+			t.mu.Unlock()
+		}
+		err := t.stream(ctx, c, id)
+		t.mu.Lock()
+		delete(t.current, id)
+		t.mu.Unlock()
+		log.Printf("stream %d ended: %v", id, err)
+		time.Sleep(*streamInterval)
+	}
+}
+
+// stream sends messages on a new stream until it fails, reaches -stream-max-age or ctx
+// is done.
+func (t *streamTracker) stream(ctx context.Context, c ecpb.EchoClient, id int) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if *streamMaxAge > 0 {
+		var cancelAge context.CancelFunc
+		ctx, cancelAge = context.WithTimeout(ctx, *streamMaxAge)
+		defer cancelAge()
+	}
+	stream, err := c.BidirectionalStreamingEcho(ctx, grpc.WaitForReady(true))
+	if err != nil {
+		return err
+	}
+	for i := 0; ; i++ {
+		if err := stream.Send(&ecpb.EchoRequest{Message: fmt.Sprintf("stream %d message %d", id, i)}); err != nil {
+			// Send only returns io.EOF, the status of the stream comes with Recv
+			_, err = stream.Recv()
+			return err
+		}
+		r, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		t.served(id, servedBy(r.Message))
+		time.Sleep(*streamInterval)
+	}
+}
+
+func (t *streamTracker) served(id int, backend string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if last := t.last[id]; last != backend {
+		if last != "" {
+			t.moved++
+			log.Printf("stream %d moved from %s to %s", id, last, backend)
+		}
+		t.last[id] = backend
+	}
+	t.current[id] = backend
+}
+
+// report returns the number of streams per backend, e.g.
+// "streams per backend: :50051=6 :50052=4, reopened 3, moved 3".
+func (t *streamTracker) report() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	perBackend := make(map[string]int)
+	for _, backend := range t.current {
+		perBackend[backend]++
+	}
+	backends := make([]string, 0, len(perBackend))
+	for backend, n := range perBackend {
+		backends = append(backends, fmt.Sprintf("%s=%d", backend, n))
+	}
+	sort.Strings(backends)
+	if len(backends) == 0 {
+		backends = append(backends, "none")
+	}
+	return fmt.Sprintf("streams per backend: %s, reopened %d, moved %d", strings.Join(backends, " "), t.opened, t.moved)
+}
+
+// servedBy returns the backend which answered msg, the server ends its messages
+// with "(from <addr>)", unknown for another message.
+func servedBy(msg string) string {
+	i := strings.LastIndex(msg, "(from ")
+	if i < 0 || !strings.HasSuffix(msg, ")") {
+		return "unknown"
+	}
+	addr := msg[i+len("(from ") : len(msg)-1]
+	if addr == "" || strings.ContainsAny(addr, " ()") {
+		return "unknown"
+	}
+	return addr
+}
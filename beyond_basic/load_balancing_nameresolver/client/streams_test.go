@@ -0,0 +1,263 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/manual"
+)
+
+type ecServer struct {
+	ecpb.UnimplementedEchoServer
+	addr string
+}
+
+func (s *ecServer) UnaryEcho(ctx context.Context, req *ecpb.EchoRequest) (*ecpb.EchoResponse, error) {
+	return &ecpb.EchoResponse{Message: fmt.Sprintf("%s (from %s)", req.Message, s.addr)}, nil
+}
+
+func (s *ecServer) BidirectionalStreamingEcho(stream ecpb.Echo_BidirectionalStreamingEchoServer) error {
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := stream.Send(&ecpb.EchoResponse{Message: fmt.Sprintf("%s (from %s)", req.Message, s.addr)}); err != nil {
+			return err
+		}
+	}
+}
+
+// startBackends starts n echo backends answering like the server example, and returns
+// their servers by address.
+func startBackends(t *testing.T, n int) map[string]*grpc.Server {
+	servers := make(map[string]*grpc.Server)
+	for i := 0; i < n; i++ {
+		lis, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("failed to listen: %v", err)
+		}
+		s := grpc.NewServer()
+		ecpb.RegisterEchoServer(s, &ecServer{addr: lis.Addr().String()})
+		go s.Serve(lis)
+		t.Cleanup(s.Stop)
+		servers[lis.Addr().String()] = s
+	}
+	return servers
+}
+
+// dial connects to addrs with policy through a manual resolver, once ready answered
+// from ready backends.
+func dial(t *testing.T, policy string, addrs []string, ready int) ecpb.EchoClient {
+	var state resolver.State
+	for _, addr := range addrs {
+		state.Addresses = append(state.Addresses, resolver.Address{Addr: addr})
+	}
+	r := manual.NewBuilderWithScheme("test")
+	r.InitialState(state)
+	conn, err := grpc.Dial(r.Scheme()+":///lb.example.grpc.io",
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithResolvers(r),
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, policy)),
+	)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	c := ecpb.NewEchoClient(conn)
+
+	seen := make(map[string]bool)
+	deadline := time.Now().Add(5 * time.Second)
+	for len(seen) < ready {
+		if time.Now().After(deadline) {
+			t.Fatalf("only %d of %d backends answered", len(seen), ready)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		r, err := c.UnaryEcho(ctx, &ecpb.EchoRequest{}, grpc.WaitForReady(true))
+		cancel()
+		if err != nil {
+			t.Fatalf("UnaryEcho failed: %v", err)
+		}
+		seen[servedBy(r.Message)] = true
+	}
+	return c
+}
+
+// testStreams runs the streams of a test, they end with ctx or when the test ends.
+type testStreams struct {
+	ctx context.Context
+	wg  sync.WaitGroup
+	tr  *streamTracker
+}
+
+func newStreams(t *testing.T) (*testStreams, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &testStreams{ctx: ctx, tr: newStreamTracker()}
+	t.Cleanup(func() {
+		cancel()
+		s.wg.Wait()
+	})
+	return s, cancel
+}
+
+// open opens the streams from..to-1 one after the other, each of them once the previous
+// one is served, so that the policy picks them in order.
+func (s *testStreams) open(t *testing.T, c ecpb.EchoClient, from, to int) {
+	tr := s.tr
+	for id := from; id < to; id++ {
+		s.wg.Add(1)
+		go func(id int) {
+			defer s.wg.Done()
+			tr.run(s.ctx, c, id)
+		}(id)
+		waitFor(t, func() bool {
+			tr.mu.Lock()
+			defer tr.mu.Unlock()
+			_, ok := tr.current[id]
+			return ok
+		})
+	}
+}
+
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out")
+		}
+		time.Sleep(*streamInterval)
+	}
+}
+
+// waitForReport waits until the report of tr is one of want.
+func waitForReport(t *testing.T, tr *streamTracker, want ...string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for got := tr.report(); !contains(want, got); got = tr.report() {
+		if time.Now().After(deadline) {
+			t.Fatalf("report() = %q, want one of %q", got, want)
+		}
+		time.Sleep(*streamInterval)
+	}
+}
+
+func contains(ss []string, s string) bool {
+	for _, v := range ss {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// report returns the report of the streams per backend of addrs.
+func report(addrs []string, perBackend []int, reopened, moved int) string {
+	var backends []string
+	for i, addr := range addrs {
+		if perBackend[i] > 0 {
+			backends = append(backends, fmt.Sprintf("%s=%d", addr, perBackend[i]))
+		}
+	}
+	sort.Strings(backends)
+	return fmt.Sprintf("streams per backend: %s, reopened %d, moved %d", strings.Join(backends, " "), reopened, moved)
+}
+
+func setStreamInterval(t *testing.T, d time.Duration) {
+	old := *streamInterval
+	*streamInterval = d
+	t.Cleanup(func() { *streamInterval = old })
+}
+
+// A stream stays on the backend picked when it opens, round_robin spreads the streams
+// evenly and they move when their backend stops.
+func TestStreams_RoundRobin(t *testing.T) {
+	setStreamInterval(t, 10*time.Millisecond)
+	servers := startBackends(t, 3)
+	var addrs []string
+	for addr := range servers {
+		addrs = append(addrs, addr)
+	}
+	sort.Strings(addrs)
+	c := dial(t, "round_robin", addrs, len(addrs))
+
+	s, cancel := newStreams(t)
+	tr := s.tr
+	s.open(t, c, 0, 6)
+	// the streams keep exchanging messages on their backend
+	time.Sleep(20 * *streamInterval)
+	if got, want := tr.report(), report(addrs, []int{2, 2, 2}, 0, 0); got != want {
+		t.Errorf("report() = %q, want %q", got, want)
+	}
+
+	s.open(t, c, 6, 9)
+	if got, want := tr.report(), report(addrs, []int{3, 3, 3}, 0, 0); got != want {
+		t.Errorf("report() = %q, want %q", got, want)
+	}
+
+	// the streams of the stopped backend reopen on the others, round_robin starts
+	// anywhere in the backends left
+	servers[addrs[0]].Stop()
+	waitForReport(t, tr, report(addrs, []int{0, 5, 4}, 3, 3), report(addrs, []int{0, 4, 5}, 3, 3))
+
+	cancel()
+	waitForReport(t, tr, "streams per backend: none, reopened 3, moved 3")
+}
+
+func TestStreams_PickFirst(t *testing.T) {
+	setStreamInterval(t, 10*time.Millisecond)
+	servers := startBackends(t, 3)
+	var addrs []string
+	for addr := range servers {
+		addrs = append(addrs, addr)
+	}
+	c := dial(t, "pick_first", addrs, 1)
+
+	s, _ := newStreams(t)
+	tr := s.tr
+	s.open(t, c, 0, 6)
+	time.Sleep(20 * *streamInterval)
+	// pick_first connects to the first address
+	if got, want := tr.report(), report(addrs, []int{6, 0, 0}, 0, 0); got != want {
+		t.Errorf("report() = %q, want %q", got, want)
+	}
+}
+
+func TestServedBy(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want string
+	}{
+		{"stream 1 message 2 (from 127.0.0.1:50051)", "127.0.0.1:50051"},
+		{"(from :50052)", ":50052"},
+		// the last one is the backend's
+		{"hello (from a) (from :50052)", ":50052"},
+		{"", "unknown"},
+		{"stream 1 message 2", "unknown"},
+		{"stream 1 message 2 (from :50051", "unknown"},
+		{"stream 1 message 2 from :50051)", "unknown"},
+		{"stream 1 (from :50051) message 2", "unknown"},
+		{"stream 1 message 2 (from )", "unknown"},
+		{"stream 1 message 2 (from a b)", "unknown"},
+		{"(from (from :50051))", "unknown"},
+	}
+	for _, tt := range tests {
+		if got := servedBy(tt.msg); got != tt.want {
+			t.Errorf("servedBy(%q) = %q, want %q", tt.msg, got, tt.want)
+		}
+	}
+}
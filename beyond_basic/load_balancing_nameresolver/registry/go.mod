@@ -0,0 +1,22 @@
+module registry
+
+go 1.20
+
+require (
+	admin v0.0.0-00010101000000-000000000000
+	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4
+	google.golang.org/grpc v1.55.0
+	google.golang.org/protobuf v1.30.0
+	rpcerrors v0.0.0-00010101000000-000000000000
+)
+
+require (
+	github.com/golang/protobuf v1.5.3 // indirect
+	golang.org/x/net v0.8.0 // indirect
+	golang.org/x/sys v0.6.0 // indirect
+	golang.org/x/text v0.8.0 // indirect
+)
+
+replace admin => ../../../grpc_in_production/admin
+
+replace rpcerrors => ../../../grpc_in_production/rpcerrors
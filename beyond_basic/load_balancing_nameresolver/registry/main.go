@@ -0,0 +1,238 @@
+package main
+
+import (
+	"admin"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"sync"
+	"time"
+
+	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/emptypb"
+	pb "registry/registrypb"
+	"rpcerrors"
+)
+
+const (
+	defaultTTL    = 10 * time.Second
+	minTTL        = 100 * time.Millisecond
+	sweepInterval = time.Second
+	// maxWeight is the highest weight of an instance, endpoint.MaxWeight of the client.
+	maxWeight = 1000
+)
+
+var (
+	port      = flag.String("port", ":50050", "port the registry listens on")
+	adminAddr = flag.String("admin", "", "address of the channelz page, e.g. :8082, the channelz service is registered too; off if empty")
+)
+
+type lease struct {
+	id       string
+	ttl      time.Duration
+	expires  time.Time
+	instance *pb.Instance
+}
+
+type registryServer struct {
+	pb.UnimplementedRegistryServer
+	sync.Mutex
+	// lease id -> lease
+	leases map[string]*lease
+	// service name -> channels of the watchers of the service
+	watchers map[string]map[chan struct{}]bool
+	now      func() time.Time
+}
+
+func newRegistryServer() *registryServer {
+	return &registryServer{
+		leases:   make(map[string]*lease),
+		watchers: make(map[string]map[chan struct{}]bool),
+		now:      time.Now,
+	}
+}
+
+func (s *registryServer) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.Lease, error) {
+	inst := req.GetInstance()
+	var violations []*epb.BadRequest_FieldViolation
+	if inst.GetService() == "" {
+		violations = append(violations, rpcerrors.FieldViolation("instance.service", "the service of the instance is required"))
+	}
+	if inst.GetAddr() == "" {
+		violations = append(violations, rpcerrors.FieldViolation("instance.addr", "the address of the instance is required"))
+	}
+	if inst.GetWeight() > maxWeight {
+		violations = append(violations, rpcerrors.FieldViolation("instance.weight", fmt.Sprintf("the weight of the instance must be at most %d", maxWeight)))
+	}
+	if len(violations) > 0 {
+		return nil, rpcerrors.InvalidArgument("invalid instance", violations...)
+	}
+	ttl := req.GetTtl().AsDuration()
+	if req.GetTtl() == nil || ttl <= 0 {
+		ttl = defaultTTL
+	}
+	if ttl < minTTL {
+		ttl = minTTL
+	}
+	id, err := newLeaseID()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "creating lease : %v", err)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	// A backend restarted before its lease expired replaces its old lease.
+	for oldID, l := range s.leases {
+		if l.instance.Service == inst.Service && l.instance.Addr == inst.Addr {
+			delete(s.leases, oldID)
+		}
+	}
+	s.leases[id] = &lease{id: id, ttl: ttl, expires: s.now().Add(ttl), instance: proto.Clone(inst).(*pb.Instance)}
+	log.Printf("%s : %s registered, ttl %v", inst.Service, inst.Addr, ttl)
+	s.notify(inst.Service)
+	return &pb.Lease{Id: id, Ttl: durationpb.New(ttl)}, nil
+}
+
+func (s *registryServer) Heartbeat(ctx context.Context, req *pb.Lease) (*emptypb.Empty, error) {
+	s.Lock()
+	defer s.Unlock()
+	l, ok := s.leases[req.GetId()]
+	if !ok {
+		// the lease expired, or the registry restarted: the backend registers again
+		return nil, rpcerrors.NotFound("Lease", req.GetId())
+	}
+	l.expires = s.now().Add(l.ttl)
+	return &emptypb.Empty{}, nil
+}
+
+func (s *registryServer) Deregister(ctx context.Context, req *pb.Lease) (*emptypb.Empty, error) {
+	s.Lock()
+	defer s.Unlock()
+	// deregistering an expired lease is not an error, the instance is gone either way
+	if l, ok := s.leases[req.GetId()]; ok {
+		delete(s.leases, l.id)
+		log.Printf("%s : %s deregistered", l.instance.Service, l.instance.Addr)
+		s.notify(l.instance.Service)
+	}
+	return &emptypb.Empty{}, nil
+}
+
+func (s *registryServer) Watch(req *pb.WatchRequest, stream pb.Registry_WatchServer) error {
+	if req.GetService() == "" {
+		return rpcerrors.InvalidArgument("service is required", rpcerrors.FieldViolation("service", "the service to watch is required"))
+	}
+	changed := make(chan struct{}, 1)
+	s.Lock()
+	if s.watchers[req.Service] == nil {
+		s.watchers[req.Service] = make(map[chan struct{}]bool)
+	}
+	s.watchers[req.Service][changed] = true
+	s.Unlock()
+	defer func() {
+		s.Lock()
+		delete(s.watchers[req.Service], changed)
+		s.Unlock()
+	}()
+
+	for {
+		if err := stream.Send(s.membership(req.Service)); err != nil {
+			return err
+		}
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-changed:
+		}
+	}
+}
+
+// membership returns the instances of service sorted by address.
+func (s *registryServer) membership(service string) *pb.Membership {
+	s.Lock()
+	defer s.Unlock()
+	m := &pb.Membership{}
+	for _, l := range s.leases {
+		if l.instance.Service == service {
+			m.Instances = append(m.Instances, l.instance)
+		}
+	}
+	sort.Slice(m.Instances, func(i, j int) bool { return m.Instances[i].Addr < m.Instances[j].Addr })
+	return m
+}
+
+// notify wakes up the watchers of service, s must be locked.
+func (s *registryServer) notify(service string) {
+	for changed := range s.watchers[service] {
+		select {
+		case changed <- struct{}{}:
+		default:
+			// the watcher has a pending change already
+		}
+	}
+}
+
+// expire removes the instances whose lease has not been renewed in time.
+func (s *registryServer) expire() {
+	s.Lock()
+	defer s.Unlock()
+	now := s.now()
+	for id, l := range s.leases {
+		if now.After(l.expires) {
+			delete(s.leases, id)
+			log.Printf("%s : %s expired, no heartbeat for %v", l.instance.Service, l.instance.Addr, l.ttl)
+			s.notify(l.instance.Service)
+		}
+	}
+}
+
+func (s *registryServer) sweep(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			s.expire()
+		}
+	}
+}
+
+func newLeaseID() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func main() {
+	flag.Parse()
+	lis, err := net.Listen("tcp", *port)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	rs := newRegistryServer()
+	go rs.sweep(context.Background(), sweepInterval)
+
+	s := grpc.NewServer()
+	pb.RegisterRegistryServer(s, rs)
+	if *adminAddr != "" {
+		admin.Register(s)
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
+	log.Printf("registry serving on %s\n", *port)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	pb "registry/registrypb"
+	"rpcerrors"
+)
+
+func newClient(t *testing.T, rs *registryServer) pb.RegistryClient {
+	lis := bufconn.Listen(1024 * 1024)
+	s := grpc.NewServer()
+	pb.RegisterRegistryServer(s, rs)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return pb.NewRegistryClient(conn)
+}
+
+func recvAddrs(t *testing.T, stream pb.Registry_WatchClient) []string {
+	m, err := stream.Recv()
+	if err != nil {
+		t.Fatalf("watch Recv failed: %v", err)
+	}
+	var addrs []string
+	for _, inst := range m.Instances {
+		addrs = append(addrs, inst.Addr)
+	}
+	return addrs
+}
+
+func register(t *testing.T, c pb.RegistryClient, addr string, ttl time.Duration) *pb.Lease {
+	l, err := c.Register(context.Background(), &pb.RegisterRequest{
+		Instance: &pb.Instance{Service: "lb.example.grpc.io", Addr: addr},
+		Ttl:      durationpb.New(ttl),
+	})
+	if err != nil {
+		t.Fatalf("Register %s failed: %v", addr, err)
+	}
+	return l
+}
+
+func TestRegistry_WatchMembership(t *testing.T) {
+	c := newClient(t, newRegistryServer())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	stream, err := c.Watch(ctx, &pb.WatchRequest{Service: "lb.example.grpc.io"})
+	if err != nil {
+		t.Fatalf("Watch failed: %v", err)
+	}
+	if addrs := recvAddrs(t, stream); len(addrs) != 0 {
+		t.Fatalf("initial membership = %v, want empty", addrs)
+	}
+
+	l1 := register(t, c, "localhost:50051", time.Minute)
+	if addrs := recvAddrs(t, stream); len(addrs) != 1 || addrs[0] != "localhost:50051" {
+		t.Fatalf("membership = %v, want [localhost:50051]", addrs)
+	}
+	register(t, c, "localhost:50052", time.Minute)
+	if addrs := recvAddrs(t, stream); len(addrs) != 2 {
+		t.Fatalf("membership = %v, want both backends", addrs)
+	}
+
+	if _, err := c.Deregister(ctx, l1); err != nil {
+		t.Fatalf("Deregister failed: %v", err)
+	}
+	if addrs := recvAddrs(t, stream); len(addrs) != 1 || addrs[0] != "localhost:50052" {
+		t.Fatalf("membership = %v, want [localhost:50052]", addrs)
+	}
+}
+
+func TestRegistry_LeaseExpires(t *testing.T) {
+	now := time.Now()
+	rs := newRegistryServer()
+	rs.now = func() time.Time { return now }
+	c := newClient(t, rs)
+	ctx := context.Background()
+
+	kept := register(t, c, "localhost:50051", time.Second)
+	expired := register(t, c, "localhost:50052", time.Second)
+
+	// only the first backend keeps sending heartbeats
+	for i := 0; i < 3; i++ {
+		now = now.Add(600 * time.Millisecond)
+		if _, err := c.Heartbeat(ctx, kept); err != nil {
+			t.Fatalf("Heartbeat failed: %v", err)
+		}
+		rs.expire()
+	}
+
+	if addrs := rs.membership("lb.example.grpc.io").Instances; len(addrs) != 1 || addrs[0].Addr != "localhost:50051" {
+		t.Errorf("membership = %v, want [localhost:50051]", addrs)
+	}
+	_, err := c.Heartbeat(ctx, expired)
+	if status.Code(err) != codes.NotFound {
+		t.Errorf("Heartbeat on an expired lease = %v, want NotFound", err)
+	}
+}
+
+func TestRegistry_RegisterInvalid(t *testing.T) {
+	c := newClient(t, newRegistryServer())
+	for _, tt := range []struct {
+		inst  *pb.Instance
+		field string
+	}{
+		{&pb.Instance{Addr: "localhost:50051"}, "instance.service"},
+		{&pb.Instance{Service: "lb.example.grpc.io"}, "instance.addr"},
+		{&pb.Instance{Service: "lb.example.grpc.io", Addr: "localhost:50051", Weight: maxWeight + 1}, "instance.weight"},
+	} {
+		_, err := c.Register(context.Background(), &pb.RegisterRequest{Instance: tt.inst})
+		d := rpcerrors.Decode(err)
+		if d == nil || d.Code != codes.InvalidArgument || len(d.BadRequest.GetFieldViolations()) != 1 || d.BadRequest.FieldViolations[0].Field != tt.field {
+			t.Errorf("Register(%v) = %v, want InvalidArgument on %s", tt.inst, err, tt.field)
+		}
+	}
+	if _, err := c.Register(context.Background(), &pb.RegisterRequest{
+		Instance: &pb.Instance{Service: "lb.example.grpc.io", Addr: "localhost:50051", Weight: maxWeight},
+	}); err != nil {
+		t.Errorf("Register with the maximum weight failed: %v", err)
+	}
+}
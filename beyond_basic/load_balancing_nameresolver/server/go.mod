@@ -3,8 +3,11 @@ module loadBalancing
 go 1.20
 
 require (
+	admin v0.0.0-00010101000000-000000000000
 	google.golang.org/grpc v1.55.0
 	google.golang.org/grpc/examples v0.0.0-20230518182853-098b2d00c5bc
+	google.golang.org/protobuf v1.30.0
+	rpcerrors v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -13,5 +16,8 @@ require (
 	golang.org/x/sys v0.7.0 // indirect
 	golang.org/x/text v0.9.0 // indirect
 	google.golang.org/genproto v0.0.0-20230410155749-daa745c078e1 // indirect
-	google.golang.org/protobuf v1.30.0 // indirect
 )
+
+replace admin => ../../../grpc_in_production/admin
+
+replace rpcerrors => ../../../grpc_in_production/rpcerrors
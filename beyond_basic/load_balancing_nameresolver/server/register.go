@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+	pb "loadBalancing/registrypb"
+)
+
+// register announces inst to the registry and keeps its lease alive with heartbeats
+// sent every third of the ttl. The returned function stops the heartbeats and
+// deregisters the instance, call it before stopping the server.
+func register(conn *grpc.ClientConn, inst *pb.Instance, ttl time.Duration) (deregister func()) {
+	c := pb.NewRegistryClient(conn)
+	ctx, cancel := context.WithCancel(context.Background())
+	// the heartbeat loop hands its lease over once it stops
+	leases := make(chan *pb.Lease, 1)
+
+	go func() {
+		var lease *pb.Lease
+		ticker := time.NewTicker(ttl / 3)
+		defer ticker.Stop()
+		for {
+			if lease == nil {
+				l, err := c.Register(ctx, &pb.RegisterRequest{Instance: inst, Ttl: durationpb.New(ttl)}, grpc.WaitForReady(true))
+				if err == nil {
+					lease = l
+					log.Printf("%s registered as %s", inst.Addr, inst.Service)
+				} else if ctx.Err() == nil {
+					log.Printf("failed to register %s : %v", inst.Addr, err)
+				}
+			} else if _, err := c.Heartbeat(ctx, lease); status.Code(err) == codes.NotFound {
+				// the registry lost the lease (expired or registry restarted), register again
+				log.Printf("lease of %s lost, registering again", inst.Addr)
+				lease = nil
+				continue
+			} else if err != nil && ctx.Err() == nil {
+				log.Printf("heartbeat of %s failed : %v", inst.Addr, err)
+			}
+			select {
+			case <-ctx.Done():
+				leases <- lease
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		lease := <-leases
+		if lease == nil {
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		if _, err := c.Deregister(ctx, lease); err != nil {
+			log.Printf("failed to deregister %s : %v", inst.Addr, err)
+			return
+		}
+		log.Printf("%s deregistered", inst.Addr)
+	}
+}
@@ -1,61 +1,212 @@
 package main
 
 import (
+	"admin"
 	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
+	"math/rand"
 	"net"
+	"os"
+	"os/signal"
+	"rpcerrors"
+	"strings"
 	"sync"
+	"syscall"
+	"time"
 
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
 	ecpb "google.golang.org/grpc/examples/features/proto/echo"
-	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	pb "loadBalancing/registrypb"
+)
+
+const (
+	serviceName     = "lb.example.grpc.io"
+	registrationTTL = 10 * time.Second
+	// streamingCount is the number of messages of ServerStreamingEcho.
+	streamingCount = 10
+	// shutdownGrace is how long the running RPCs have to finish once the server is stopping,
+	// the long-lived streams are then cut and their clients reopen them on another backend.
+	shutdownGrace = 5 * time.Second
+	// failingRetryDelay is the RetryInfo of the calls the faulty backend fails, how long
+	// the clients wait before retrying them.
+	failingRetryDelay = time.Second
 )
 
 var (
-	addrs = []string{":50051", ":50052"}
+	addrs = flag.String("addrs", ":50051,:50052", "comma separated addresses of the backends, run one backend per process to restart it alone")
+
+	registryAddr  = flag.String("registry", "", "address of the registry the backends register with, e.g. localhost:50050")
+	advertiseHost = flag.String("advertise-host", "localhost", "host the clients reach the backends on")
+	zones         = flag.String("zones", "", "comma separated zones of the backends registered with the registry, e.g. us-east-1a,us-east-1b")
+
+	// Make one backend misbehave to see the client health checks and outlier detection at work.
+	faultyAddr   = flag.String("faulty", "", "backend which fails or answers slowly, e.g. :50052")
+	errorRate    = flag.Float64("error-rate", 1, "share of the calls the faulty backend fails with UNAVAILABLE")
+	extraLatency = flag.Duration("latency", 0, "latency added to the calls of the faulty backend")
+	notServing   = flag.Bool("not-serving", false, "the faulty backend reports NOT_SERVING to the health checks")
+
+	// One page for all the backends of the process, and the channelz service on each of them.
+	adminAddr = flag.String("admin", "", "address of the channelz page, e.g. :8081, the channelz service is registered too; off if empty")
 )
 
 type ecServer struct {
 	ecpb.EchoServer
-	addr string
+	addr      string
+	errorRate float64
+	latency   time.Duration
 }
 
 func (s *ecServer) UnaryEcho(ctx context.Context, req *ecpb.EchoRequest) (*ecpb.EchoResponse, error) {
+	time.Sleep(s.latency)
+	if rand.Float64() < s.errorRate {
+		return nil, rpcerrors.Unavailable(s.addr+" is failing", failingRetryDelay)
+	}
 	return &ecpb.EchoResponse{Message: fmt.Sprintf("%s (from %s)", req.Message, s.addr)}, nil
 }
-func (s *ecServer) ServerStreamingEcho(*ecpb.EchoRequest, ecpb.Echo_ServerStreamingEchoServer) error {
-	return status.Errorf(codes.Unimplemented, "not implemented")
+
+// ServerStreamingEcho answers with streamingCount messages.
+func (s *ecServer) ServerStreamingEcho(req *ecpb.EchoRequest, stream ecpb.Echo_ServerStreamingEchoServer) error {
+	if rand.Float64() < s.errorRate {
+		return rpcerrors.Unavailable(s.addr+" is failing", failingRetryDelay)
+	}
+	for i := 0; i < streamingCount; i++ {
+		time.Sleep(s.latency)
+		if err := stream.Send(&ecpb.EchoResponse{Message: fmt.Sprintf("%s %d (from %s)", req.Message, i, s.addr)}); err != nil {
+			return err
+		}
+	}
+	return nil
 }
-func (s *ecServer) ClientStreamingEcho(ecpb.Echo_ClientStreamingEchoServer) error {
-	return status.Errorf(codes.Unimplemented, "not implemented")
+
+// ClientStreamingEcho answers with the number of messages received and the last one.
+func (s *ecServer) ClientStreamingEcho(stream ecpb.Echo_ClientStreamingEchoServer) error {
+	if rand.Float64() < s.errorRate {
+		return rpcerrors.Unavailable(s.addr+" is failing", failingRetryDelay)
+	}
+	var n int
+	var last string
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			time.Sleep(s.latency)
+			return stream.SendAndClose(&ecpb.EchoResponse{Message: fmt.Sprintf("%d messages, last %q (from %s)", n, last, s.addr)})
+		}
+		if err != nil {
+			return err
+		}
+		n++
+		last = req.Message
+	}
 }
-func (s *ecServer) BidirectionalStreamingEcho(ecpb.Echo_BidirectionalStreamingEchoServer) error {
-	return status.Errorf(codes.Unimplemented, "not implemented")
+
+// BidirectionalStreamingEcho answers every message until the client closes the stream.
+func (s *ecServer) BidirectionalStreamingEcho(stream ecpb.Echo_BidirectionalStreamingEchoServer) error {
+	if rand.Float64() < s.errorRate {
+		return rpcerrors.Unavailable(s.addr+" is failing", failingRetryDelay)
+	}
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		time.Sleep(s.latency)
+		if err := stream.Send(&ecpb.EchoResponse{Message: fmt.Sprintf("%s (from %s)", req.Message, s.addr)}); err != nil {
+			return err
+		}
+	}
 }
 
-func startServer(addr string) {
+func startServer(addr string, wg *sync.WaitGroup) *grpc.Server {
 	lis, err := net.Listen("tcp", addr)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	s := grpc.NewServer()
-	ecpb.RegisterEchoServer(s, &ecServer{addr: addr})
-	log.Printf("serving on %s\n", addr)
-	if err := s.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	ec := &ecServer{addr: addr}
+	// Register the health service, clients with a healthCheckConfig only use SERVING backends.
+	healthServer := health.NewServer()
+	if addr == *faultyAddr {
+		ec.errorRate, ec.latency = *errorRate, *extraLatency
+		if *notServing {
+			healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+		}
+		log.Printf("%s is faulty: error rate %v, latency %v, not serving %v", addr, ec.errorRate, ec.latency, *notServing)
 	}
+	ecpb.RegisterEchoServer(s, ec)
+	healthpb.RegisterHealthServer(s, healthServer)
+	if *adminAddr != "" {
+		admin.Register(s)
+	}
+	log.Printf("serving on %s\n", addr)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		if err := s.Serve(lis); err != nil {
+			log.Fatalf("failed to serve: %v", err)
+		}
+	}()
+	return s
 }
 
 func main() {
+	flag.Parse()
+	if *adminAddr != "" {
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
+
+	var registryConn *grpc.ClientConn
+	if *registryAddr != "" {
+		conn, err := grpc.Dial(*registryAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			log.Fatalf("did not connect to the registry: %v", err)
+		}
+		defer conn.Close()
+		registryConn = conn
+	}
+
 	var wg sync.WaitGroup
-	for _, addr := range addrs {
-		wg.Add(1)
-		go func(addr string) {
-			defer wg.Done()
-			startServer(addr)
-		}(addr)
+	var servers []*grpc.Server
+	var deregisters []func()
+	backendZones := strings.Split(*zones, ",")
+	for i, addr := range strings.Split(*addrs, ",") {
+		servers = append(servers, startServer(addr, &wg))
+		if registryConn != nil {
+			inst := &pb.Instance{Service: serviceName, Addr: *advertiseHost + addr}
+			if i < len(backendZones) {
+				inst.Zone = backendZones[i]
+			}
+			deregisters = append(deregisters, register(registryConn, inst, registrationTTL))
+		}
+	}
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	// Deregister first so that the clients stop sending new RPCs,
+	// then let the running RPCs finish, for shutdownGrace at most.
+	for _, deregister := range deregisters {
+		deregister()
+	}
+	var stopping sync.WaitGroup
+	for _, s := range servers {
+		s := s
+		stopping.Add(1)
+		go func() {
+			defer stopping.Done()
+			timer := time.AfterFunc(shutdownGrace, s.Stop)
+			defer timer.Stop()
+			s.GracefulStop()
+		}()
 	}
+	stopping.Wait()
 	wg.Wait()
 }
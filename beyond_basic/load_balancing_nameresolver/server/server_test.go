@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"rpcerrors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	ecpb "google.golang.org/grpc/examples/features/proto/echo"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+const addr = ":50051"
+
+// dial serves ec over an in-memory connection.
+func dial(t *testing.T, ec *ecServer) ecpb.EchoClient {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	ecpb.RegisterEchoServer(s, ec)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return ecpb.NewEchoClient(conn)
+}
+
+func TestStreamingEcho(t *testing.T) {
+	c := dial(t, &ecServer{addr: addr})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ss, err := c.ServerStreamingEcho(ctx, &ecpb.EchoRequest{Message: "hi"})
+	if err != nil {
+		t.Fatalf("ServerStreamingEcho failed: %v", err)
+	}
+	for i := 0; ; i++ {
+		r, err := ss.Recv()
+		if err == io.EOF {
+			if i != streamingCount {
+				t.Errorf("ServerStreamingEcho sent %d messages, want %d", i, streamingCount)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatalf("ServerStreamingEcho failed: %v", err)
+		}
+		if want := fmt.Sprintf("hi %d (from %s)", i, addr); r.Message != want {
+			t.Errorf("ServerStreamingEcho message %d = %q, want %q", i, r.Message, want)
+		}
+	}
+
+	cs, err := c.ClientStreamingEcho(ctx)
+	if err != nil {
+		t.Fatalf("ClientStreamingEcho failed: %v", err)
+	}
+	for _, msg := range []string{"a", "b", "c"} {
+		if err := cs.Send(&ecpb.EchoRequest{Message: msg}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+	}
+	r, err := cs.CloseAndRecv()
+	if err != nil {
+		t.Fatalf("ClientStreamingEcho failed: %v", err)
+	}
+	if want := `3 messages, last "c" (from :50051)`; r.Message != want {
+		t.Errorf("ClientStreamingEcho = %q, want %q", r.Message, want)
+	}
+
+	bs, err := c.BidirectionalStreamingEcho(ctx)
+	if err != nil {
+		t.Fatalf("BidirectionalStreamingEcho failed: %v", err)
+	}
+	for i := 0; i < 3; i++ {
+		msg := fmt.Sprintf("message %d", i)
+		if err := bs.Send(&ecpb.EchoRequest{Message: msg}); err != nil {
+			t.Fatalf("Send failed: %v", err)
+		}
+		r, err := bs.Recv()
+		if err != nil {
+			t.Fatalf("BidirectionalStreamingEcho failed: %v", err)
+		}
+		if want := msg + " (from :50051)"; r.Message != want {
+			t.Errorf("BidirectionalStreamingEcho = %q, want %q", r.Message, want)
+		}
+	}
+	bs.CloseSend()
+	if _, err := bs.Recv(); err != io.EOF {
+		t.Errorf("BidirectionalStreamingEcho ended with %v, want io.EOF", err)
+	}
+}
+
+// The faulty backend fails the streams with UNAVAILABLE and the delay before a retry.
+func TestStreamingEcho_Failing(t *testing.T) {
+	c := dial(t, &ecServer{addr: addr, errorRate: 1})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	calls := map[string]func() error{
+		"ServerStreamingEcho": func() error {
+			s, err := c.ServerStreamingEcho(ctx, &ecpb.EchoRequest{Message: "hi"})
+			if err != nil {
+				return err
+			}
+			_, err = s.Recv()
+			return err
+		},
+		"ClientStreamingEcho": func() error {
+			s, err := c.ClientStreamingEcho(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = s.CloseAndRecv()
+			return err
+		},
+		"BidirectionalStreamingEcho": func() error {
+			s, err := c.BidirectionalStreamingEcho(ctx)
+			if err != nil {
+				return err
+			}
+			_, err = s.Recv()
+			return err
+		},
+	}
+	for name, call := range calls {
+		err := call()
+		if d := rpcerrors.Decode(err); d == nil || d.Code != codes.Unavailable || d.Retry.GetRetryDelay().AsDuration() != failingRetryDelay {
+			t.Errorf("%s failed with %v, want UNAVAILABLE with a retry delay of %v", name, err, failingRetryDelay)
+		}
+	}
+}
@@ -2,30 +2,59 @@ package main
 
 import (
 	pb "OrderManagement/ecommerce"
+	"admin"
 	"context"
+	"cost"
+	"envelope"
+	"flag"
 	"fmt"
-	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"grpc_prod/tracer"
 	"io"
 	"log"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"rpcerrors"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
 	_ "google.golang.org/grpc/encoding/gzip" // importing just to make server eligible to accept compressed data
 	"google.golang.org/grpc/metadata"
-	"google.golang.org/grpc/status"
 )
 
 const (
 	port           = ":8000"
 	orderBatchSize = 3
+	// keysFile is the keyring sealing the sensitive fields of the orders, shared with
+	// the clients. Create or rotate it with envelope/cmd/keygen.
+	keysFile = "../keys.json"
+)
+
+var (
+	exporter     = flag.String("exporter", tracer.ExporterNone, "where the spans go: otlp, stdout or none")
+	otlpEndpoint = flag.String("otlp-endpoint", tracer.DefaultOTLPEndpoint, "host:port of the OpenTelemetry collector")
+	adminAddr    = flag.String("admin", "", "address of the channelz page, e.g. :8081, the channelz service is registered too; off if empty")
+	metricsAddr  = flag.String("metrics", "", "address of the cost metrics, e.g. :9092, served at /metrics; off if empty")
 )
 
 var orderMap = make(map[string]pb.Order)
 
+// spans of the handlers, the children of the span of the stats handler
+var tr = otel.Tracer("OrderManagement/server")
+
+// orderIDKey is the attribute of the order of a span or of an event.
+const orderIDKey = attribute.Key("order.id")
+
 type server struct {
 	pb.UnimplementedOrderManagementServer
 }
@@ -37,24 +66,9 @@ func (s *server) AddOrder(ctx context.Context, orderReq *pb.Order) (*wrappers.St
 	if orderReq.Id == "-1" {
 		log.Printf("Order ID is invalid! -> Received Order ID %s", orderReq.Id)
 
-		errorStatus := status.New(codes.InvalidArgument, "Invalid information received")
-
-		// Include any error details with an error type BadRequest_FieldViolation from
-		// google.golang.org/genproto/googleapis/rpc/errdetails.
-		ds, err := errorStatus.WithDetails(
-			&epb.BadRequest_FieldViolation{
-				Field:       "ID",
-				Description: fmt.Sprintf("Order ID received is not valid %s : %s", orderReq.Id, orderReq.Description),
-			},
-		)
-		// If there is some error generating the more details error response then return
-		// the error response generated with status.New
-		if err != nil {
-			return nil, errorStatus.Err()
-		}
-		// return the error with details
-		return nil, ds.Err()
-
+		// The BadRequest details of the error tell the client which field is invalid.
+		return nil, rpcerrors.InvalidArgument("Invalid information received",
+			rpcerrors.FieldViolation("id", fmt.Sprintf("Order ID received is not valid %s : %s", orderReq.Id, orderReq.Description)))
 	} else {
 		orderMap[orderReq.Id] = *orderReq
 		log.Println("Order : ", orderReq.Id, " -> Added")
@@ -66,13 +80,14 @@ func (s *server) AddOrder(ctx context.Context, orderReq *pb.Order) (*wrappers.St
 func (s *server) GetOrder(ctx context.Context, orderId *wrappers.StringValue) (*pb.Order, error) {
 	ord, found := orderMap[orderId.Value]
 	if !found {
-		return nil, status.Errorf(codes.NotFound, "Product does not exists : %s", orderId.Value)
+		return nil, rpcerrors.NotFound("Order", orderId.Value)
 	}
 	return &ord, nil
 }
 
 // server streaming
 func (s *server) SearchOrders(searchQuery *wrappers.StringValue, stream pb.OrderManagement_SearchOrdersServer) error {
+	span := trace.SpanFromContext(stream.Context())
 	for _, order := range orderMap {
 		for _, itemStr := range order.Items {
 			if strings.Contains(itemStr, searchQuery.Value) {
@@ -80,6 +95,9 @@ func (s *server) SearchOrders(searchQuery *wrappers.StringValue, stream pb.Order
 				if err != nil {
 					return fmt.Errorf("error sending message to stream : %v", err)
 				}
+				// the order of the message event of the same id
+				span.AddEvent("order found", trace.WithAttributes(
+					orderIDKey.String(order.Id), attribute.Int64("message.id", tracer.Sent(stream.Context()))))
 				break
 			}
 		}
@@ -100,6 +118,7 @@ func (s *server) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) erro
 	trailer := metadata.Pairs("trailer-key", "trailer-val")
 	stream.SetTrailer(trailer)
 
+	span := trace.SpanFromContext(stream.Context())
 	ordersStr := "Updated Order IDs : "
 	for {
 		// Read message from the client stream.
@@ -112,6 +131,8 @@ func (s *server) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) erro
 		}
 		// Update order
 		orderMap[order.Id] = *order
+		span.AddEvent("order updated", trace.WithAttributes(
+			orderIDKey.String(order.Id), attribute.Int64("message.id", tracer.Received(stream.Context()))))
 
 		log.Printf("Order ID ", order.Id, ": Updated")
 		ordersStr += order.Id + ", "
@@ -119,18 +140,21 @@ func (s *server) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) erro
 }
 
 func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) error {
+	ctx := stream.Context()
 	// Business Logic Here
 	for {
 		batchMarker := 1
 		combinedShipmentMap := make(map[string]pb.CombinedShipment)
+		// links to the messages of the client which ordered each shipment
+		shipmentLinks := make(map[string][]trace.Link)
 		for {
 			orderId, err := stream.Recv()
 			log.Printf("Reading Proc order : %s", orderId)
 			if err == io.EOF {
 				// Client has sent all the messages Send remaining shipments
 				log.Printf("EOF : %s", orderId)
-				for _, shipment := range combinedShipmentMap {
-					if err := stream.Send(&shipment); err != nil {
+				for destination, shipment := range combinedShipmentMap {
+					if err := sendShipment(ctx, stream, &shipment, shipmentLinks[destination]); err != nil {
 						return err
 					}
 				}
@@ -145,6 +169,7 @@ func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) er
 			destination := orderMap[orderId.GetValue()].Destination
 			// get the shipment
 			shipment, found := combinedShipmentMap[destination]
+			shipmentLinks[destination] = append(shipmentLinks[destination], tracer.SenderLink(ctx, tracer.Received(ctx)))
 
 			if found {
 				ord := orderMap[orderId.GetValue()]
@@ -159,14 +184,15 @@ func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) er
 			}
 
 			if batchMarker == orderBatchSize {
-				for _, comb := range combinedShipmentMap {
+				for destination, comb := range combinedShipmentMap {
 					log.Printf("Shipping : %v -> %v", comb.Id, len(comb.OrdersList))
-					if err := stream.Send(&comb); err != nil {
+					if err := sendShipment(ctx, stream, &comb, shipmentLinks[destination]); err != nil {
 						return err
 					}
 				}
 				batchMarker = 0
 				combinedShipmentMap = make(map[string]pb.CombinedShipment)
+				shipmentLinks = make(map[string][]trace.Link)
 			} else {
 				batchMarker++
 			}
@@ -174,6 +200,19 @@ func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) er
 	}
 }
 
+// sendShipment sends a combined shipment in a span of its own, a child of the span of the
+// stream, linked to the messages of the client which ordered its orders.
+func sendShipment(ctx context.Context, stream pb.OrderManagement_ProcessOrdersServer, shipment *pb.CombinedShipment, links []trace.Link) error {
+	_, span := tr.Start(ctx, "ecommerce.server.ProcessOrders.shipment", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.String("shipment.id", shipment.Id), attribute.Int("shipment.orders", len(shipment.OrdersList))))
+	defer span.End()
+	if err := stream.Send(shipment); err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
 // Server - Unary Interceptor
 func orderUnaryServerInterceptor(ctx context.Context, req interface{},
 	info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -233,18 +272,66 @@ func orderStreamServerInterceptor(srv interface{}, ss grpc.ServerStream,
 }
 
 func main() {
+	flag.Parse()
 	initSampleData()
 
+	tp, err := tracer.Init(context.Background(), tracer.Config{
+		ServiceName:  "ecommerce.OrderManagement.server",
+		Exporter:     *exporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: true,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer tp.Shutdown(context.Background())
+
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
+	// The codec decrypts the price and the destination of the orders received, and
+	// encrypts them in the orders sent: the handlers only see the plain orders.
+	codec, err := envelope.NewCodec(keysFile, envelope.DefaultReloadInterval)
+	if err != nil {
+		log.Fatalf("failed to load the keyring: %v", err)
+	}
+	defer codec.Close()
+
+	// the cost of the calls by method and caller, the sizes of their messages on the
+	// wire and uncompressed, and their CPU time
+	costs := cost.NewHandler(cost.DefaultMaxCallers)
+
 	// Registering the Interceptor at the server-side.
 	s := grpc.NewServer(
-		grpc.UnaryInterceptor(orderUnaryServerInterceptor),
-		grpc.StreamInterceptor(orderStreamServerInterceptor),
+		grpc.ForceServerCodec(codec),
+		// a span for every call, with an event for every message of the streams
+		grpc.StatsHandler(tracer.NewServerHandler()),
+		grpc.StatsHandler(costs),
+		// the messages of the errors in the languages of the accept-language metadata
+		grpc.ChainUnaryInterceptor(orderUnaryServerInterceptor, rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer)),
+		grpc.ChainStreamInterceptor(orderStreamServerInterceptor, rpcerrors.StreamServerInterceptor(rpcerrors.DefaultLocalizer)),
 	)
 	pb.RegisterOrderManagementServer(s, &server{})
+	// the cost report on demand
+	costs.Register(s)
+	if *metricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(costs)
+		http.Handle("/metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+		go func() { log.Fatal(http.ListenAndServe(*metricsAddr, nil)) }()
+	}
+	if *adminAddr != "" {
+		admin.Register(s)
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
+	// stop on a signal, for the deferred calls to export the last spans
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		s.GracefulStop()
+	}()
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
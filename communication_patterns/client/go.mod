@@ -3,6 +3,7 @@ module OrderManagement
 go 1.20
 
 require (
+	admin v0.0.0-00010101000000-000000000000
 	github.com/golang/protobuf v1.5.3
 	google.golang.org/grpc v1.55.0
 	google.golang.org/protobuf v1.30.0
@@ -14,3 +15,5 @@ require (
 	golang.org/x/text v0.8.0 // indirect
 	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
 )
+
+replace admin => ../../grpc_in_production/admin
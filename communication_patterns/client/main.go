@@ -2,7 +2,9 @@ package main
 
 import (
 	pb "OrderManagement/ecommerce"
+	"admin"
 	"context"
+	"flag"
 	wrappers "github.com/golang/protobuf/ptypes/wrappers"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials/insecure"
@@ -15,7 +17,10 @@ const (
 	address = "localhost:8000"
 )
 
+var adminAddr = flag.String("admin", "", "address of the channelz page with the channel of the client, e.g. :8083, served until interrupted; off if empty")
+
 func main() {
+	flag.Parse()
 	// Set up a connection with the server from the
 	// provided address ("localhost: 8000")
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -23,6 +28,10 @@ func main() {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
+	if *adminAddr != "" {
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+		defer admin.Linger(*adminAddr)
+	}
 	// Pass the connection and create a stub. This stub
 	// instance contains all the remote methods to invoke the server.
 	ordMgmtClient := pb.NewOrderManagementClient(conn)
@@ -2,17 +2,26 @@ package main
 
 import (
 	pb "OrderManagement/ecommerce"
+	"admin"
 	"context"
+	"flag"
 	"fmt"
+	"grpc_prod/tracer"
 	"io"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"rpcerrors"
 	"strings"
+	"syscall"
 
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
-	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/status"
 )
 
 const (
@@ -20,8 +29,20 @@ const (
 	orderBatchSize = 3
 )
 
+var (
+	adminAddr    = flag.String("admin", "", "address of the channelz page, e.g. :8081, the channelz service is registered too; off if empty")
+	exporter     = flag.String("exporter", tracer.ExporterNone, "where the spans go: otlp, stdout or none")
+	otlpEndpoint = flag.String("otlp-endpoint", tracer.DefaultOTLPEndpoint, "host:port of the OpenTelemetry collector")
+)
+
 var orderMap = make(map[string]pb.Order)
 
+// spans of the handlers, the children of the span of the stats handler
+var tr = otel.Tracer("OrderManagement/server")
+
+// orderIDKey is the attribute of the order of a span or of an event.
+const orderIDKey = attribute.Key("order.id")
+
 type server struct {
 	pb.UnimplementedOrderManagementServer
 }
@@ -30,13 +51,14 @@ type server struct {
 func (s *server) GetOrder(ctx context.Context, orderId *wrappers.StringValue) (*pb.Order, error) {
 	ord, found := orderMap[orderId.Value]
 	if !found {
-		return nil, status.Errorf(codes.NotFound, "Product does not exists : %s", orderId.Value)
+		return nil, rpcerrors.NotFound("Order", orderId.Value)
 	}
 	return &ord, nil
 }
 
 // server streaming
 func (s *server) SearchOrders(searchQuery *wrappers.StringValue, stream pb.OrderManagement_SearchOrdersServer) error {
+	span := trace.SpanFromContext(stream.Context())
 	for _, order := range orderMap {
 		for _, itemStr := range order.Items {
 			if strings.Contains(itemStr, searchQuery.Value) {
@@ -44,6 +66,9 @@ func (s *server) SearchOrders(searchQuery *wrappers.StringValue, stream pb.Order
 				if err != nil {
 					return fmt.Errorf("error sending message to stream : %v", err)
 				}
+				// the order of the message event of the same id
+				span.AddEvent("order found", trace.WithAttributes(
+					orderIDKey.String(order.Id), attribute.Int64("message.id", tracer.Sent(stream.Context()))))
 				break
 			}
 		}
@@ -52,6 +77,7 @@ func (s *server) SearchOrders(searchQuery *wrappers.StringValue, stream pb.Order
 }
 
 func (s *server) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) error {
+	span := trace.SpanFromContext(stream.Context())
 	ordersStr := "Updated Order IDs : "
 	for {
 		// Read message from the client stream.
@@ -64,6 +90,8 @@ func (s *server) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) erro
 		}
 		// Update order
 		orderMap[order.Id] = *order
+		span.AddEvent("order updated", trace.WithAttributes(
+			orderIDKey.String(order.Id), attribute.Int64("message.id", tracer.Received(stream.Context()))))
 
 		log.Printf("Order ID ", order.Id, ": Updated")
 		ordersStr += order.Id + ", "
@@ -71,18 +99,21 @@ func (s *server) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) erro
 }
 
 func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) error {
+	ctx := stream.Context()
 	// Business Logic Here
 	for {
 		batchMarker := 1
 		combinedShipmentMap := make(map[string]pb.CombinedShipment)
+		// links to the messages of the client which ordered each shipment
+		shipmentLinks := make(map[string][]trace.Link)
 		for {
 			orderId, err := stream.Recv()
 			log.Printf("Reading Proc order : %s", orderId)
 			if err == io.EOF {
 				// Client has sent all the messages Send remaining shipments
 				log.Printf("EOF : %s", orderId)
-				for _, shipment := range combinedShipmentMap {
-					if err := stream.Send(&shipment); err != nil {
+				for destination, shipment := range combinedShipmentMap {
+					if err := sendShipment(ctx, stream, &shipment, shipmentLinks[destination]); err != nil {
 						return err
 					}
 				}
@@ -97,6 +128,7 @@ func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) er
 			destination := orderMap[orderId.GetValue()].Destination
 			// get the shipment
 			shipment, found := combinedShipmentMap[destination]
+			shipmentLinks[destination] = append(shipmentLinks[destination], tracer.SenderLink(ctx, tracer.Received(ctx)))
 
 			if found {
 				ord := orderMap[orderId.GetValue()]
@@ -111,14 +143,15 @@ func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) er
 			}
 
 			if batchMarker == orderBatchSize {
-				for _, comb := range combinedShipmentMap {
+				for destination, comb := range combinedShipmentMap {
 					log.Printf("Shipping : %v -> %v", comb.Id, len(comb.OrdersList))
-					if err := stream.Send(&comb); err != nil {
+					if err := sendShipment(ctx, stream, &comb, shipmentLinks[destination]); err != nil {
 						return err
 					}
 				}
 				batchMarker = 0
 				combinedShipmentMap = make(map[string]pb.CombinedShipment)
+				shipmentLinks = make(map[string][]trace.Link)
 			} else {
 				batchMarker++
 			}
@@ -126,15 +159,57 @@ func (s *server) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) er
 	}
 }
 
+// sendShipment sends a combined shipment in a span of its own, a child of the span of the
+// stream, linked to the messages of the client which ordered its orders.
+func sendShipment(ctx context.Context, stream pb.OrderManagement_ProcessOrdersServer, shipment *pb.CombinedShipment, links []trace.Link) error {
+	_, span := tr.Start(ctx, "ecommerce.server.ProcessOrders.shipment", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.String("shipment.id", shipment.Id), attribute.Int("shipment.orders", len(shipment.OrdersList))))
+	defer span.End()
+	if err := stream.Send(shipment); err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
 func main() {
+	flag.Parse()
 	initSampleData()
 
+	tp, err := tracer.Init(context.Background(), tracer.Config{
+		ServiceName:  "ecommerce.OrderManagement.server",
+		Exporter:     *exporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: true,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer tp.Shutdown(context.Background())
+
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	s := grpc.NewServer(
+		// a span for every call, with an event for every message of the streams
+		grpc.StatsHandler(tracer.NewServerHandler()),
+		// the messages of the errors in the languages of the accept-language metadata
+		grpc.UnaryInterceptor(rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer)),
+		grpc.StreamInterceptor(rpcerrors.StreamServerInterceptor(rpcerrors.DefaultLocalizer)),
+	)
 	pb.RegisterOrderManagementServer(s, &server{})
+	if *adminAddr != "" {
+		admin.Register(s)
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
+	// stop on a signal, for the deferred calls to export the last spans
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		s.GracefulStop()
+	}()
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
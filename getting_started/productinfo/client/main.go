@@ -1,7 +1,9 @@
 package main
 
 import (
+	"admin"
 	"context"
+	"flag"
 	"log"
 	"time"
 
@@ -16,7 +18,10 @@ const (
 	address = "localhost:50051"
 )
 
+var adminAddr = flag.String("admin", "", "address of the channelz page with the channel of the client, e.g. :8083, served until interrupted; off if empty")
+
 func main() {
+	flag.Parse()
 	// Set up a connection with the server from the
 	// provided address (“localhost: 50051”)
 	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
@@ -24,6 +29,10 @@ func main() {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
+	if *adminAddr != "" {
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+		defer admin.Linger(*adminAddr)
+	}
 	// Pass the connection and create a stub. This stub
 	// instance contains all the remote methods to invoke the server.
 	c := pb.NewProductInfoClient(conn)
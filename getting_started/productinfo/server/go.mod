@@ -3,15 +3,21 @@ module productinfo/server
 go 1.20
 
 require (
+	admin v0.0.0-00010101000000-000000000000
 	github.com/gofrs/uuid v4.4.0+incompatible
-	google.golang.org/grpc v1.54.0
+	google.golang.org/grpc v1.55.0
 	google.golang.org/protobuf v1.30.0
+	rpcerrors v0.0.0-00010101000000-000000000000
 )
 
 require (
-	github.com/golang/protobuf v1.5.2 // indirect
+	github.com/golang/protobuf v1.5.3 // indirect
 	golang.org/x/net v0.8.0 // indirect
 	golang.org/x/sys v0.6.0 // indirect
 	golang.org/x/text v0.8.0 // indirect
-	google.golang.org/genproto v0.0.0-20230110181048-76db0878b65f // indirect
+	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
 )
+
+replace admin => ../../../grpc_in_production/admin
+
+replace rpcerrors => ../../../grpc_in_production/rpcerrors
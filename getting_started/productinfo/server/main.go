@@ -1,10 +1,13 @@
 package main
 
 import (
+	"admin"
 	"context"
+	"flag"
 	"log"
 	"net"
 	pb "productinfo/server/ecommerce"
+	"rpcerrors"
 
 	"github.com/gofrs/uuid"
 	"google.golang.org/grpc"
@@ -16,6 +19,8 @@ const (
 	port = ":50051"
 )
 
+var adminAddr = flag.String("admin", "", "address of the channelz page, e.g. :8081, the channelz service is registered too; off if empty")
+
 // server is used to implement ecommerce/product_info.
 type server struct {
 	// this is required, as server is a type of ProductInfoServer
@@ -44,17 +49,23 @@ func (s *server) GetProduct(ctx context.Context, in *pb.ProductID) (*pb.Product,
 	if exists {
 		return value, status.New(codes.OK, "").Err()
 	}
-	return nil, status.Errorf(codes.NotFound, "Product does not exist : %s", in.Value)
+	return nil, rpcerrors.NotFound("Product", in.Value)
 }
 
 func main() {
+	flag.Parse()
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	// create and start a new server
-	s := grpc.NewServer()
+	// with the messages of the errors in the languages of the accept-language metadata
+	s := grpc.NewServer(grpc.UnaryInterceptor(rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer)))
 	pb.RegisterProductInfoServer(s, &server{})
+	if *adminAddr != "" {
+		admin.Register(s)
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
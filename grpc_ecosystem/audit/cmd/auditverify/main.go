@@ -0,0 +1,44 @@
+// Command auditverify checks the audit log of the server: it reports the records
+// modified, missing or out of order, and exits with status 1 if it found any.
+//
+//	grpc_ecosystem$ go run ./audit/cmd/auditverify -dir audit-log
+//
+// Pass the head reported by a previous run, or saved from the server, with -head to
+// also detect the records removed from the end of the log.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"grpc_ecosystem/audit"
+)
+
+var (
+	dir  = flag.String("dir", "audit-log", "directory of the audit log")
+	head = flag.String("head", "", "expected head of the log, or of an earlier state of it, as <seq>:<hash>")
+)
+
+func main() {
+	flag.Parse()
+	var saved audit.Head
+	if *head != "" {
+		if _, err := fmt.Sscanf(*head, "%d:%s", &saved.Seq, &saved.Hash); err != nil {
+			log.Fatalf("invalid head %q, want <seq>:<hash>", *head)
+		}
+	}
+	got, problems, err := audit.Verify(*dir, saved)
+	if err != nil {
+		log.Fatalf("failed to verify %s: %v", *dir, err)
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) > 0 {
+		fmt.Printf("%d problems, head %s\n", len(problems), got)
+		os.Exit(1)
+	}
+	fmt.Printf("ok, %d records, head %s\n", got.Seq, got)
+}
@@ -0,0 +1,155 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"hash"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// UserHeader is the metadata a client without a certificate names its user with. Over
+// the gateway it is the HTTP header Grpc-Metadata-X-User.
+const UserHeader = "x-user"
+
+// Caller returns the identity of the client of a call: the SPIFFE ID, "cn:<common name>"
+// or "dns:<first DNS name>" of its verified TLS certificate, else "user:<name>" from the
+// UserHeader metadata, a name the client claims, else "anonymous".
+func Caller(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			if chains := tlsInfo.State.VerifiedChains; len(chains) > 0 && len(chains[0]) > 0 {
+				cert := chains[0][0]
+				for _, u := range cert.URIs {
+					if u.Scheme == "spiffe" {
+						return u.String()
+					}
+				}
+				if cert.Subject.CommonName != "" {
+					return "cn:" + cert.Subject.CommonName
+				}
+				if len(cert.DNSNames) > 0 {
+					return "dns:" + cert.DNSNames[0]
+				}
+			}
+		}
+	}
+	if users := metadata.ValueFromIncomingContext(ctx, UserHeader); len(users) > 0 && users[0] != "" {
+		return "user:" + users[0]
+	}
+	return "anonymous"
+}
+
+// digest hashes the request messages of a call, in order. A message is hashed as its
+// length and its deterministic serialization.
+type digest struct {
+	h        hash.Hash
+	messages int
+}
+
+func newDigest() *digest {
+	return &digest{h: sha256.New()}
+}
+
+func (d *digest) add(m interface{}) {
+	d.messages++
+	msg, ok := m.(proto.Message)
+	if !ok {
+		return
+	}
+	data, err := proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+	if err != nil {
+		return
+	}
+	var size [8]byte
+	binary.BigEndian.PutUint64(size[:], uint64(len(data)))
+	d.h.Write(size[:])
+	d.h.Write(data)
+}
+
+func (d *digest) sum() string {
+	return hex.EncodeToString(d.h.Sum(nil))
+}
+
+// record writes the record of a call. The call already happened: a record which fails
+// to be written is logged.
+func (l *Logger) record(ctx context.Context, method string, d *digest, stream bool, err error) {
+	r := &Record{
+		Time:          time.Now().UTC(),
+		Caller:        Caller(ctx),
+		Method:        method,
+		RequestDigest: d.sum(),
+		Code:          status.Code(err).String(),
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		r.Peer = p.Addr.String()
+	}
+	if stream {
+		r.Messages = d.messages
+	}
+	if err := l.Write(r); err != nil {
+		log.Printf("[audit] failed to record %s by %s: %v", method, r.Caller, err)
+	}
+}
+
+// UnaryServerInterceptor records the calls of methods, full method names such as
+// /ecommerce.OrderManagement/addOrder.
+func UnaryServerInterceptor(l *Logger, methods ...string) grpc.UnaryServerInterceptor {
+	audited := set(methods)
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if !audited[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		d := newDigest()
+		d.add(req)
+		resp, err := handler(ctx, req)
+		l.record(ctx, info.FullMethod, d, false, err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor records the calls of streaming methods, the request digest
+// covers every message the client sent.
+func StreamServerInterceptor(l *Logger, methods ...string) grpc.StreamServerInterceptor {
+	audited := set(methods)
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if !audited[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		d := newDigest()
+		err := handler(srv, &digestStream{ServerStream: ss, digest: d})
+		l.record(ss.Context(), info.FullMethod, d, true, err)
+		return err
+	}
+}
+
+// digestStream is a grpc.ServerStream adding the messages received to a digest.
+type digestStream struct {
+	grpc.ServerStream
+	digest *digest
+}
+
+func (s *digestStream) RecvMsg(m interface{}) error {
+	if err := s.ServerStream.RecvMsg(m); err != nil {
+		return err
+	}
+	s.digest.add(m)
+	return nil
+}
+
+func set(methods []string) map[string]bool {
+	s := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		s[m] = true
+	}
+	return s
+}
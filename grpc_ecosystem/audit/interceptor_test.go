@@ -0,0 +1,143 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const (
+	addOrder     = "/ecommerce.OrderManagement/addOrder"
+	getOrder     = "/ecommerce.OrderManagement/getOrder"
+	updateOrders = "/ecommerce.OrderManagement/updateOrders"
+)
+
+func TestCaller(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1), Port: 1234}
+	withCert := func(cert *x509.Certificate) context.Context {
+		state := tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return peer.NewContext(context.Background(), &peer.Peer{Addr: addr, AuthInfo: credentials.TLSInfo{State: state}})
+	}
+	user := metadata.NewIncomingContext(context.Background(), metadata.Pairs(UserHeader, "alice"))
+	for _, tt := range []struct {
+		ctx  context.Context
+		want string
+	}{
+		{withCert(&x509.Certificate{Subject: pkix.Name{CommonName: "order-client"}}), "cn:order-client"},
+		{withCert(&x509.Certificate{DNSNames: []string{"localhost"}}), "dns:localhost"},
+		{user, "user:alice"},
+		{context.Background(), "anonymous"},
+	} {
+		if got := Caller(tt.ctx); got != tt.want {
+			t.Errorf("Caller = %q, want %q", got, tt.want)
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer l.Close()
+	interceptor := UnaryServerInterceptor(l, addOrder)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(UserHeader, "alice"))
+	call := func(method string, req string, err error) {
+		handler := func(context.Context, interface{}) (interface{}, error) { return nil, err }
+		interceptor(ctx, wrapperspb.String(req), &grpc.UnaryServerInfo{FullMethod: method}, handler)
+	}
+
+	call(addOrder, "101", nil)
+	call(getOrder, "101", nil)
+	call(addOrder, "-1", status.Error(codes.InvalidArgument, "invalid"))
+	call(addOrder, "101", nil)
+
+	records := readRecords(t, dir)
+	if len(records) != 3 {
+		t.Fatalf("%d records, want the 3 calls of %s", len(records), addOrder)
+	}
+	if r := records[0]; r.Caller != "user:alice" || r.Method != addOrder || r.Code != "OK" || r.Messages != 0 {
+		t.Errorf("record = %+v", r)
+	}
+	if records[1].Code != "InvalidArgument" {
+		t.Errorf("code = %s, want InvalidArgument", records[1].Code)
+	}
+	if records[0].RequestDigest != records[2].RequestDigest || records[0].RequestDigest == records[1].RequestDigest {
+		t.Errorf("request digests = %s, %s, %s, want the same digest for the same request",
+			records[0].RequestDigest, records[1].RequestDigest, records[2].RequestDigest)
+	}
+}
+
+func TestStreamServerInterceptor(t *testing.T) {
+	dir := t.TempDir()
+	l, err := Open(dir, 0)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer l.Close()
+	interceptor := StreamServerInterceptor(l, updateOrders)
+	stream := &fakeStream{ctx: context.Background(), msgs: []string{"101", "102"}}
+	handler := func(srv interface{}, ss grpc.ServerStream) error {
+		for {
+			if err := ss.RecvMsg(new(wrapperspb.StringValue)); err == io.EOF {
+				return errors.New("failed")
+			}
+		}
+	}
+	interceptor(nil, stream, &grpc.StreamServerInfo{FullMethod: updateOrders}, handler)
+
+	records := readRecords(t, dir)
+	if len(records) != 1 || records[0].Messages != 2 || records[0].Code != "Unknown" || records[0].Caller != "anonymous" {
+		t.Errorf("records = %+v, want a record of the 2 messages", records)
+	}
+}
+
+type fakeStream struct {
+	grpc.ServerStream
+	ctx  context.Context
+	msgs []string
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	if len(s.msgs) == 0 {
+		return io.EOF
+	}
+	m.(*wrapperspb.StringValue).Value, s.msgs = s.msgs[0], s.msgs[1:]
+	return nil
+}
+
+func readRecords(t *testing.T, dir string) []Record {
+	t.Helper()
+	if _, problems, err := Verify(dir, Head{}); err != nil || len(problems) > 0 {
+		t.Fatalf("Verify = %v, %v", problems, err)
+	}
+	files, ls := lines(t, dir)
+	var records []Record
+	for i := range files {
+		for _, line := range ls[i] {
+			var r Record
+			if err := json.Unmarshal(line, &r); err != nil {
+				t.Fatalf("invalid record: %v", err)
+			}
+			records = append(records, r)
+		}
+	}
+	return records
+}
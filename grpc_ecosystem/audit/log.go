@@ -0,0 +1,275 @@
+// Package audit keeps a tamper-evident record of the mutating RPCs: who called which
+// method with which request, and how it ended.
+//
+// The records are JSON lines appended to files rotated by size. Each record holds the
+// hash of the previous one and its own hash, so that a record modified, removed or
+// inserted breaks the chain: Verify detects it, and the gaps in the sequence numbers.
+// Removing the last records can only be detected against a head (sequence number and
+// hash) saved elsewhere, such as the one Verify reports.
+package audit
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultMaxSize is the size from which a Logger starts a new file.
+const DefaultMaxSize = 10 << 20
+
+// Record is an audit record, a line of the log.
+type Record struct {
+	// Seq numbers the records from 1, without gaps.
+	Seq  uint64    `json:"seq"`
+	Time time.Time `json:"time"`
+	// Caller is the identity of the client (see Caller), Peer its address.
+	Caller string `json:"caller"`
+	Peer   string `json:"peer,omitempty"`
+	Method string `json:"method"`
+	// RequestDigest is the SHA-256 of the request messages (see digest).
+	RequestDigest string `json:"request_digest"`
+	// Messages is the number of request messages of a client stream.
+	Messages int    `json:"messages,omitempty"`
+	Code     string `json:"code"`
+	// PrevHash is the Hash of the previous record, empty for the first one.
+	PrevHash string `json:"prev_hash"`
+	// Hash is the SHA-256 of PrevHash and of the record without its Hash.
+	Hash string `json:"hash,omitempty"`
+}
+
+// hash computes the Hash of r.
+func (r Record) hash() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	h.Write([]byte(r.PrevHash))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// Logger appends the records to the files audit-<seq of the first record>.jsonl of a
+// directory, and starts a new file once the current one reaches its maximum size.
+type Logger struct {
+	dir     string
+	maxSize int64
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	head Head
+}
+
+// Head identifies the last record of a log.
+type Head struct {
+	Seq  uint64 `json:"seq"`
+	Hash string `json:"hash"`
+}
+
+func (h Head) String() string {
+	if h.Seq == 0 {
+		return "none"
+	}
+	return fmt.Sprintf("%d:%s", h.Seq, h.Hash)
+}
+
+// Open opens the log of dir, creating it if needed, to append records after its last
+// one. maxSize is DefaultMaxSize if 0.
+func Open(dir string, maxSize int64) (*Logger, error) {
+	if maxSize == 0 {
+		maxSize = DefaultMaxSize
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	l := &Logger{dir: dir, maxSize: maxSize}
+	files, err := logFiles(dir)
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return l, nil
+	}
+	last := files[len(files)-1]
+	head, size, torn, err := lastRecord(last)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resume the audit log, verify %s: %v", last, err)
+	}
+	if torn != nil {
+		// a crash in the middle of a write, the record was never acknowledged
+		if err := moveTorn(last, size, torn); err != nil {
+			return nil, fmt.Errorf("failed to remove the incomplete last record of %s: %v", last, err)
+		}
+	}
+	// the file has no complete record, the chain resumes from the previous files
+	for i := len(files) - 2; head.Seq == 0 && i >= 0; i-- {
+		if head, _, _, err = lastRecord(files[i]); err != nil {
+			return nil, fmt.Errorf("failed to resume the audit log, verify %s: %v", files[i], err)
+		}
+	}
+	l.head = head
+	if l.file, err = os.OpenFile(last, os.O_WRONLY|os.O_APPEND, 0o600); err != nil {
+		return nil, err
+	}
+	info, err := l.file.Stat()
+	if err != nil {
+		l.file.Close()
+		return nil, err
+	}
+	l.size = info.Size()
+	return l, nil
+}
+
+// logFiles returns the files of the log of dir, in order.
+func logFiles(dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "audit-*.jsonl"))
+	if err != nil {
+		return nil, err
+	}
+	// the sequence numbers in the names are zero padded
+	sort.Strings(files)
+	return files, nil
+}
+
+// lastRecord returns the head of a log file, the zero Head if it has no record. A crash
+// in the middle of a write leaves the file with an incomplete last line: torn is that
+// line, and size the size of the file without it.
+func lastRecord(file string) (head Head, size int64, torn []byte, err error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return Head{}, 0, nil, err
+	}
+	defer f.Close()
+	var last []byte
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			if len(line) > 0 {
+				torn = line
+			}
+			break
+		}
+		if err != nil {
+			return Head{}, 0, nil, err
+		}
+		last = line
+		size += int64(len(line))
+	}
+	if last == nil {
+		return Head{}, size, torn, nil
+	}
+	var rec Record
+	if err := json.Unmarshal(last, &rec); err != nil {
+		return Head{}, 0, nil, fmt.Errorf("invalid last record: %v", err)
+	}
+	return Head{Seq: rec.Seq, Hash: rec.Hash}, size, torn, nil
+}
+
+// moveTorn moves the incomplete last line torn of file, found from size, to the side
+// file <file>.torn so that the chain resumes from the last complete record. The side
+// file keeps it for an investigation, Verify ignores it.
+func moveTorn(file string, size int64, torn []byte) error {
+	side := file + ".torn"
+	f, err := os.OpenFile(side, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(torn, '\n'))
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Truncate(file, size); err != nil {
+		return err
+	}
+	log.Printf("[audit] moved the incomplete last record of %s to %s", file, side)
+	return nil
+}
+
+// Write chains r to the previous record and appends it, synced to the disk: a record
+// written is not lost in a crash. It sets the Seq, PrevHash and Hash of r.
+func (l *Logger) Write(r *Record) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	r.Seq = l.head.Seq + 1
+	r.PrevHash = l.head.Hash
+	hash, err := r.hash()
+	if err != nil {
+		return err
+	}
+	r.Hash = hash
+	line, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	if l.file == nil || l.size+int64(len(line)) > l.maxSize && l.size > 0 {
+		if err := l.rotate(r.Seq); err != nil {
+			return err
+		}
+	}
+	n, err := l.file.Write(line)
+	l.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.head = Head{Seq: r.Seq, Hash: r.Hash}
+	return nil
+}
+
+// rotate starts the file of the record seq.
+func (l *Logger) rotate(seq uint64) error {
+	if l.file != nil {
+		if err := l.file.Close(); err != nil {
+			return err
+		}
+		l.file = nil
+	}
+	name := filepath.Join(l.dir, fmt.Sprintf("audit-%012d.jsonl", seq))
+	f, err := os.OpenFile(name, os.O_WRONLY|os.O_APPEND|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return err
+	}
+	l.file, l.size = f, 0
+	return nil
+}
+
+// Head returns the head of the log, to save it elsewhere and verify the log against it.
+func (l *Logger) Head() Head {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.head
+}
+
+// Close closes the current file.
+func (l *Logger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
@@ -0,0 +1,175 @@
+package audit
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeRecords writes n records of method to the log of dir.
+func writeRecords(t *testing.T, dir string, maxSize int64, n int) Head {
+	t.Helper()
+	l, err := Open(dir, maxSize)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer l.Close()
+	for i := 0; i < n; i++ {
+		r := &Record{Time: time.Now().UTC(), Caller: "user:alice", Method: "/ecommerce.OrderManagement/addOrder", RequestDigest: "d", Code: "OK"}
+		if err := l.Write(r); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+	}
+	return l.Head()
+}
+
+func verify(t *testing.T, dir string, saved Head) (Head, []string) {
+	t.Helper()
+	head, problems, err := Verify(dir, saved)
+	if err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	var msgs []string
+	for _, p := range problems {
+		msgs = append(msgs, p.String())
+	}
+	return head, msgs
+}
+
+func TestLogger(t *testing.T) {
+	dir := t.TempDir()
+	head := writeRecords(t, dir, 1000, 10)
+	// resumes the chain after a restart
+	head = writeRecords(t, dir, 1000, 5)
+	if head.Seq != 15 {
+		t.Errorf("head = %v, want the record 15", head)
+	}
+	files, _ := logFiles(dir)
+	if len(files) < 2 {
+		t.Errorf("the log of 15 records of ~300 bytes is in %d files of 1000 bytes, want it rotated", len(files))
+	}
+	got, problems := verify(t, dir, head)
+	if len(problems) > 0 || got != head {
+		t.Errorf("Verify = %v, %v, want %v without problems", got, problems, head)
+	}
+}
+
+// lines returns the lines of the log, across its files.
+func lines(t *testing.T, dir string) (files []string, byFile [][][]byte) {
+	files, _ = logFiles(dir)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		byFile = append(byFile, bytes.SplitAfter(bytes.TrimSuffix(data, []byte("\n")), []byte("\n")))
+	}
+	return files, byFile
+}
+
+func rewrite(t *testing.T, file string, lines [][]byte) {
+	if err := os.WriteFile(file, bytes.Join(lines, nil), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		tamper func(t *testing.T, dir string)
+		want   string
+	}{
+		{"modified record", func(t *testing.T, dir string) {
+			files, ls := lines(t, dir)
+			ls[0][2] = bytes.Replace(ls[0][2], []byte("user:alice"), []byte("user:mallory"), 1)
+			rewrite(t, files[0], ls[0])
+		}, "the record 3 was modified"},
+		{"removed record", func(t *testing.T, dir string) {
+			files, ls := lines(t, dir)
+			rewrite(t, files[0], append(ls[0][:1], ls[0][2:]...))
+		}, "the record 2 is missing"},
+		{"reordered records", func(t *testing.T, dir string) {
+			files, ls := lines(t, dir)
+			ls[0][1], ls[0][2] = ls[0][2], ls[0][1]
+			rewrite(t, files[0], ls[0])
+		}, "the record 2 comes after the record 3"},
+		{"removed file", func(t *testing.T, dir string) {
+			files, _ := lines(t, dir)
+			os.Remove(files[1])
+		}, "are missing"},
+		{"truncated tail", func(t *testing.T, dir string) {
+			files, ls := lines(t, dir)
+			last := len(files) - 1
+			rewrite(t, files[last], ls[last][:len(ls[last])-1])
+		}, "the record 12 of the saved head is missing"},
+		{"incomplete record", func(t *testing.T, dir string) {
+			files, ls := lines(t, dir)
+			ls[0][1] = ls[0][1][:20]
+			rewrite(t, files[0], ls[0])
+		}, "invalid record"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			head := writeRecords(t, dir, 1500, 12)
+			tt.tamper(t, dir)
+			_, problems := verify(t, dir, head)
+			if !strings.Contains(strings.Join(problems, "\n"), tt.want) {
+				t.Errorf("problems = %q, want %q", problems, tt.want)
+			}
+		})
+	}
+}
+
+// A crash in the middle of a write leaves an incomplete last record, it is moved to a
+// side file and the chain resumes from the last complete record.
+func TestOpen_TornRecord(t *testing.T) {
+	const torn = `{"seq":3,"time":"2023-`
+	appendTorn := func(file string) {
+		f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString(torn)
+		f.Close()
+	}
+	tests := []struct {
+		name string
+		// file is the name of the file the torn record is appended to, in a log of 2
+		// records of a file each
+		file string
+	}{
+		{"last file", "audit-000000000002.jsonl"},
+		{"new file", "audit-000000000003.jsonl"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			head := writeRecords(t, dir, 1, 2)
+			file := filepath.Join(dir, tt.file)
+			appendTorn(file)
+
+			l, err := Open(dir, 1)
+			if err != nil {
+				t.Fatalf("Open failed: %v", err)
+			}
+			l.Close()
+			if l.Head() != head {
+				t.Errorf("Head() = %s, want %s", l.Head(), head)
+			}
+			if data, _ := os.ReadFile(file + ".torn"); string(data) != torn+"\n" {
+				t.Errorf("%s.torn = %q, want the torn record", tt.file, data)
+			}
+
+			head = writeRecords(t, dir, 1, 1)
+			if head.Seq != 3 {
+				t.Errorf("Head() = %s, want the record 3", head)
+			}
+			if got, problems := verify(t, dir, head); got != head || problems != nil {
+				t.Errorf("Verify = %s, %q, want %s without problems", got, problems, head)
+			}
+		})
+	}
+}
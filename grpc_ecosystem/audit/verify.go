@@ -0,0 +1,100 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// Problem is a gap or a tampered record found by Verify.
+type Problem struct {
+	File string
+	Line int
+	Msg  string
+}
+
+func (p Problem) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("%s: %s", p.File, p.Msg)
+	}
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Msg)
+}
+
+// Verify checks the chain of the log of dir and returns its head and the problems
+// found: records modified, missing, inserted or out of order, and files missing. After
+// a problem the verification goes on from the record found, so that all the problems
+// are reported.
+//
+// saved is a head of the log saved earlier, the log must still hold its record: it
+// detects the records removed from the end of the log. The zero Head checks nothing.
+func Verify(dir string, saved Head) (Head, []Problem, error) {
+	files, err := logFiles(dir)
+	if err != nil {
+		return Head{}, nil, err
+	}
+	var (
+		head     Head
+		problems []Problem
+		found    bool // whether the saved head was found
+	)
+	for _, file := range files {
+		f, err := os.Open(file)
+		if err != nil {
+			return Head{}, nil, err
+		}
+		name := filepath.Base(file)
+		s := bufio.NewScanner(f)
+		s.Buffer(nil, 1<<20)
+		first := true
+		for line := 1; s.Scan(); line++ {
+			report := func(format string, a ...interface{}) {
+				problems = append(problems, Problem{File: name, Line: line, Msg: fmt.Sprintf(format, a...)})
+			}
+			var rec Record
+			if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+				report("invalid record: %v", err)
+				continue
+			}
+			if first {
+				var firstSeq uint64
+				if _, err := fmt.Sscanf(name, "audit-%d.jsonl", &firstSeq); err == nil && firstSeq != rec.Seq {
+					report("the file starts with the record %d, its name says %d", rec.Seq, firstSeq)
+				}
+				first = false
+			}
+			switch {
+			case rec.Seq == head.Seq+1:
+				if rec.PrevHash != head.Hash {
+					report("the record %d doesn't follow the record %d, the chain is broken", rec.Seq, head.Seq)
+				}
+			case rec.Seq == head.Seq+2:
+				report("the record %d is missing", head.Seq+1)
+			case rec.Seq > head.Seq:
+				report("the records %d to %d are missing", head.Seq+1, rec.Seq-1)
+			default:
+				report("the record %d comes after the record %d", rec.Seq, head.Seq)
+			}
+			if hash, err := rec.hash(); err != nil || hash != rec.Hash {
+				report("the record %d was modified, its hash doesn't match", rec.Seq)
+			}
+			head = Head{Seq: rec.Seq, Hash: rec.Hash}
+			if saved.Seq != 0 && head.Seq == saved.Seq {
+				if head.Hash != saved.Hash {
+					report("the record %d differs from the saved head", rec.Seq)
+				}
+				found = true
+			}
+		}
+		err = s.Err()
+		f.Close()
+		if err != nil {
+			return Head{}, nil, fmt.Errorf("failed to read %s: %v", file, err)
+		}
+	}
+	if saved.Seq != 0 && !found {
+		problems = append(problems, Problem{File: dir, Msg: fmt.Sprintf("the record %d of the saved head is missing, the log ends at the record %d", saved.Seq, head.Seq)})
+	}
+	return head, problems, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	// error details are resolved from the global registry when they are marshaled
+	_ "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	gw "grpc_ecosystem/ecommerce"
+	"rpcerrors"
+)
+
+const (
+	grpcServerEndpoint = "localhost:50051"
+	gatewayPort        = ":8081"
+	// openAPIDir holds the OpenAPI document generated by protoc-gen-openapiv2
+	openAPIDir = "openapi"
+	// ndjsonContentType can be sent in the Accept header to get streamed results
+	// (e.g. searchOrders) labelled as newline-delimited JSON.
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// errorBody is the JSON document written for every failed call,
+// it carries the gRPC status along with its details.
+type errorBody struct {
+	Error errorStatus `json:"error"`
+}
+
+type errorStatus struct {
+	// HTTP status code mapped from the gRPC code
+	Code int `json:"code"`
+	// gRPC code name e.g. NotFound, InvalidArgument
+	Status  string            `json:"status"`
+	Message string            `json:"message"`
+	Details []json.RawMessage `json:"details,omitempty"`
+}
+
+// ndjsonMarshaler is the default JSON marshaler with the content type of newline-delimited JSON.
+type ndjsonMarshaler struct {
+	runtime.JSONPb
+}
+
+func (*ndjsonMarshaler) ContentType(_ interface{}) string {
+	return ndjsonContentType
+}
+
+// httpErrorHandler maps the gRPC status code of a failed call to the HTTP status
+// and writes the status details (BadRequest, ResourceInfo...) as JSON.
+func httpErrorHandler(ctx context.Context, mux *runtime.ServeMux, marshaler runtime.Marshaler,
+	w http.ResponseWriter, r *http.Request, err error) {
+	st := status.Convert(err)
+	httpStatus := runtime.HTTPStatusFromCode(st.Code())
+
+	body := errorBody{Error: errorStatus{
+		Code:    httpStatus,
+		Status:  st.Code().String(),
+		Message: st.Message(),
+	}}
+	for _, detail := range st.Proto().GetDetails() {
+		// details are google.protobuf.Any, protojson adds the "@type" of each of them
+		buf, merr := protojson.Marshal(detail)
+		if merr != nil {
+			log.Printf("Failed to marshal error detail %s : %v", detail.GetTypeUrl(), merr)
+			continue
+		}
+		body.Error.Details = append(body.Error.Details, buf)
+	}
+
+	log.Printf("%s %s -> %d %s : %s", r.Method, r.URL.Path, httpStatus, st.Code(), st.Message())
+	w.Header().Del("Trailer")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(httpStatus)
+	if err := json.NewEncoder(w).Encode(body); err != nil {
+		log.Printf("Failed to write error response: %v", err)
+	}
+}
+
+// headerMatcher passes the Accept-Language header on as the accept-language metadata
+// the servers localize the messages of the errors with, the other headers as the
+// default matcher does.
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, "Accept-Language") {
+		return rpcerrors.AcceptLanguageKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
+
+func newGatewayMux(ctx context.Context, conn *grpc.ClientConn) (*runtime.ServeMux, error) {
+	mux := runtime.NewServeMux(
+		runtime.WithErrorHandler(httpErrorHandler),
+		runtime.WithMarshalerOption(ndjsonContentType, &ndjsonMarshaler{}),
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+	)
+	// Register the ProductInfo and OrderManagement handlers, each of them
+	// forwards the HTTP request to the gRPC server over conn.
+	if err := gw.RegisterProductInfoHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	if err := gw.RegisterOrderManagementHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Connection to the gRPC server which is shared by all the handlers.
+	conn, err := grpc.DialContext(ctx, grpcServerEndpoint,
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		log.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	gwMux, err := newGatewayMux(ctx, conn)
+	if err != nil {
+		log.Fatalf("Failed to register gateway handlers: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/", gwMux)
+	// serve the generated OpenAPI document e.g. /openapi/ecommerce.swagger.json
+	mux.Handle("/openapi/", http.StripPrefix("/openapi/", http.FileServer(http.Dir(openAPIDir))))
+
+	log.Printf("gRPC gateway listening on %s", gatewayPort)
+	if err := http.ListenAndServe(gatewayPort, mux); err != nil {
+		log.Fatalf("Failed to serve gateway: %v", err)
+	}
+}
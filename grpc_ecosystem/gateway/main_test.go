@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	pb "grpc_ecosystem/ecommerce"
+	"rpcerrors"
+)
+
+const bufSize = 1024 * 1024
+
+// orderServer is a fixed OrderManagement backend for the gateway tests.
+type orderServer struct {
+	pb.UnimplementedOrderManagementServer
+}
+
+func (s *orderServer) GetOrder(ctx context.Context, in *wrapperspb.StringValue) (*pb.Order, error) {
+	if in.Value == "101" {
+		return &pb.Order{Id: "101", Items: []string{"Apple Mouse"}}, nil
+	}
+	st, _ := status.New(codes.NotFound, "Order does not exist").
+		WithDetails(&epb.ResourceInfo{ResourceType: "Order", ResourceName: in.Value})
+	return nil, st.Err()
+}
+
+func (s *orderServer) SearchOrders(in *wrapperspb.StringValue, stream pb.OrderManagement_SearchOrdersServer) error {
+	for _, id := range []string{"101", "106"} {
+		if err := stream.Send(&pb.Order{Id: id, Items: []string{in.Value}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// startGateway serves orderServer over bufconn and returns an HTTP server running the gateway in front of it.
+func startGateway(t *testing.T, opts ...grpc.ServerOption) *httptest.Server {
+	listener := bufconn.Listen(bufSize)
+	s := grpc.NewServer(opts...)
+	pb.RegisterOrderManagementServer(s, &orderServer{})
+	go s.Serve(listener)
+	t.Cleanup(s.Stop)
+
+	ctx := context.Background()
+	conn, err := grpc.DialContext(ctx, "bufnet",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return listener.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	mux, err := newGatewayMux(ctx, conn)
+	if err != nil {
+		t.Fatalf("Failed to register gateway handlers: %v", err)
+	}
+	ts := httptest.NewServer(mux)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func TestGateway_GetOrderNotFound(t *testing.T) {
+	ts := startGateway(t)
+
+	resp, err := http.Get(ts.URL + "/v1/order/999")
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusNotFound)
+	}
+
+	var body struct {
+		Error struct {
+			Code    int
+			Status  string
+			Details []map[string]interface{}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode error body: %v", err)
+	}
+	if body.Error.Code != http.StatusNotFound || body.Error.Status != codes.NotFound.String() {
+		t.Errorf("error = %+v, want code 404 and status NotFound", body.Error)
+	}
+	if len(body.Error.Details) != 1 || body.Error.Details[0]["resourceName"] != "999" {
+		t.Errorf("details = %v, want ResourceInfo for 999", body.Error.Details)
+	}
+}
+
+// The Accept-Language header reaches the server, which adds the localized message.
+func TestGateway_AcceptLanguage(t *testing.T) {
+	ts := startGateway(t, grpc.UnaryInterceptor(rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer)))
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/order/999", nil)
+	req.Header.Set("Accept-Language", "fr-CA, en;q=0.5")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		Error struct {
+			Details []map[string]interface{}
+		}
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		t.Fatalf("Failed to decode error body: %v", err)
+	}
+	for _, d := range body.Error.Details {
+		if d["@type"] == "type.googleapis.com/google.rpc.LocalizedMessage" {
+			if d["locale"] != "fr" || d["message"] != "La commande 999 n'existe pas." {
+				t.Errorf("LocalizedMessage = %v, want the French message", d)
+			}
+			return
+		}
+	}
+	t.Errorf("details = %v, want a LocalizedMessage", body.Error.Details)
+}
+
+func TestGateway_SearchOrdersNDJSON(t *testing.T) {
+	ts := startGateway(t)
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/v1/orders/search/Mouse", nil)
+	req.Header.Set("Accept", ndjsonContentType)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("GET failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if ct := resp.Header.Get("Content-Type"); ct != ndjsonContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ndjsonContentType)
+	}
+
+	// every line of the body is a JSON document holding one streamed order
+	var ids []string
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		var line struct {
+			Result struct{ Id string }
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			t.Fatalf("line %q is not JSON: %v", scanner.Text(), err)
+		}
+		ids = append(ids, line.Result.Id)
+	}
+	if len(ids) != 2 || ids[0] != "101" || ids[1] != "106" {
+		t.Errorf("streamed orders = %v, want [101 106]", ids)
+	}
+}
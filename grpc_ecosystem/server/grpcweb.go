@@ -0,0 +1,43 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+)
+
+// newGRPCWebHandler wraps the gRPC server so that browser clients can call its services
+// with the gRPC-Web protocol. Requests from an origin which is not in allowedOrigins
+// are rejected by the CORS pre-flight, "*" allows every origin.
+func newGRPCWebHandler(s *grpc.Server, allowedOrigins []string) http.Handler {
+	wrapped := grpcweb.WrapServer(s,
+		grpcweb.WithOriginFunc(originAllowed(allowedOrigins)),
+		// browsers send x-grpc-web, x-user-agent etc. along with the metadata of the call
+		grpcweb.WithAllowedRequestHeaders([]string{"*"}),
+	)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r) {
+			wrapped.ServeHTTP(w, r)
+			return
+		}
+		http.Error(w, "only gRPC-Web requests are served on this port", http.StatusNotFound)
+	})
+	// h2c lets the browser (or a proxy in front of it) use HTTP/2 without TLS,
+	// plain HTTP/1.1 requests are served as they are.
+	return h2c.NewHandler(handler, &http2.Server{})
+}
+
+func originAllowed(allowedOrigins []string) func(origin string) bool {
+	return func(origin string) bool {
+		for _, allowed := range allowedOrigins {
+			if allowed == "*" || strings.EqualFold(allowed, origin) {
+				return true
+			}
+		}
+		return false
+	}
+}
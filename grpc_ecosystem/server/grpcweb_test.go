@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	pb "grpc_ecosystem/ecommerce"
+)
+
+const (
+	allowedOrigin = "http://localhost:3000"
+	// MSB of the flag byte marks the frame holding the trailers
+	trailerFlag = 0x80
+)
+
+// startGRPCWebServer serves both services with the gRPC-Web wrapper on a test HTTP server.
+func startGRPCWebServer(t *testing.T) *httptest.Server {
+	s := grpc.NewServer()
+	pb.RegisterProductInfoServer(s, &productServer{})
+	pb.RegisterOrderManagementServer(s, newOrderServer())
+	ts := httptest.NewServer(newGRPCWebHandler(s, []string{allowedOrigin}))
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+// h2cClient talks HTTP/2 over clear text (prior knowledge) to the test server.
+func h2cClient() *http.Client {
+	return &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+}
+
+// encodeFrame writes a length-prefixed gRPC-Web message, 1 byte flag + 4 bytes length + message.
+func encodeFrame(t *testing.T, msg proto.Message) []byte {
+	payload, err := proto.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal request: %v", err)
+	}
+	frame := make([]byte, 5+len(payload))
+	binary.BigEndian.PutUint32(frame[1:5], uint32(len(payload)))
+	copy(frame[5:], payload)
+	return frame
+}
+
+// decodeFrames splits a gRPC-Web response body into its message frames and the trailers frame.
+func decodeFrames(t *testing.T, body []byte) ([][]byte, http.Header) {
+	var messages [][]byte
+	trailers := http.Header{}
+	for len(body) > 0 {
+		if len(body) < 5 {
+			t.Fatalf("truncated frame header: %v", body)
+		}
+		flag, length := body[0], binary.BigEndian.Uint32(body[1:5])
+		data := body[5 : 5+length]
+		body = body[5+length:]
+		if flag&trailerFlag == 0 {
+			messages = append(messages, data)
+			continue
+		}
+		// trailers are encoded like HTTP/1 headers, "key: value\r\n"
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\r\n") {
+			kv := strings.SplitN(line, ":", 2)
+			trailers.Add(textproto.TrimString(kv[0]), textproto.TrimString(kv[1]))
+		}
+	}
+	return messages, trailers
+}
+
+func callGRPCWeb(t *testing.T, client *http.Client, url, method string, req proto.Message) (*http.Response, [][]byte, http.Header) {
+	httpReq, _ := http.NewRequest(http.MethodPost, url+method, bytes.NewReader(encodeFrame(t, req)))
+	httpReq.Header.Set("Content-Type", "application/grpc-web+proto")
+	httpReq.Header.Set("X-Grpc-Web", "1")
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		t.Fatalf("gRPC-Web call %s failed: %v", method, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("Failed to read response: %v", err)
+	}
+	messages, trailers := decodeFrames(t, body)
+	return resp, messages, trailers
+}
+
+// grpcStatus returns grpc-status from the trailers frame, or from the headers for a trailers-only response.
+func grpcStatus(resp *http.Response, trailers http.Header) string {
+	if s := trailers.Get("grpc-status"); s != "" {
+		return s
+	}
+	return resp.Header.Get("grpc-status")
+}
+
+func TestGRPCWeb_GetOrderHTTP1(t *testing.T) {
+	ts := startGRPCWebServer(t)
+
+	resp, messages, trailers := callGRPCWeb(t, ts.Client(), ts.URL,
+		"/ecommerce.OrderManagement/getOrder", &wrapperspb.StringValue{Value: "101"})
+	if resp.ProtoMajor != 1 {
+		t.Errorf("protocol = %s, want HTTP/1.1", resp.Proto)
+	}
+	if ct := resp.Header.Get("Content-Type"); ct != "application/grpc-web+proto" {
+		t.Errorf("Content-Type = %q, want application/grpc-web+proto", ct)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("got %d messages, want 1", len(messages))
+	}
+	order := &pb.Order{}
+	if err := proto.Unmarshal(messages[0], order); err != nil {
+		t.Fatalf("Failed to unmarshal order: %v", err)
+	}
+	if order.Id != "101" {
+		t.Errorf("order ID = %q, want 101", order.Id)
+	}
+	if s := grpcStatus(resp, trailers); s != "0" {
+		t.Errorf("grpc-status = %q, want 0", s)
+	}
+}
+
+func TestGRPCWeb_SearchOrdersHTTP2(t *testing.T) {
+	ts := startGRPCWebServer(t)
+
+	resp, messages, trailers := callGRPCWeb(t, h2cClient(), ts.URL,
+		"/ecommerce.OrderManagement/searchOrders", &wrapperspb.StringValue{Value: "Echo"})
+	if resp.ProtoMajor != 2 {
+		t.Errorf("protocol = %s, want HTTP/2.0", resp.Proto)
+	}
+	// orders 105 and 106 contain an Amazon Echo, each of them is sent in its own frame
+	ids := map[string]bool{}
+	for _, m := range messages {
+		order := &pb.Order{}
+		if err := proto.Unmarshal(m, order); err != nil {
+			t.Fatalf("Failed to unmarshal order: %v", err)
+		}
+		ids[order.Id] = true
+	}
+	if len(ids) != 2 || !ids["105"] || !ids["106"] {
+		t.Errorf("streamed orders = %v, want 105 and 106", ids)
+	}
+	if s := grpcStatus(resp, trailers); s != "0" {
+		t.Errorf("grpc-status = %q, want 0", s)
+	}
+}
+
+func TestGRPCWeb_GetProductNotFound(t *testing.T) {
+	ts := startGRPCWebServer(t)
+
+	resp, messages, trailers := callGRPCWeb(t, ts.Client(), ts.URL,
+		"/ecommerce.ProductInfo/getProduct", &wrapperspb.StringValue{Value: "unknown"})
+	if len(messages) != 0 {
+		t.Errorf("got %d messages, want none", len(messages))
+	}
+	// codes.NotFound
+	if s := grpcStatus(resp, trailers); s != "5" {
+		t.Errorf("grpc-status = %q, want 5", s)
+	}
+}
+
+func TestGRPCWeb_CORS(t *testing.T) {
+	ts := startGRPCWebServer(t)
+
+	tests := []struct {
+		origin string
+		allow  bool
+	}{
+		{allowedOrigin, true},
+		{"http://evil.example.com", false},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest(http.MethodOptions, ts.URL+"/ecommerce.ProductInfo/getProduct", nil)
+		req.Header.Set("Origin", tt.origin)
+		req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		req.Header.Set("Access-Control-Request-Headers", "content-type,x-grpc-web")
+		resp, err := ts.Client().Do(req)
+		if err != nil {
+			t.Fatalf("pre-flight failed: %v", err)
+		}
+		resp.Body.Close()
+		got := resp.Header.Get("Access-Control-Allow-Origin")
+		if tt.allow && got != tt.origin {
+			t.Errorf("origin %s: Access-Control-Allow-Origin = %q, want %q", tt.origin, got, tt.origin)
+		}
+		if !tt.allow && got != "" {
+			t.Errorf("origin %s: Access-Control-Allow-Origin = %q, want none", tt.origin, got)
+		}
+	}
+}
@@ -0,0 +1,326 @@
+package main
+
+import (
+	"admin"
+	"context"
+	"flag"
+	"fmt"
+	"grpc_prod/tracer"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+	"grpc_ecosystem/audit"
+	pb "grpc_ecosystem/ecommerce"
+	"rpcerrors"
+)
+
+const (
+	port           = ":50051"
+	orderBatchSize = 3
+)
+
+var (
+	// gRPC-Web is served on its own port next to the native gRPC port
+	webPort        = flag.String("web-port", ":8080", "port of the gRPC-Web server")
+	allowedOrigins = flag.String("allowed-origins", "http://localhost:3000",
+		"comma separated origins allowed to call the gRPC-Web server, * allows all")
+	auditDir     = flag.String("audit-dir", "audit-log", "directory of the audit log, check it with audit/cmd/auditverify")
+	auditMaxSize = flag.Int64("audit-max-size", audit.DefaultMaxSize, "size from which the audit log starts a new file")
+	adminAddr    = flag.String("admin", "", "address of the channelz page, e.g. :8084 (the gateway is on :8081), the channelz service is registered too; off if empty")
+	exporter     = flag.String("exporter", tracer.ExporterNone, "where the spans go: otlp, stdout or none")
+	otlpEndpoint = flag.String("otlp-endpoint", tracer.DefaultOTLPEndpoint, "host:port of the OpenTelemetry collector")
+)
+
+// spans of the handlers, the children of the span of the stats handler
+var tr = otel.Tracer("grpc_ecosystem/server")
+
+// orderIDKey is the attribute of the order of a span or of an event.
+const orderIDKey = attribute.Key("order.id")
+
+// auditedMethods are the mutating methods, each call is recorded in the audit log.
+var auditedMethods = []string{
+	"/ecommerce.OrderManagement/addOrder",
+	"/ecommerce.OrderManagement/updateOrders",
+	"/ecommerce.OrderManagement/processOrders",
+	"/ecommerce.ProductInfo/addProduct",
+}
+
+// productServer is used to implement ecommerce/product_info.
+type productServer struct {
+	pb.UnimplementedProductInfoServer
+	sync.RWMutex
+	productMap map[string]*pb.Product
+}
+
+// AddProduct implements ecommerce.AddProduct
+func (s *productServer) AddProduct(ctx context.Context, in *pb.Product) (*wrapperspb.StringValue, error) {
+	out, err := uuid.NewUUID()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "Error while generating Product ID : %v", err)
+	}
+	in.Id = out.String()
+	s.Lock()
+	defer s.Unlock()
+	if s.productMap == nil {
+		s.productMap = make(map[string]*pb.Product)
+	}
+	s.productMap[in.Id] = in
+	log.Printf("New product added - ID : %s, Name : %s", in.Id, in.Name)
+	return &wrapperspb.StringValue{Value: in.Id}, nil
+}
+
+// GetProduct implements ecommerce.GetProduct
+func (s *productServer) GetProduct(ctx context.Context, in *wrapperspb.StringValue) (*pb.Product, error) {
+	s.RLock()
+	defer s.RUnlock()
+	value, exists := s.productMap[in.Value]
+	if exists {
+		log.Printf("New product retrieved - ID : %s", in)
+		return value, nil
+	}
+	return nil, rpcerrors.NotFound("Product", in.Value)
+}
+
+// orderServer is used to implement ecommerce/OrderMgmt.
+type orderServer struct {
+	pb.UnimplementedOrderManagementServer
+	sync.RWMutex
+	orderMap map[string]*pb.Order
+}
+
+// AddOrder implements ecommerce.AddOrder
+func (s *orderServer) AddOrder(ctx context.Context, orderReq *pb.Order) (*wrapperspb.StringValue, error) {
+	if orderReq.Id == "" || orderReq.Id == "-1" {
+		log.Printf("Order ID is invalid! -> Received Order ID %s", orderReq.Id)
+		// the BadRequest details of the offending field go on to the HTTP client through the gateway
+		return nil, rpcerrors.InvalidArgument("Invalid information received",
+			rpcerrors.FieldViolation("id", fmt.Sprintf("Order ID received is not valid %s : %s", orderReq.Id, orderReq.Description)))
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.orderMap[orderReq.Id] = orderReq
+	log.Println("Order : ", orderReq.Id, " -> Added")
+	return &wrapperspb.StringValue{Value: "Order Added: " + orderReq.Id}, nil
+}
+
+// GetOrder implements ecommerce.GetOrder
+func (s *orderServer) GetOrder(ctx context.Context, orderId *wrapperspb.StringValue) (*pb.Order, error) {
+	s.RLock()
+	defer s.RUnlock()
+	ord, found := s.orderMap[orderId.Value]
+	if !found {
+		return nil, rpcerrors.NotFound("Order", orderId.Value)
+	}
+	return ord, nil
+}
+
+// SearchOrders implements ecommerce.SearchOrders
+func (s *orderServer) SearchOrders(searchQuery *wrapperspb.StringValue, stream pb.OrderManagement_SearchOrdersServer) error {
+	span := trace.SpanFromContext(stream.Context())
+	s.RLock()
+	defer s.RUnlock()
+	for _, order := range s.orderMap {
+		for _, itemStr := range order.Items {
+			if strings.Contains(itemStr, searchQuery.Value) {
+				if err := stream.Send(order); err != nil {
+					return fmt.Errorf("error sending message to stream : %v", err)
+				}
+				// the order of the message event of the same id
+				span.AddEvent("order found", trace.WithAttributes(
+					orderIDKey.String(order.Id), attribute.Int64("message.id", tracer.Sent(stream.Context()))))
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// UpdateOrders implements ecommerce.UpdateOrders
+func (s *orderServer) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) error {
+	span := trace.SpanFromContext(stream.Context())
+	ordersStr := "Updated Order IDs : "
+	for {
+		order, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&wrapperspb.StringValue{Value: "Orders processed " + ordersStr})
+		}
+		if err != nil {
+			return err
+		}
+		s.Lock()
+		s.orderMap[order.Id] = order
+		s.Unlock()
+		span.AddEvent("order updated", trace.WithAttributes(
+			orderIDKey.String(order.Id), attribute.Int64("message.id", tracer.Received(stream.Context()))))
+		log.Printf("Order ID : %s - Updated", order.Id)
+		ordersStr += order.Id + ", "
+	}
+}
+
+// ProcessOrders implements ecommerce.ProcessOrders
+func (s *orderServer) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) error {
+	ctx := stream.Context()
+	batchMarker := 1
+	combinedShipmentMap := make(map[string]*pb.CombinedShipment)
+	// links to the messages of the client which ordered each shipment
+	shipmentLinks := make(map[string][]trace.Link)
+	for {
+		orderId, err := stream.Recv()
+		if err == io.EOF {
+			// Client has sent all the messages Send remaining shipments
+			for destination, shipment := range combinedShipmentMap {
+				if err := sendShipment(ctx, stream, shipment, shipmentLinks[destination]); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		s.RLock()
+		ord, found := s.orderMap[orderId.GetValue()]
+		s.RUnlock()
+		if !found {
+			return rpcerrors.NotFound("Order", orderId.GetValue())
+		}
+		shipment, found := combinedShipmentMap[ord.Destination]
+		if !found {
+			shipment = &pb.CombinedShipment{Id: "cmb - " + ord.Destination, Status: "Processed!"}
+			combinedShipmentMap[ord.Destination] = shipment
+		}
+		shipment.OrdersList = append(shipment.OrdersList, proto.Clone(ord).(*pb.Order))
+		shipmentLinks[ord.Destination] = append(shipmentLinks[ord.Destination], tracer.SenderLink(ctx, tracer.Received(ctx)))
+
+		if batchMarker == orderBatchSize {
+			for destination, comb := range combinedShipmentMap {
+				log.Printf("Shipping : %v -> %v", comb.Id, len(comb.OrdersList))
+				if err := sendShipment(ctx, stream, comb, shipmentLinks[destination]); err != nil {
+					return err
+				}
+			}
+			batchMarker = 0
+			combinedShipmentMap = make(map[string]*pb.CombinedShipment)
+			shipmentLinks = make(map[string][]trace.Link)
+		}
+		batchMarker++
+	}
+}
+
+// sendShipment sends a combined shipment in a span of its own, a child of the span of the
+// stream, linked to the messages of the client which ordered its orders.
+func sendShipment(ctx context.Context, stream pb.OrderManagement_ProcessOrdersServer, shipment *pb.CombinedShipment, links []trace.Link) error {
+	_, span := tr.Start(ctx, "ecommerce.server.ProcessOrders.shipment", trace.WithLinks(links...),
+		trace.WithAttributes(attribute.String("shipment.id", shipment.Id), attribute.Int("shipment.orders", len(shipment.OrdersList))))
+	defer span.End()
+	if err := stream.Send(shipment); err != nil {
+		span.SetStatus(otelcodes.Error, err.Error())
+		return err
+	}
+	return nil
+}
+
+func newOrderServer() *orderServer {
+	s := &orderServer{orderMap: make(map[string]*pb.Order)}
+	s.orderMap["101"] = &pb.Order{Id: "101", Items: []string{"Apple Mouse", "Mac Magic Keyboard"}, Destination: "Mountain View, CA", Price: 50.00}
+	s.orderMap["102"] = &pb.Order{Id: "102", Items: []string{"Google Pixel 3A", "Mac Book Pro"}, Destination: "Mountain View, CA", Price: 1800.00}
+	s.orderMap["103"] = &pb.Order{Id: "103", Items: []string{"Apple Watch S4"}, Destination: "San Jose, CA", Price: 400.00}
+	s.orderMap["104"] = &pb.Order{Id: "104", Items: []string{"Google Home Mini", "Google Nest Hub"}, Destination: "Mountain View, CA", Price: 400.00}
+	s.orderMap["105"] = &pb.Order{Id: "105", Items: []string{"Amazon Echo"}, Destination: "San Jose, CA", Price: 30.00}
+	s.orderMap["106"] = &pb.Order{Id: "106", Items: []string{"Amazon Echo", "Apple iPhone XS"}, Destination: "Mountain View, CA", Price: 300.00}
+	return s
+}
+
+func main() {
+	flag.Parse()
+
+	tp, err := tracer.Init(context.Background(), tracer.Config{
+		ServiceName:  "ecommerce.server",
+		Exporter:     *exporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: true,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	defer tp.Shutdown(context.Background())
+
+	lis, err := net.Listen("tcp", port)
+	if err != nil {
+		log.Fatalf("failed to listen: %v", err)
+	}
+	auditLog, err := audit.Open(*auditDir, *auditMaxSize)
+	if err != nil {
+		log.Fatalf("failed to open the audit log: %v", err)
+	}
+	defer auditLog.Close()
+	log.Printf("audit log %s, head %s", *auditDir, auditLog.Head())
+
+	// The calls of the gateway and of the gRPC-Web clients go through the same
+	// interceptors, they are audited too.
+	s := grpc.NewServer(
+		// a span for every call, with an event for every message of the streams
+		grpc.StatsHandler(tracer.NewServerHandler()),
+		// the audit records the errors the handlers return, before their localized
+		// messages in the languages of the accept-language metadata
+		grpc.ChainUnaryInterceptor(
+			audit.UnaryServerInterceptor(auditLog, auditedMethods...),
+			rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer),
+		),
+		grpc.ChainStreamInterceptor(
+			audit.StreamServerInterceptor(auditLog, auditedMethods...),
+			rpcerrors.StreamServerInterceptor(rpcerrors.DefaultLocalizer),
+		),
+	)
+	// Both services are multiplexed on the same gRPC server
+	pb.RegisterProductInfoServer(s, &productServer{})
+	pb.RegisterOrderManagementServer(s, newOrderServer())
+	// Register reflection service on gRPC server.
+	reflection.Register(s)
+	if *adminAddr != "" {
+		admin.Register(s)
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
+
+	// start the gRPC-Web server which translates browser calls to the gRPC server above
+	webServer := &http.Server{
+		Addr:    *webPort,
+		Handler: newGRPCWebHandler(s, strings.Split(*allowedOrigins, ",")),
+	}
+	go func() {
+		log.Printf("gRPC-Web server listening on %s", *webPort)
+		if err := webServer.ListenAndServe(); err != nil {
+			log.Fatalf("failed to serve gRPC-Web: %v", err)
+		}
+	}()
+
+	// stop on a signal, for the deferred calls to export the last spans
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		s.GracefulStop()
+	}()
+	log.Printf("gRPC server listening on %s", port)
+	if err := s.Serve(lis); err != nil {
+		log.Fatalf("failed to serve: %v", err)
+	}
+}
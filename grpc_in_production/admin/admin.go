@@ -0,0 +1,82 @@
+// Package admin exposes the channelz data of a process, the state of its gRPC servers
+// and channels as grpc-go records it: the channelz service for grpcdebug and the other
+// channelz clients, and an HTML page for a browser.
+//
+// A server registers the service next to its own, and serves the page on an admin port:
+//
+//	admin.Register(grpcServer)
+//	go admin.ListenAndServe(":8081")
+//
+// A client only serves the page, its channels are recorded once the package is imported,
+// and lingers on exit for the page to be read:
+//
+//	defer conn.Close()
+//	go admin.ListenAndServe(":8083")
+//	defer admin.Linger(":8083")
+//	... make calls ...
+//
+// Importing the package turns channelz on: the channels and the servers created before
+// are not recorded.
+package admin
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/channelz/service"
+)
+
+// Path is the path of the page on the admin HTTP server.
+const Path = "/channelz"
+
+// Register registers the channelz service (grpc.channelz.v1.Channelz) on s.
+func Register(s grpc.ServiceRegistrar) {
+	service.RegisterChannelzServiceToServer(s)
+}
+
+// ListenAndServe serves the page on addr, at Path and at /.
+func ListenAndServe(addr string) error {
+	return NewServer(addr).ListenAndServe()
+}
+
+// NewServer returns the HTTP server of the page on addr, at Path and at /, to serve
+// it over TLS or behind another handler.
+func NewServer(addr string) *http.Server {
+	mux := http.NewServeMux()
+	mux.Handle(Path, NewHandler())
+	mux.Handle("/", http.RedirectHandler(Path, http.StatusFound))
+	return &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+}
+
+// Linger blocks until SIGINT or SIGTERM: a client done with its calls keeps serving the
+// page on addr, its channels can still be looked at. Deferred after the Close of a
+// connection, it runs before it, and the page shows the channel still open.
+func Linger(addr string) {
+	log.Printf("serving the channelz page on %s%s, interrupt to exit", addr, Path)
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+}
+
+// registrar keeps the implementation of the service registered on it.
+type registrar struct {
+	impl interface{}
+}
+
+func (r *registrar) RegisterService(_ *grpc.ServiceDesc, impl interface{}) {
+	r.impl = impl
+}
+
+// newChannelz returns the implementation of the channelz service, called in process:
+// the page has no connection of its own to show.
+func newChannelz() channelzgrpc.ChannelzServer {
+	var r registrar
+	service.RegisterChannelzServiceToServer(&r)
+	return r.impl.(channelzgrpc.ChannelzServer)
+}
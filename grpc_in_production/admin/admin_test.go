@@ -0,0 +1,82 @@
+package admin
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc"
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// dialServer serves the health and the channelz services over TCP, and returns a
+// connection to them with its address.
+func dialServer(t *testing.T) (*grpc.ClientConn, string) {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := grpc.NewServer()
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	Register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn, lis.Addr().String()
+}
+
+func TestRegister(t *testing.T) {
+	conn, addr := dialServer(t)
+	resp, err := channelzpb.NewChannelzClient(conn).GetServers(context.Background(), &channelzpb.GetServersRequest{})
+	if err != nil {
+		t.Fatalf("GetServers failed: %v", err)
+	}
+	for _, s := range resp.Server {
+		for _, ls := range s.ListenSocket {
+			if ls.Name == addr {
+				return
+			}
+		}
+	}
+	t.Errorf("GetServers has no server listening on %s: %v", addr, resp)
+}
+
+// The page shows the server and the channel of a call, and the socket between them on
+// both sides.
+func TestHandler(t *testing.T) {
+	conn, addr := dialServer(t)
+	if _, err := healthpb.NewHealthClient(conn).Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+
+	rec := httptest.NewRecorder()
+	NewHandler().ServeHTTP(rec, httptest.NewRequest("GET", Path, nil))
+	if rec.Code != 200 {
+		t.Fatalf("GET %s = %d", Path, rec.Code)
+	}
+	body, _ := io.ReadAll(rec.Body)
+	page := string(body)
+	for _, want := range []string{
+		"<td>" + addr + " </td>", // the server, by its listen socket
+		"channel ",               // the ClientConn
+		addr + "</td>",           // the sockets of both sides
+		"<td>READY</td>",         // the state of the channel
+		"<td>1 / 1 / 0</td>",     // the streams of the sockets
+		"<td>1 / 1</td>",         // the messages of the sockets
+	} {
+		if !strings.Contains(page, want) {
+			t.Errorf("the page has no %q:\n%s", want, page)
+		}
+	}
+}
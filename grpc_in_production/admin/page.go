@@ -0,0 +1,295 @@
+package admin
+
+import (
+	"context"
+	"fmt"
+	"html/template"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	channelzpb "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// maxErrors is the number of trace events of warning or error severity shown by
+// channel, the most recent ones.
+const maxErrors = 5
+
+// Handler renders the channelz data of the process as an HTML page:
+//   - the servers, their calls and their connections, the server sockets
+//   - the top channels, the ClientConns, with their state, their calls and their last
+//     errors, and their subchannels with theirs
+//   - for every socket, its addresses, its streams (the active ones are started and
+//     neither succeeded nor failed), its messages, its keepalives and its flow control
+//     windows
+type Handler struct {
+	channelz channelzpb.ChannelzServer
+}
+
+// NewHandler returns the handler of the page.
+func NewHandler() *Handler {
+	return &Handler{channelz: newChannelz()}
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p, err := h.page(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := pageTemplate.Execute(w, p); err != nil {
+		log.Printf("failed to render the channelz page: %v", err)
+	}
+}
+
+type page struct {
+	Servers  []server
+	Channels []channel
+}
+
+type server struct {
+	*channelzpb.Server
+	Sockets []*channelzpb.Socket
+}
+
+type channel struct {
+	*channelzpb.Channel
+	Errors      []*channelzpb.ChannelTraceEvent
+	Subchannels []subchannel
+}
+
+type subchannel struct {
+	*channelzpb.Subchannel
+	Errors  []*channelzpb.ChannelTraceEvent
+	Sockets []*channelzpb.Socket
+}
+
+// page reads every server and top channel of the process, and their sockets.
+func (h *Handler) page(ctx context.Context) (*page, error) {
+	p := &page{}
+	for start := int64(0); ; {
+		resp, err := h.channelz.GetServers(ctx, &channelzpb.GetServersRequest{StartServerId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range resp.Server {
+			sockets, err := h.serverSockets(ctx, s.Ref.ServerId)
+			if err != nil {
+				return nil, err
+			}
+			p.Servers = append(p.Servers, server{Server: s, Sockets: sockets})
+			start = s.Ref.ServerId + 1
+		}
+		if resp.End || len(resp.Server) == 0 {
+			break
+		}
+	}
+	for start := int64(0); ; {
+		resp, err := h.channelz.GetTopChannels(ctx, &channelzpb.GetTopChannelsRequest{StartChannelId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range resp.Channel {
+			ch := channel{Channel: c, Errors: lastErrors(c.Data.GetTrace())}
+			for _, ref := range c.SubchannelRef {
+				sc, err := h.subchannel(ctx, ref.SubchannelId)
+				if err != nil {
+					return nil, err
+				}
+				if sc != nil {
+					ch.Subchannels = append(ch.Subchannels, *sc)
+				}
+			}
+			p.Channels = append(p.Channels, ch)
+			start = c.Ref.ChannelId + 1
+		}
+		if resp.End || len(resp.Channel) == 0 {
+			break
+		}
+	}
+	return p, nil
+}
+
+// serverSockets returns the connections accepted by a server.
+func (h *Handler) serverSockets(ctx context.Context, id int64) ([]*channelzpb.Socket, error) {
+	var sockets []*channelzpb.Socket
+	for start := int64(0); ; {
+		resp, err := h.channelz.GetServerSockets(ctx, &channelzpb.GetServerSocketsRequest{ServerId: id, StartSocketId: start})
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range resp.SocketRef {
+			s, err := h.socket(ctx, ref.SocketId)
+			if err != nil {
+				return nil, err
+			}
+			if s != nil {
+				sockets = append(sockets, s)
+			}
+			start = ref.SocketId + 1
+		}
+		if resp.End || len(resp.SocketRef) == 0 {
+			return sockets, nil
+		}
+	}
+}
+
+// subchannel returns a subchannel and its sockets, nil if it was closed since its
+// channel was read.
+func (h *Handler) subchannel(ctx context.Context, id int64) (*subchannel, error) {
+	resp, err := h.channelz.GetSubchannel(ctx, &channelzpb.GetSubchannelRequest{SubchannelId: id})
+	if err != nil {
+		return nil, ignoreNotFound(err)
+	}
+	sc := &subchannel{Subchannel: resp.Subchannel, Errors: lastErrors(resp.Subchannel.Data.GetTrace())}
+	for _, ref := range resp.Subchannel.SocketRef {
+		s, err := h.socket(ctx, ref.SocketId)
+		if err != nil {
+			return nil, err
+		}
+		if s != nil {
+			sc.Sockets = append(sc.Sockets, s)
+		}
+	}
+	return sc, nil
+}
+
+// socket returns a socket, nil if it was closed since its server or subchannel was read.
+func (h *Handler) socket(ctx context.Context, id int64) (*channelzpb.Socket, error) {
+	resp, err := h.channelz.GetSocket(ctx, &channelzpb.GetSocketRequest{SocketId: id})
+	if err != nil {
+		return nil, ignoreNotFound(err)
+	}
+	return resp.Socket, nil
+}
+
+// ignoreNotFound returns nil for the error of an entity closed between two reads, the
+// page shows what is still open.
+func ignoreNotFound(err error) error {
+	if status.Code(err) == codes.NotFound {
+		return nil
+	}
+	return err
+}
+
+// lastErrors returns the most recent trace events of warning or error severity, the
+// most recent first.
+func lastErrors(trace *channelzpb.ChannelTrace) []*channelzpb.ChannelTraceEvent {
+	var errors []*channelzpb.ChannelTraceEvent
+	events := trace.GetEvents()
+	for i := len(events) - 1; i >= 0 && len(errors) < maxErrors; i-- {
+		switch events[i].Severity {
+		case channelzpb.ChannelTraceEvent_CT_WARNING, channelzpb.ChannelTraceEvent_CT_ERROR:
+			errors = append(errors, events[i])
+		}
+	}
+	return errors
+}
+
+var pageTemplate = template.Must(template.New("channelz").Funcs(template.FuncMap{
+	"addr":   formatAddress,
+	"time":   formatTime,
+	"active": activeStreams,
+}).Parse(pageHTML))
+
+// formatAddress returns host:port for a TCP address, the path for a unix socket.
+func formatAddress(a *channelzpb.Address) string {
+	switch a := a.GetAddress().(type) {
+	case *channelzpb.Address_TcpipAddress:
+		return net.JoinHostPort(net.IP(a.TcpipAddress.IpAddress).String(), fmt.Sprint(a.TcpipAddress.Port))
+	case *channelzpb.Address_UdsAddress_:
+		return "unix:" + a.UdsAddress.Filename
+	case *channelzpb.Address_OtherAddress_:
+		return a.OtherAddress.Name
+	}
+	return "-"
+}
+
+func formatTime(ts *timestamppb.Timestamp) string {
+	if ts == nil || (ts.Seconds == 0 && ts.Nanos == 0) {
+		return "-"
+	}
+	t := ts.AsTime()
+	return fmt.Sprintf("%s (%s ago)", t.Local().Format(time.RFC3339), time.Since(t).Round(time.Millisecond))
+}
+
+func activeStreams(d *channelzpb.SocketData) int64 {
+	return d.GetStreamsStarted() - d.GetStreamsSucceeded() - d.GetStreamsFailed()
+}
+
+const pageHTML = `<!DOCTYPE html>
+<html>
+<head>
+<title>channelz</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin: 4px 0 16px 0; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+th { background: #eee; }
+.error { color: #b00; }
+</style>
+</head>
+<body>
+<h1>channelz</h1>
+
+{{define "sockets"}}
+<table>
+<tr><th>socket</th><th>local</th><th>remote</th><th>active streams</th><th>streams started / succeeded / failed</th>
+<th>messages sent / received</th><th>keepalives sent</th><th>last message sent</th><th>last message received</th>
+<th>flow control window local / remote</th></tr>
+{{range .}}
+<tr><td>{{.Ref.SocketId}}</td><td>{{addr .Local}}</td><td>{{addr .Remote}}</td><td>{{active .Data}}</td>
+<td>{{.Data.StreamsStarted}} / {{.Data.StreamsSucceeded}} / {{.Data.StreamsFailed}}</td>
+<td>{{.Data.MessagesSent}} / {{.Data.MessagesReceived}}</td><td>{{.Data.KeepAlivesSent}}</td>
+<td>{{time .Data.LastMessageSentTimestamp}}</td><td>{{time .Data.LastMessageReceivedTimestamp}}</td>
+<td>{{.Data.LocalFlowControlWindow.GetValue}} / {{.Data.RemoteFlowControlWindow.GetValue}}</td></tr>
+{{else}}
+<tr><td colspan="10">no connection</td></tr>
+{{end}}
+</table>
+{{end}}
+
+{{define "errors"}}
+{{range .}}<div class="error">{{time .Timestamp}} {{.Severity}}: {{.Description}}</div>{{end}}
+{{end}}
+
+<h2>Servers</h2>
+{{range .Servers}}
+<h3>server {{.Ref.ServerId}}</h3>
+<table>
+<tr><th>listening on</th><th>calls started / succeeded / failed</th><th>last call started</th><th>connections</th></tr>
+<tr><td>{{range .ListenSocket}}{{.Name}} {{end}}</td>
+<td>{{.Data.CallsStarted}} / {{.Data.CallsSucceeded}} / {{.Data.CallsFailed}}</td>
+<td>{{time .Data.LastCallStartedTimestamp}}</td><td>{{len .Sockets}}</td></tr>
+</table>
+{{template "sockets" .Sockets}}
+{{else}}
+<p>no server</p>
+{{end}}
+
+<h2>Channels</h2>
+{{range .Channels}}
+<h3>channel {{.Ref.ChannelId}} {{.Data.Target}}</h3>
+<table>
+<tr><th>state</th><th>calls started / succeeded / failed</th><th>last call started</th><th>subchannels</th></tr>
+<tr><td>{{.Data.State.GetState}}</td><td>{{.Data.CallsStarted}} / {{.Data.CallsSucceeded}} / {{.Data.CallsFailed}}</td>
+<td>{{time .Data.LastCallStartedTimestamp}}</td><td>{{len .Subchannels}}</td></tr>
+</table>
+{{template "errors" .Errors}}
+{{range .Subchannels}}
+<h4>subchannel {{.Ref.SubchannelId}} {{.Data.Target}}: {{.Data.State.GetState}},
+calls {{.Data.CallsStarted}} / {{.Data.CallsSucceeded}} / {{.Data.CallsFailed}}</h4>
+{{template "errors" .Errors}}
+{{template "sockets" .Sockets}}
+{{end}}
+{{else}}
+<p>no channel</p>
+{{end}}
+</body>
+</html>
+`
@@ -0,0 +1,22 @@
+package cost
+
+import (
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// UnaryClientInterceptor sets the caller metadata of the unary calls to caller.
+func UnaryClientInterceptor(caller string) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(metadata.AppendToOutgoingContext(ctx, CallerKey, caller), method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor sets the caller metadata of the streams to caller.
+func StreamClientInterceptor(caller string) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(metadata.AppendToOutgoingContext(ctx, CallerKey, caller), desc, cc, method, opts...)
+	}
+}
@@ -0,0 +1,253 @@
+// Package cost accounts for the cost of the calls of a server, by method and by caller:
+// the bytes on the wire and uncompressed, the compression ratio, the messages, and an
+// estimate of the CPU time. It is a stats handler, it sees every message of the streams
+// with its sizes before and after compression.
+//
+//	costs := cost.NewHandler(cost.DefaultMaxCallers)
+//	s := grpc.NewServer(grpc.StatsHandler(costs))
+//	costs.Register(s)         // the CostReport service, the report on demand
+//	reg.MustRegister(costs)   // the grpc_server_cost_* metrics
+//
+// The caller is the caller metadata of the calls, set by the clients with the
+// interceptors of this package. A caller is a label of the metrics: past maxCallers
+// distinct callers, the calls of the new ones are accounted together as "other".
+package cost
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+)
+
+const (
+	// CallerKey is the metadata key naming the caller of a call.
+	CallerKey = "caller"
+	// Unknown is the caller of the calls without caller metadata.
+	Unknown = "unknown"
+	// Other is the caller of the calls of the callers past maxCallers.
+	Other = "other"
+	// DefaultMaxCallers is the number of callers accounted separately by default.
+	DefaultMaxCallers = 50
+	// maxCallerLength truncates the callers, they are label values.
+	maxCallerLength = 64
+)
+
+// Handler is the server stats handler accounting for the cost of the calls. It is a
+// prometheus.Collector too, and serves the CostReport service.
+type Handler struct {
+	maxCallers int
+	since      time.Time
+	// cpuTime returns the CPU time of the process
+	cpuTime func() time.Duration
+
+	mu      sync.Mutex
+	callers map[string]bool
+	// the calls ended, by method and caller
+	usages map[key]*usage
+	// the calls in flight, and the CPU time of the process when their shares were last
+	// updated
+	inflight map[*call]bool
+	lastCPU  time.Duration
+}
+
+// NewHandler returns a handler accounting for maxCallers callers separately.
+func NewHandler(maxCallers int) *Handler {
+	return &Handler{
+		maxCallers: maxCallers,
+		since:      time.Now(),
+		cpuTime:    processCPUTime,
+		callers:    make(map[string]bool),
+		usages:     make(map[key]*usage),
+		inflight:   make(map[*call]bool),
+	}
+}
+
+type key struct {
+	method, caller string
+}
+
+// traffic is the messages of one direction.
+type traffic struct {
+	messages, wireBytes, compressedBytes, uncompressedBytes int64
+}
+
+func (t *traffic) add(o *traffic) {
+	t.messages += o.messages
+	t.wireBytes += o.wireBytes
+	t.compressedBytes += o.compressedBytes
+	t.uncompressedBytes += o.uncompressedBytes
+}
+
+// compressionRatio returns uncompressed / compressed, 1 without messages.
+func (t *traffic) compressionRatio() float64 {
+	if t.compressedBytes == 0 {
+		return 1
+	}
+	return float64(t.uncompressedBytes) / float64(t.compressedBytes)
+}
+
+type usage struct {
+	calls          int64
+	received, sent traffic
+	cpu            time.Duration
+}
+
+func (u *usage) add(o *usage) {
+	u.calls += o.calls
+	u.received.add(&o.received)
+	u.sent.add(&o.sent)
+	u.cpu += o.cpu
+}
+
+// call is the cost of a call in flight. Its messages are counted by the goroutines
+// receiving and sending them, its CPU time under the lock of the handler.
+type call struct {
+	key
+	received, sent direction
+	cpu            time.Duration
+}
+
+type direction struct {
+	messages, wireBytes, compressedBytes, uncompressedBytes atomic.Int64
+}
+
+func (d *direction) add(wire, compressed, uncompressed int) {
+	d.messages.Add(1)
+	d.wireBytes.Add(int64(wire))
+	d.compressedBytes.Add(int64(compressed))
+	d.uncompressedBytes.Add(int64(uncompressed))
+}
+
+func (d *direction) traffic() traffic {
+	return traffic{
+		messages:          d.messages.Load(),
+		wireBytes:         d.wireBytes.Load(),
+		compressedBytes:   d.compressedBytes.Load(),
+		uncompressedBytes: d.uncompressedBytes.Load(),
+	}
+}
+
+// usage returns the cost of c so far, as a single call.
+func (c *call) usage() *usage {
+	return &usage{calls: 1, received: c.received.traffic(), sent: c.sent.traffic(), cpu: c.cpu}
+}
+
+type callKey struct{}
+
+// TagRPC starts accounting for a call. The metadata of the call is already in ctx.
+func (h *Handler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	return context.WithValue(ctx, callKey{}, &call{key: key{method: info.FullMethodName, caller: h.caller(ctx)}})
+}
+
+// HandleRPC counts the messages of the call, and its CPU time from its beginning to its
+// end.
+func (h *Handler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	c, ok := ctx.Value(callKey{}).(*call)
+	if !ok || s.IsClient() {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.Begin:
+		h.mu.Lock()
+		h.shareCPU()
+		h.inflight[c] = true
+		h.mu.Unlock()
+	case *stats.InPayload:
+		c.received.add(s.WireLength, s.CompressedLength, s.Length)
+	case *stats.OutPayload:
+		c.sent.add(s.WireLength, s.CompressedLength, s.Length)
+	case *stats.End:
+		h.mu.Lock()
+		h.shareCPU()
+		delete(h.inflight, c)
+		u, ok := h.usages[c.key]
+		if !ok {
+			u = &usage{}
+			h.usages[c.key] = u
+		}
+		u.add(c.usage())
+		h.mu.Unlock()
+	}
+}
+
+func (h *Handler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context { return ctx }
+
+func (h *Handler) HandleConn(context.Context, stats.ConnStats) {}
+
+// shareCPU shares the CPU time of the process since the last call out between the calls
+// in flight, evenly: a call gets a share of the CPU time of the process while it is in
+// flight, whatever it spent it on. h.mu is held.
+func (h *Handler) shareCPU() {
+	now := h.cpuTime()
+	if n := len(h.inflight); n > 0 {
+		share := (now - h.lastCPU) / time.Duration(n)
+		for c := range h.inflight {
+			c.cpu += share
+		}
+	}
+	h.lastCPU = now
+}
+
+// caller returns the caller of the call of ctx, Other past maxCallers.
+func (h *Handler) caller(ctx context.Context) string {
+	name := Unknown
+	if v := metadata.ValueFromIncomingContext(ctx, CallerKey); len(v) > 0 && v[0] != "" {
+		name = v[0]
+	}
+	// a label value is valid UTF-8, the caller is cut on a rune
+	name = strings.ToValidUTF8(name, "")
+	for len(name) > maxCallerLength {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" {
+		name = Unknown
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.callers[name] {
+		return name
+	}
+	if len(h.callers) >= h.maxCallers {
+		return Other
+	}
+	h.callers[name] = true
+	return name
+}
+
+// snapshot returns the usages, the calls in flight included, by method and caller.
+func (h *Handler) snapshot() map[key]*usage {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.shareCPU()
+	usages := make(map[key]*usage, len(h.usages))
+	for k, u := range h.usages {
+		c := *u
+		usages[k] = &c
+	}
+	for c := range h.inflight {
+		u, ok := usages[c.key]
+		if !ok {
+			u = &usage{}
+			usages[c.key] = u
+		}
+		u.add(c.usage())
+	}
+	return usages
+}
+
+// splitMethod returns the service and the method of a full method name,
+// "/ecommerce.OrderManagement/updateOrders".
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.Index(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
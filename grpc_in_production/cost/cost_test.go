@@ -0,0 +1,212 @@
+package cost
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"cost/costpb"
+)
+
+// echoDesc is a bidi stream echoing every message it receives.
+var echoDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Echo",
+		Handler: func(_ interface{}, stream grpc.ServerStream) error {
+			for {
+				m := new(wrapperspb.StringValue)
+				if err := stream.RecvMsg(m); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if err := stream.SendMsg(m); err != nil {
+					return err
+				}
+			}
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+// The report has the messages of a gzip compressed stream, by caller: their sizes on
+// the wire, compressed and uncompressed.
+func TestHandler_Report(t *testing.T) {
+	h := NewHandler(DefaultMaxCallers)
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StatsHandler(h))
+	s.RegisterService(&echoDesc, struct{}{})
+	h.Register(s)
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(UnaryClientInterceptor("storefront")),
+		grpc.WithStreamInterceptor(StreamClientInterceptor("storefront")))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := conn.NewStream(context.Background(), &echoDesc.Streams[0], "/test.Echo/Echo", grpc.UseCompressor(gzip.Name))
+	if err != nil {
+		t.Fatalf("NewStream failed: %v", err)
+	}
+	m := wrapperspb.String(strings.Repeat("Google Pixel 3A ", 64))
+	for i := 0; i < 3; i++ {
+		if err := stream.SendMsg(m); err != nil {
+			t.Fatalf("SendMsg failed: %v", err)
+		}
+	}
+	stream.CloseSend()
+	for {
+		if err := stream.RecvMsg(new(wrapperspb.StringValue)); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("RecvMsg failed: %v", err)
+		}
+	}
+
+	// the server counts its last message once sent, after the client received it
+	var u *costpb.Usage
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		report, err := costpb.NewCostReportClient(conn).GetReport(context.Background(), &costpb.ReportRequest{Method: "/test.Echo/Echo"})
+		if err != nil {
+			t.Fatalf("GetReport failed: %v", err)
+		}
+		if len(report.Usages) != 1 {
+			t.Fatalf("GetReport has %d usages, want 1: %v", len(report.Usages), report)
+		}
+		u = report.Usages[0]
+		if u.Sent.Messages == 3 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if u.Caller != "storefront" || u.Calls != 1 {
+		t.Errorf("usage of %q with %d calls, want storefront with 1", u.Caller, u.Calls)
+	}
+	size := int64(3 * proto.Size(m))
+	for _, tr := range []*costpb.Traffic{u.Received, u.Sent} {
+		if tr.Messages != 3 || tr.UncompressedBytes != size {
+			t.Errorf("traffic of %d messages of %d bytes, want 3 of %d", tr.Messages, tr.UncompressedBytes, size)
+		}
+		// a gRPC frame header of 5 bytes by message
+		if tr.WireBytes != tr.CompressedBytes+3*5 {
+			t.Errorf("traffic of %d bytes on the wire, %d compressed", tr.WireBytes, tr.CompressedBytes)
+		}
+		if tr.CompressionRatio < 5 {
+			t.Errorf("compression ratio %.2f, want a repeated string compressed", tr.CompressionRatio)
+		}
+	}
+}
+
+// incoming returns the context of a call with the caller metadata, none if empty.
+func incoming(caller string) context.Context {
+	if caller == "" {
+		return context.Background()
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(CallerKey, caller))
+}
+
+func TestHandler_Callers(t *testing.T) {
+	h := NewHandler(2)
+	for _, c := range []struct {
+		caller, want string
+	}{
+		{"storefront", "storefront"},
+		{"", Unknown},
+		{"billing", Other},
+		{"storefront", "storefront"},
+		{strings.Repeat("x", 100), Other},
+	} {
+		ctx := h.TagRPC(incoming(c.caller), &stats.RPCTagInfo{FullMethodName: "/test.Echo/Echo"})
+		if got := ctx.Value(callKey{}).(*call).caller; got != c.want {
+			t.Errorf("caller %q accounted as %q, want %q", c.caller, got, c.want)
+		}
+	}
+}
+
+// The callers and the methods sent by the clients can't make the metrics invalid:
+// Gather fails, or panics in a collector, on a label value which isn't UTF-8.
+func TestHandler_InvalidUTF8(t *testing.T) {
+	h := NewHandler(DefaultMaxCallers)
+	for _, c := range []struct {
+		caller, want string
+	}{
+		// cut in the middle of the é
+		{strings.Repeat("a", maxCallerLength-1) + "é", strings.Repeat("a", maxCallerLength-1)},
+		{"caf\xe9", "caf"},
+		{"\xff\xfe", Unknown},
+	} {
+		ctx := h.TagRPC(incoming(c.caller), &stats.RPCTagInfo{FullMethodName: "/test.Echo/Echo"})
+		h.HandleRPC(ctx, &stats.Begin{})
+		if got := ctx.Value(callKey{}).(*call).caller; got != c.want {
+			t.Errorf("caller %q accounted as %q, want %q", c.caller, got, c.want)
+		}
+	}
+	// the series of an invalid method are left out
+	h.HandleRPC(h.TagRPC(incoming("storefront"), &stats.RPCTagInfo{FullMethodName: "/test.Echo/\xff"}), &stats.Begin{})
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(h)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != "grpc_server_cost_calls_total" {
+			continue
+		}
+		if n := len(mf.Metric); n != 3 {
+			t.Errorf("%d series of grpc_server_cost_calls_total, want those of the 3 callers of test.Echo/Echo", n)
+		}
+	}
+}
+
+// Two calls in flight share the CPU time of the process evenly.
+func TestHandler_CPU(t *testing.T) {
+	h := NewHandler(DefaultMaxCallers)
+	var cpu time.Duration
+	h.cpuTime = func() time.Duration { return cpu }
+	info := &stats.RPCTagInfo{FullMethodName: "/ecommerce.OrderManagement/processOrders"}
+	a := h.TagRPC(incoming("storefront"), info)
+	b := h.TagRPC(incoming("billing"), info)
+
+	h.HandleRPC(a, &stats.Begin{})
+	cpu = 10 * time.Millisecond // a alone
+	h.HandleRPC(b, &stats.Begin{})
+	cpu = 30 * time.Millisecond // a and b
+	h.HandleRPC(a, &stats.End{})
+	cpu = 40 * time.Millisecond // b alone, still in flight
+
+	want := `
+		# HELP grpc_server_cost_cpu_seconds_total Estimated CPU time of the calls, their share of the CPU time of the process while in flight.
+		# TYPE grpc_server_cost_cpu_seconds_total counter
+		grpc_server_cost_cpu_seconds_total{caller="billing",grpc_method="processOrders",grpc_service="ecommerce.OrderManagement"} 0.02
+		grpc_server_cost_cpu_seconds_total{caller="storefront",grpc_method="processOrders",grpc_service="ecommerce.OrderManagement"} 0.02
+	`
+	if err := testutil.CollectAndCompare(h, strings.NewReader(want), "grpc_server_cost_cpu_seconds_total"); err != nil {
+		t.Error(err)
+	}
+}
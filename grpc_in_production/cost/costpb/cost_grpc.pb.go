@@ -0,0 +1,105 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             (unknown)
+// source: cost/cost.proto
+
+package costpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// CostReportClient is the client API for CostReport service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type CostReportClient interface {
+	GetReport(ctx context.Context, in *ReportRequest, opts ...grpc.CallOption) (*Report, error)
+}
+
+type costReportClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewCostReportClient(cc grpc.ClientConnInterface) CostReportClient {
+	return &costReportClient{cc}
+}
+
+func (c *costReportClient) GetReport(ctx context.Context, in *ReportRequest, opts ...grpc.CallOption) (*Report, error) {
+	out := new(Report)
+	err := c.cc.Invoke(ctx, "/cost.CostReport/getReport", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// CostReportServer is the server API for CostReport service.
+// All implementations must embed UnimplementedCostReportServer
+// for forward compatibility
+type CostReportServer interface {
+	GetReport(context.Context, *ReportRequest) (*Report, error)
+	mustEmbedUnimplementedCostReportServer()
+}
+
+// UnimplementedCostReportServer must be embedded to have forward compatible implementations.
+type UnimplementedCostReportServer struct {
+}
+
+func (UnimplementedCostReportServer) GetReport(context.Context, *ReportRequest) (*Report, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetReport not implemented")
+}
+func (UnimplementedCostReportServer) mustEmbedUnimplementedCostReportServer() {}
+
+// UnsafeCostReportServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to CostReportServer will
+// result in compilation errors.
+type UnsafeCostReportServer interface {
+	mustEmbedUnimplementedCostReportServer()
+}
+
+func RegisterCostReportServer(s grpc.ServiceRegistrar, srv CostReportServer) {
+	s.RegisterService(&CostReport_ServiceDesc, srv)
+}
+
+func _CostReport_GetReport_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ReportRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(CostReportServer).GetReport(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/cost.CostReport/getReport",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(CostReportServer).GetReport(ctx, req.(*ReportRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// CostReport_ServiceDesc is the grpc.ServiceDesc for CostReport service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var CostReport_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "cost.CostReport",
+	HandlerType: (*CostReportServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "getReport",
+			Handler:    _CostReport_GetReport_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "cost/cost.proto",
+}
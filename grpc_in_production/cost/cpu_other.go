@@ -0,0 +1,10 @@
+//go:build !unix
+
+package cost
+
+import "time"
+
+// processCPUTime returns 0, the CPU time of the calls is not accounted.
+func processCPUTime() time.Duration {
+	return 0
+}
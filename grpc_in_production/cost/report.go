@@ -0,0 +1,117 @@
+package cost
+
+import (
+	"context"
+	"sort"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"cost/costpb"
+)
+
+// The directions of the traffic metrics.
+const (
+	Received = "received"
+	Sent     = "sent"
+)
+
+var (
+	labels           = []string{"grpc_service", "grpc_method", "caller"}
+	trafficLabels    = []string{"grpc_service", "grpc_method", "caller", "direction"}
+	callsDesc        = prometheus.NewDesc("grpc_server_cost_calls_total", "Number of calls, in flight included.", labels, nil)
+	messagesDesc     = prometheus.NewDesc("grpc_server_cost_messages_total", "Number of messages.", trafficLabels, nil)
+	wireBytesDesc    = prometheus.NewDesc("grpc_server_cost_wire_bytes_total", "Bytes of the messages on the wire, compressed and with their gRPC framing.", trafficLabels, nil)
+	uncompressedDesc = prometheus.NewDesc("grpc_server_cost_uncompressed_bytes_total", "Bytes of the messages before compression.", trafficLabels, nil)
+	ratioDesc        = prometheus.NewDesc("grpc_server_cost_compression_ratio", "Uncompressed bytes divided by compressed bytes of the messages, 1 without compression.", trafficLabels, nil)
+	cpuDesc          = prometheus.NewDesc("grpc_server_cost_cpu_seconds_total", "Estimated CPU time of the calls, their share of the CPU time of the process while in flight.", labels, nil)
+)
+
+func (h *Handler) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{callsDesc, messagesDesc, wireBytesDesc, uncompressedDesc, ratioDesc, cpuDesc} {
+		ch <- d
+	}
+}
+
+// Collect collects the grpc_server_cost_* metrics, the calls in flight included.
+func (h *Handler) Collect(ch chan<- prometheus.Metric) {
+	for k, u := range h.snapshot() {
+		service, method := splitMethod(k.method)
+		collect(ch, callsDesc, prometheus.CounterValue, float64(u.calls), service, method, k.caller)
+		collect(ch, cpuDesc, prometheus.CounterValue, u.cpu.Seconds(), service, method, k.caller)
+		for _, t := range []struct {
+			direction string
+			*traffic
+		}{{Received, &u.received}, {Sent, &u.sent}} {
+			collect(ch, messagesDesc, prometheus.CounterValue, float64(t.messages), service, method, k.caller, t.direction)
+			collect(ch, wireBytesDesc, prometheus.CounterValue, float64(t.wireBytes), service, method, k.caller, t.direction)
+			collect(ch, uncompressedDesc, prometheus.CounterValue, float64(t.uncompressedBytes), service, method, k.caller, t.direction)
+			collect(ch, ratioDesc, prometheus.GaugeValue, t.compressionRatio(), service, method, k.caller, t.direction)
+		}
+	}
+}
+
+// collect sends the metric, none if its labels are invalid: the method names come from
+// the clients, and a panic in Collect would take the whole process down.
+func collect(ch chan<- prometheus.Metric, desc *prometheus.Desc, valueType prometheus.ValueType, value float64, labels ...string) {
+	m, err := prometheus.NewConstMetric(desc, valueType, value, labels...)
+	if err != nil {
+		return
+	}
+	ch <- m
+}
+
+// Register registers the CostReport service on s.
+func (h *Handler) Register(s grpc.ServiceRegistrar) {
+	costpb.RegisterCostReportServer(s, &reportServer{h: h})
+}
+
+type reportServer struct {
+	costpb.UnimplementedCostReportServer
+	h *Handler
+}
+
+// GetReport returns the usages, the costliest first.
+func (s *reportServer) GetReport(ctx context.Context, req *costpb.ReportRequest) (*costpb.Report, error) {
+	report := &costpb.Report{Since: timestamppb.New(s.h.since)}
+	for k, u := range s.h.snapshot() {
+		if (req.Method != "" && req.Method != k.method) || (req.Caller != "" && req.Caller != k.caller) {
+			continue
+		}
+		report.Usages = append(report.Usages, &costpb.Usage{
+			Method:   k.method,
+			Caller:   k.caller,
+			Calls:    u.calls,
+			Received: trafficpb(&u.received),
+			Sent:     trafficpb(&u.sent),
+			CpuTime:  durationpb.New(u.cpu),
+		})
+	}
+	sort.Slice(report.Usages, func(i, j int) bool {
+		a, b := report.Usages[i], report.Usages[j]
+		if wa, wb := wireBytes(a), wireBytes(b); wa != wb {
+			return wa > wb
+		}
+		return a.Method+a.Caller < b.Method+b.Caller
+	})
+	if req.Top > 0 && int(req.Top) < len(report.Usages) {
+		report.Usages = report.Usages[:req.Top]
+	}
+	return report, nil
+}
+
+func wireBytes(u *costpb.Usage) int64 {
+	return u.Received.WireBytes + u.Sent.WireBytes
+}
+
+func trafficpb(t *traffic) *costpb.Traffic {
+	return &costpb.Traffic{
+		Messages:          t.messages,
+		WireBytes:         t.wireBytes,
+		CompressedBytes:   t.compressedBytes,
+		UncompressedBytes: t.uncompressedBytes,
+		CompressionRatio:  t.compressionRatio(),
+	}
+}
@@ -1,9 +1,12 @@
 package main
 
 import (
+	"admin"
 	"context"
+	"flag"
 	"log"
 	"os"
+	"rpcerrors"
 	"time"
 
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
@@ -15,6 +18,8 @@ import (
 //	address = "localhost:50051"
 //)
 
+var adminAddr = flag.String("admin", "", "address of the channelz page with the channel of the client, e.g. :8083, served until interrupted; off if empty")
+
 func getHostName() string {
 	hostname := os.Getenv("hostname")
 	if hostname == "" {
@@ -26,12 +31,17 @@ func getHostName() string {
 }
 
 func main() {
+	flag.Parse()
 	// Set up a connection to the server.
 	conn, err := grpc.Dial(getHostName(), grpc.WithInsecure())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
+	if *adminAddr != "" {
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+		defer admin.Linger(*adminAddr)
+	}
 	c := pb.NewProductInfoClient(conn)
 
 	// Contact the server and print out its response.
@@ -48,7 +58,7 @@ func main() {
 
 	product, err := c.GetProduct(ctx, &wrapper.StringValue{Value: r.Value})
 	if err != nil {
-		log.Fatalf("Could not get product: %v", err)
+		log.Fatalf("Could not get product: %s", rpcerrors.Decode(err))
 	}
-	log.Printf("Product: ", product.String())
+	log.Printf("Product: %s", product.String())
 }
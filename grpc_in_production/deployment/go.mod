@@ -3,11 +3,13 @@ module grpc_prod
 go 1.20
 
 require (
+	admin v0.0.0-00010101000000-000000000000
 	github.com/golang/mock v1.6.0
 	github.com/golang/protobuf v1.5.3
 	github.com/google/uuid v1.3.0
 	google.golang.org/grpc v1.55.0
 	google.golang.org/protobuf v1.30.0
+	rpcerrors v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -16,3 +18,7 @@ require (
 	golang.org/x/text v0.8.0 // indirect
 	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
 )
+
+replace admin => ../admin
+
+replace rpcerrors => ../rpcerrors
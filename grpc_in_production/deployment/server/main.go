@@ -6,10 +6,12 @@
 package main
 
 import (
+	"admin"
 	"context"
-	"errors"
+	"flag"
 	"log"
 	"net"
+	"rpcerrors"
 
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/google/uuid"
@@ -23,6 +25,9 @@ const (
 	port = ":50051"
 )
 
+// the admin port is not exposed by the Service, reach it with kubectl port-forward
+var adminAddr = flag.String("admin", "", "address of the channelz page, e.g. :8081, the channelz service is registered too; off if empty")
+
 // server is used to implement ecommerce/product_info.
 type server struct {
 	sync.RWMutex
@@ -56,18 +61,24 @@ func (s *server) GetProduct(ctx context.Context, in *wrapper.StringValue) (*pb.P
 		return value, nil
 	}
 
-	return nil, errors.New("Product does not exist for the ID" + in.Value)
+	return nil, rpcerrors.NotFound("Product", in.Value)
 }
 
 func main() {
+	flag.Parse()
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	s := grpc.NewServer()
+	// the messages of the errors in the languages of the accept-language metadata
+	s := grpc.NewServer(grpc.UnaryInterceptor(rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer)))
 	pb.RegisterProductInfoServer(s, &server{})
 	// Register reflection service on gRPC server.
 	reflection.Register(s)
+	if *adminAddr != "" {
+		admin.Register(s)
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
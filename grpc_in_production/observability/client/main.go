@@ -1,11 +1,14 @@
 package main
 
 import (
+	"admin"
 	"context"
+	"flag"
 	"fmt"
 	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"io"
 	"log"
 	"net/http"
 	"os"
@@ -13,11 +16,14 @@ import (
 
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
 	"google.golang.org/grpc"
-	pb "grpc_prod/proto-gen"
+	pb "observability/proto-gen"
 )
 
 const port = ":50051"
 
+// the page is served with the client metrics, on port 9094
+var enableAdmin = flag.Bool("admin", false, "serve the channelz page on "+admin.Path+" until interrupted")
+
 func getHostName() string {
 	hostname := os.Getenv("hostname")
 	if hostname == "" {
@@ -29,6 +35,7 @@ func getHostName() string {
 }
 
 func main() {
+	flag.Parse()
 	// Creates a metrics registry. Similar to server code, this holds all
 	// data collectors registered in the system
 	reg := prometheus.NewRegistry()
@@ -42,6 +49,7 @@ func main() {
 	conn, err := grpc.Dial(
 		getHostName(),
 		grpc.WithUnaryInterceptor(grpcMetrics.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(grpcMetrics.StreamClientInterceptor()),
 		grpc.WithInsecure(),
 	)
 	if err != nil {
@@ -50,9 +58,15 @@ func main() {
 	defer conn.Close()
 	c := pb.NewProductInfoClient(conn)
 
-	// Create a HTTP server for prometheus.
+	// Create a HTTP server for prometheus, and for the channelz page of the client.
+	mux := http.NewServeMux()
+	mux.Handle("/", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	if *enableAdmin {
+		mux.Handle(admin.Path, admin.NewHandler())
+		defer admin.Linger(":9094")
+	}
 	httpServer := &http.Server{
-		Handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{}),
+		Handler: mux,
 		Addr:    fmt.Sprintf("0.0.0.0:%d", 9094),
 	}
 
@@ -79,5 +93,51 @@ func main() {
 	if err != nil {
 		log.Fatalf("Could not get product: %v", err)
 	}
-	log.Printf("Product: ", product.String())
+	log.Printf("Product: %s", product.String())
+
+	processOrders(ctx, pb.NewOrderManagementClient(conn))
+}
+
+// processOrders adds an order, searches the orders and processes some of them, for the
+// order metrics of the server.
+func processOrders(ctx context.Context, c pb.OrderManagementClient) {
+	order := &pb.Order{Id: "107", Items: []string{"Sumsung S10"}, Destination: "San Jose, CA", Price: 700}
+	if _, err := c.AddOrder(ctx, order); err != nil {
+		log.Fatalf("Could not add order: %v", err)
+	}
+	search, err := c.SearchOrders(ctx, &wrapper.StringValue{Value: "Google"})
+	if err != nil {
+		log.Fatalf("Could not search orders: %v", err)
+	}
+	for {
+		found, err := search.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Could not search orders: %v", err)
+		}
+		log.Printf("Search result: %s", found.Id)
+	}
+
+	process, err := c.ProcessOrders(ctx)
+	if err != nil {
+		log.Fatalf("Could not process orders: %v", err)
+	}
+	for _, id := range []string{"101", "102", "103", "104", "107"} {
+		if err := process.Send(&wrapper.StringValue{Value: id}); err != nil {
+			log.Fatalf("Could not send order %s: %v", id, err)
+		}
+	}
+	process.CloseSend()
+	for {
+		shipment, err := process.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Fatalf("Could not process orders: %v", err)
+		}
+		log.Printf("Combined shipment %s: %d orders", shipment.Id, len(shipment.OrdersList))
+	}
 }
@@ -0,0 +1,37 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// TraceIDLabel is the label of the exemplars holding the trace ID of the observation.
+const TraceIDLabel = "trace_id"
+
+// Exemplar returns the labels of the exemplar of an observation made in ctx: the trace
+// ID of the active span, or nil when the span is not sampled, its trace is not exported
+// and the exemplar would point to nothing.
+//
+// The span is the one started by the stats handlers of the tracing package, or by any
+// OpenTelemetry instrumentation run before the interceptors.
+func Exemplar(ctx context.Context) prometheus.Labels {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsSampled() {
+		return nil
+	}
+	return prometheus.Labels{TraceIDLabel: sc.TraceID().String()}
+}
+
+// observe observes v with the exemplar of ctx, if any. The exemplars are only served in
+// the OpenMetrics format.
+func observe(ctx context.Context, o prometheus.Observer, v float64) {
+	if labels := Exemplar(ctx); labels != nil {
+		if eo, ok := o.(prometheus.ExemplarObserver); ok {
+			eo.ObserveWithExemplar(v, labels)
+			return
+		}
+	}
+	o.Observe(v)
+}
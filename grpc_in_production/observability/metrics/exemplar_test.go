@@ -0,0 +1,71 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+)
+
+func spanContext(flags trace.TraceFlags) context.Context {
+	return trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: flags,
+	}))
+}
+
+// scrape returns the metrics of reg in the format negotiated by accept.
+func scrape(t *testing.T, reg *prometheus.Registry, accept string) string {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Accept", accept)
+	rec := httptest.NewRecorder()
+	promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true}).ServeHTTP(rec, req)
+	body, _ := io.ReadAll(rec.Body)
+	return string(body)
+}
+
+func TestHandlingTime_Exemplar(t *testing.T) {
+	m := NewHandlingTime()
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(m)
+	interceptor := m.UnaryServerInterceptor()
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) { return req, nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/ecommerce.OrderManagement/getOrder"}
+
+	if _, err := interceptor(spanContext(trace.FlagsSampled), nil, info, handler); err != nil {
+		t.Fatalf("interceptor failed: %v", err)
+	}
+	// the exemplar is on the bucket of the observation
+	exemplar := regexp.MustCompile(`(?m)^grpc_server_handling_seconds_bucket\{grpc_method="getOrder",grpc_service="ecommerce.OrderManagement",grpc_type="unary",le="[^"]+"\} 1 # \{trace_id="4bf92f3577b34da6a3ce929d0e0e4736"\} `)
+	if got := scrape(t, reg, "application/openmetrics-text; version=0.0.1"); !exemplar.MatchString(got) {
+		t.Errorf("OpenMetrics scrape has no trace_id exemplar:\n%s", got)
+	}
+	// the text format has no exemplars
+	if got := scrape(t, reg, "text/plain"); strings.Contains(got, "trace_id") {
+		t.Errorf("text scrape has exemplars:\n%s", got)
+	}
+}
+
+// The trace of a span not sampled is not exported, its ID makes no exemplar.
+func TestExemplar_NotSampled(t *testing.T) {
+	if labels := Exemplar(spanContext(0)); labels != nil {
+		t.Errorf("Exemplar of a span not sampled = %v, want nil", labels)
+	}
+	if labels := Exemplar(context.Background()); labels != nil {
+		t.Errorf("Exemplar without span = %v, want nil", labels)
+	}
+	labels := Exemplar(spanContext(trace.FlagsSampled))
+	if got := labels[TraceIDLabel]; got != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Exemplar of a sampled span has trace_id %q", got)
+	}
+}
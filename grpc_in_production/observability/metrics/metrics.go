@@ -0,0 +1,171 @@
+// Package metrics holds the Prometheus metrics of the servers: the gRPC metrics of
+// go-grpc-prometheus, the handling time histograms, the number of messages of each
+// stream, and the domain metrics of the orders.
+//
+// The histograms attach the trace ID of the active span to their observations as
+// exemplars, served by promhttp in the OpenMetrics format, so that a dashboard links a
+// latency bucket to a trace.
+//
+// The labels only take a bounded set of values, the gRPC service and method names and
+// the few values of the label constants, never a value sent by a client such as a
+// product name or an order ID.
+package metrics
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+)
+
+// HandlingTimeBuckets are the buckets of the handling time histograms, in seconds, from
+// 1ms to 10s.
+var HandlingTimeBuckets = []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewServerMetrics returns the go-grpc-prometheus server metrics, the counters of the
+// calls and of their messages. Install both of its interceptors: the stream one counts
+// the messages of the streams as well. Its handling time histograms are left disabled,
+// they have no exemplars: HandlingTime replaces them.
+func NewServerMetrics() *grpc_prometheus.ServerMetrics {
+	return grpc_prometheus.NewServerMetrics()
+}
+
+// HandlingTime observes the handling time of the calls, the grpc_server_handling_seconds
+// histograms of go-grpc-prometheus with the trace ID of the call as exemplar.
+type HandlingTime struct {
+	seconds *prometheus.HistogramVec
+}
+
+// NewHandlingTime returns the grpc_server_handling_seconds histograms, by type, service
+// and method, in HandlingTimeBuckets.
+func NewHandlingTime() *HandlingTime {
+	return &HandlingTime{seconds: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_handling_seconds",
+		Help:    "Histogram of response latency (seconds) of gRPC that had been application-level handled by the server.",
+		Buckets: HandlingTimeBuckets,
+	}, []string{"grpc_type", "grpc_service", "grpc_method"})}
+}
+
+func (m *HandlingTime) Describe(ch chan<- *prometheus.Desc) { m.seconds.Describe(ch) }
+
+func (m *HandlingTime) Collect(ch chan<- prometheus.Metric) { m.seconds.Collect(ch) }
+
+// UnaryServerInterceptor observes the handling time of the unary calls. Install it
+// after the interceptor or the stats handler starting the spans.
+func (m *HandlingTime) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		service, method := splitMethod(info.FullMethod)
+		observe(ctx, m.seconds.WithLabelValues(Unary, service, method), time.Since(start).Seconds())
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor observes the handling time of the streams, from their start
+// to the return of their handler.
+func (m *HandlingTime) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		err := handler(srv, ss)
+		service, method := splitMethod(info.FullMethod)
+		observe(ss.Context(), m.seconds.WithLabelValues(streamType(info), service, method), time.Since(start).Seconds())
+		return err
+	}
+}
+
+// Types of calls, the values of the grpc_type label as go-grpc-prometheus sets them.
+const (
+	Unary        = "unary"
+	ClientStream = "client_stream"
+	ServerStream = "server_stream"
+	BidiStream   = "bidi_stream"
+)
+
+func streamType(info *grpc.StreamServerInfo) string {
+	switch {
+	case info.IsClientStream && info.IsServerStream:
+		return BidiStream
+	case info.IsClientStream:
+		return ClientStream
+	default:
+		return ServerStream
+	}
+}
+
+// Message directions, the values of the direction label of StreamMessages.
+const (
+	Received = "received"
+	Sent     = "sent"
+)
+
+// StreamMessages observes the number of messages of each stream when it ends, where
+// go-grpc-prometheus only counts the messages of all the streams.
+type StreamMessages struct {
+	messages *prometheus.HistogramVec
+}
+
+// NewStreamMessages returns the grpc_server_stream_messages histograms, by method and
+// direction.
+func NewStreamMessages() *StreamMessages {
+	return &StreamMessages{messages: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "grpc_server_stream_messages",
+		Help:    "Number of messages received or sent by a stream, observed when it ends.",
+		Buckets: prometheus.ExponentialBuckets(1, 2, 10),
+	}, []string{"grpc_service", "grpc_method", "direction"})}
+}
+
+func (m *StreamMessages) Describe(ch chan<- *prometheus.Desc) { m.messages.Describe(ch) }
+
+func (m *StreamMessages) Collect(ch chan<- prometheus.Metric) { m.messages.Collect(ch) }
+
+// StreamServerInterceptor counts the messages of the streams.
+func (m *StreamMessages) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		s := &countingStream{ServerStream: ss}
+		err := handler(srv, s)
+		service, method := splitMethod(info.FullMethod)
+		if info.IsClientStream {
+			observe(ss.Context(), m.messages.WithLabelValues(service, method, Received), float64(atomic.LoadInt64(&s.received)))
+		}
+		if info.IsServerStream {
+			observe(ss.Context(), m.messages.WithLabelValues(service, method, Sent), float64(atomic.LoadInt64(&s.sent)))
+		}
+		return err
+	}
+}
+
+// countingStream counts the messages of a grpc.ServerStream.
+type countingStream struct {
+	grpc.ServerStream
+	received, sent int64
+}
+
+func (s *countingStream) RecvMsg(m interface{}) error {
+	err := s.ServerStream.RecvMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.received, 1)
+	}
+	return err
+}
+
+func (s *countingStream) SendMsg(m interface{}) error {
+	err := s.ServerStream.SendMsg(m)
+	if err == nil {
+		atomic.AddInt64(&s.sent, 1)
+	}
+	return err
+}
+
+// splitMethod splits /package.Service/Method in package.Service and Method.
+func splitMethod(fullMethod string) (string, string) {
+	fullMethod = strings.TrimPrefix(fullMethod, "/")
+	if i := strings.LastIndex(fullMethod, "/"); i >= 0 {
+		return fullMethod[:i], fullMethod[i+1:]
+	}
+	return "unknown", "unknown"
+}
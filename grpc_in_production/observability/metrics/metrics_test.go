@@ -0,0 +1,135 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// echoDesc is a bidi stream echoing every message it receives.
+var echoDesc = grpc.ServiceDesc{
+	ServiceName: "test.Echo",
+	HandlerType: (*interface{})(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Echo",
+		Handler: func(_ interface{}, stream grpc.ServerStream) error {
+			for {
+				m := new(wrapperspb.StringValue)
+				if err := stream.RecvMsg(m); err == io.EOF {
+					return nil
+				} else if err != nil {
+					return err
+				}
+				if err := stream.SendMsg(m); err != nil {
+					return err
+				}
+			}
+		},
+		ServerStreams: true,
+		ClientStreams: true,
+	}},
+}
+
+func TestStreamMessages(t *testing.T) {
+	m := NewStreamMessages()
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StreamInterceptor(m.StreamServerInterceptor()))
+	s.RegisterService(&echoDesc, struct{}{})
+	go s.Serve(lis)
+	defer s.Stop()
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := conn.NewStream(context.Background(), &echoDesc.Streams[0], "/test.Echo/Echo")
+	if err != nil {
+		t.Fatalf("NewStream failed: %v", err)
+	}
+	for _, v := range []string{"a", "b", "c"} {
+		if err := stream.SendMsg(wrapperspb.String(v)); err != nil {
+			t.Fatalf("SendMsg failed: %v", err)
+		}
+	}
+	stream.CloseSend()
+	for {
+		if err := stream.RecvMsg(new(wrapperspb.StringValue)); err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatalf("RecvMsg failed: %v", err)
+		}
+	}
+
+	// the interceptor observes the stream after its status is sent
+	want := `
+		# HELP grpc_server_stream_messages Number of messages received or sent by a stream, observed when it ends.
+		# TYPE grpc_server_stream_messages histogram
+		grpc_server_stream_messages_sum{direction="received",grpc_method="Echo",grpc_service="test.Echo"} 3
+		grpc_server_stream_messages_count{direction="received",grpc_method="Echo",grpc_service="test.Echo"} 1
+		grpc_server_stream_messages_sum{direction="sent",grpc_method="Echo",grpc_service="test.Echo"} 3
+		grpc_server_stream_messages_count{direction="sent",grpc_method="Echo",grpc_service="test.Echo"} 1
+	`
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		err := testutil.CollectAndCompare(m, strings.NewReader(want),
+			"grpc_server_stream_messages_sum", "grpc_server_stream_messages_count")
+		if err == nil {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestOrders(t *testing.T) {
+	m := NewOrders()
+	m.Added(OrderAdded)
+	m.Added(OrderInvalid)
+	m.Added(OrderAdded)
+	m.ShipmentEmitted(ShipmentBatch, 3)
+	m.Searched(context.Background(), time.Now(), 0)
+
+	want := `
+		# HELP ecommerce_orders_added_total Number of orders added, by result: added or invalid.
+		# TYPE ecommerce_orders_added_total counter
+		ecommerce_orders_added_total{result="added"} 2
+		ecommerce_orders_added_total{result="invalid"} 1
+		# HELP ecommerce_shipments_emitted_total Number of combined shipments emitted, by trigger: batch or end_of_stream.
+		# TYPE ecommerce_shipments_emitted_total counter
+		ecommerce_shipments_emitted_total{trigger="batch"} 1
+		ecommerce_shipments_emitted_total{trigger="end_of_stream"} 0
+	`
+	if err := testutil.CollectAndCompare(m, strings.NewReader(want),
+		"ecommerce_orders_added_total", "ecommerce_shipments_emitted_total"); err != nil {
+		t.Error(err)
+	}
+	if got := testutil.CollectAndCount(m, "ecommerce_order_search_duration_seconds"); got != 1 {
+		t.Errorf("%d search duration series, want 1 of result empty", got)
+	}
+}
+
+func TestSplitMethod(t *testing.T) {
+	for _, tt := range []struct{ full, service, method string }{
+		{"/ecommerce.OrderManagement/processOrders", "ecommerce.OrderManagement", "processOrders"},
+		{"bad", "unknown", "unknown"},
+	} {
+		if service, method := splitMethod(tt.full); service != tt.service || method != tt.method {
+			t.Errorf("splitMethod(%q) = %q, %q, want %q, %q", tt.full, service, method, tt.service, tt.method)
+		}
+	}
+}
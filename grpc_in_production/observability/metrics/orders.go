@@ -0,0 +1,118 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Results of AddOrder, the values of the result label of ecommerce_orders_added_total.
+const (
+	OrderAdded   = "added"
+	OrderInvalid = "invalid"
+)
+
+// Reasons a shipment is emitted, the values of the trigger label of
+// ecommerce_shipments_emitted_total.
+const (
+	// ShipmentBatch is a shipment emitted when a batch of orders is complete.
+	ShipmentBatch = "batch"
+	// ShipmentEndOfStream is a shipment of the orders left when the client stream ends.
+	ShipmentEndOfStream = "end_of_stream"
+)
+
+// Results of a search, the values of the result label of
+// ecommerce_order_search_duration_seconds.
+const (
+	SearchFound = "found"
+	SearchEmpty = "empty"
+)
+
+// Orders are the domain metrics of the OrderManagement service.
+type Orders struct {
+	added          *prometheus.CounterVec
+	updated        prometheus.Counter
+	shipments      *prometheus.CounterVec
+	shipmentOrders prometheus.Histogram
+	searchDuration *prometheus.HistogramVec
+}
+
+// NewOrders returns the metrics of the orders, the counters of every label value start
+// at zero.
+func NewOrders() *Orders {
+	m := &Orders{
+		added: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ecommerce_orders_added_total",
+			Help: "Number of orders added, by result: added or invalid.",
+		}, []string{"result"}),
+		updated: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: "ecommerce_orders_updated_total",
+			Help: "Number of orders updated.",
+		}),
+		shipments: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "ecommerce_shipments_emitted_total",
+			Help: "Number of combined shipments emitted, by trigger: batch or end_of_stream.",
+		}, []string{"trigger"}),
+		shipmentOrders: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    "ecommerce_shipment_orders",
+			Help:    "Number of orders of a combined shipment.",
+			Buckets: prometheus.LinearBuckets(1, 1, 10),
+		}),
+		searchDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "ecommerce_order_search_duration_seconds",
+			Help:    "Time to search the orders, by result: found or empty.",
+			Buckets: HandlingTimeBuckets,
+		}, []string{"result"}),
+	}
+	for _, result := range []string{OrderAdded, OrderInvalid} {
+		m.added.WithLabelValues(result)
+	}
+	for _, trigger := range []string{ShipmentBatch, ShipmentEndOfStream} {
+		m.shipments.WithLabelValues(trigger)
+	}
+	return m
+}
+
+func (m *Orders) Describe(ch chan<- *prometheus.Desc) {
+	m.added.Describe(ch)
+	m.updated.Describe(ch)
+	m.shipments.Describe(ch)
+	m.shipmentOrders.Describe(ch)
+	m.searchDuration.Describe(ch)
+}
+
+func (m *Orders) Collect(ch chan<- prometheus.Metric) {
+	m.added.Collect(ch)
+	m.updated.Collect(ch)
+	m.shipments.Collect(ch)
+	m.shipmentOrders.Collect(ch)
+	m.searchDuration.Collect(ch)
+}
+
+// Added counts an order added, result is OrderAdded or OrderInvalid.
+func (m *Orders) Added(result string) {
+	m.added.WithLabelValues(result).Inc()
+}
+
+// Updated counts an order updated.
+func (m *Orders) Updated() {
+	m.updated.Inc()
+}
+
+// ShipmentEmitted counts a shipment of n orders, trigger is ShipmentBatch or
+// ShipmentEndOfStream.
+func (m *Orders) ShipmentEmitted(trigger string, n int) {
+	m.shipments.WithLabelValues(trigger).Inc()
+	m.shipmentOrders.Observe(float64(n))
+}
+
+// Searched observes the duration of a search of the call of ctx, started at start, which
+// found n orders.
+func (m *Orders) Searched(ctx context.Context, start time.Time, n int) {
+	result := SearchFound
+	if n == 0 {
+		result = SearchEmpty
+	}
+	observe(ctx, m.searchDuration.WithLabelValues(result), time.Since(start).Seconds())
+}
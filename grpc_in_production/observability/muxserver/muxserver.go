@@ -0,0 +1,173 @@
+// Package muxserver serves gRPC and the HTTP endpoints of a service (metrics, health,
+// pprof, an admin page and an HTTP gateway) on a single port.
+//
+// Connections are told apart by sniffing the first bytes: HTTP/2 requests with a
+// content-type of application/grpc go to the gRPC server, everything else is served
+// by an HTTP mux holding the enabled endpoints.
+package muxserver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/soheilhy/cmux"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+const (
+	MetricsPath = "/metrics"
+	HealthPath  = "/healthz"
+	PprofPath   = "/debug/pprof/"
+	AdminPath   = "/channelz"
+)
+
+// Server multiplexes the enabled surfaces on one listener.
+type Server struct {
+	grpcServer *grpc.Server
+	metrics    http.Handler
+	health     *health.Server
+	pprof      bool
+	admin      http.Handler
+	gateway    http.Handler
+
+	mux        cmux.CMux
+	httpServer *http.Server
+}
+
+// Option enables one surface of the Server.
+type Option func(*Server)
+
+// WithGRPC serves s for every HTTP/2 request with a gRPC content-type.
+func WithGRPC(s *grpc.Server) Option {
+	return func(srv *Server) { srv.grpcServer = s }
+}
+
+// WithMetrics serves h (e.g. promhttp.HandlerFor) on /metrics.
+func WithMetrics(h http.Handler) Option {
+	return func(srv *Server) { srv.metrics = h }
+}
+
+// WithHealth reports the status held by hs on /healthz, and registers it
+// as the grpc.health.v1 service when gRPC is enabled as well.
+func WithHealth(hs *health.Server) Option {
+	return func(srv *Server) { srv.health = hs }
+}
+
+// WithPprof serves the runtime profiles of net/http/pprof on /debug/pprof/.
+func WithPprof() Option {
+	return func(srv *Server) { srv.pprof = true }
+}
+
+// WithAdmin serves h (e.g. admin.NewHandler) on /channelz.
+func WithAdmin(h http.Handler) Option {
+	return func(srv *Server) { srv.admin = h }
+}
+
+// WithGateway serves every other HTTP path with h, e.g. a REST/JSON gateway.
+func WithGateway(h http.Handler) Option {
+	return func(srv *Server) { srv.gateway = h }
+}
+
+// New creates a Server for the enabled surfaces, the ones without an Option are not served.
+// It must be called before the gRPC server is serving since it can register the health service.
+func New(opts ...Option) *Server {
+	s := &Server{}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.grpcServer != nil && s.health != nil {
+		healthpb.RegisterHealthServer(s.grpcServer, s.health)
+	}
+	s.httpServer = &http.Server{
+		// h2c so that HTTP/2 clients which are not speaking gRPC are served as well
+		Handler: h2c.NewHandler(s.httpMux(), &http2.Server{}),
+	}
+	return s
+}
+
+func (s *Server) httpMux() *http.ServeMux {
+	mux := http.NewServeMux()
+	if s.metrics != nil {
+		mux.Handle(MetricsPath, s.metrics)
+	}
+	if s.health != nil {
+		mux.HandleFunc(HealthPath, s.serveHealth)
+	}
+	if s.pprof {
+		mux.HandleFunc(PprofPath, pprof.Index)
+		mux.HandleFunc(PprofPath+"cmdline", pprof.Cmdline)
+		mux.HandleFunc(PprofPath+"profile", pprof.Profile)
+		mux.HandleFunc(PprofPath+"symbol", pprof.Symbol)
+		mux.HandleFunc(PprofPath+"trace", pprof.Trace)
+	}
+	if s.admin != nil {
+		mux.Handle(AdminPath, s.admin)
+	}
+	if s.gateway != nil {
+		mux.Handle("/", s.gateway)
+	}
+	return mux
+}
+
+// serveHealth answers 200 while the overall status ("" service) is SERVING, 503 otherwise.
+// The status of a single service can be asked for with ?service=ecommerce.ProductInfo
+func (s *Server) serveHealth(w http.ResponseWriter, r *http.Request) {
+	resp, err := s.health.Check(r.Context(), &healthpb.HealthCheckRequest{Service: r.URL.Query().Get("service")})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		http.Error(w, resp.Status.String(), http.StatusServiceUnavailable)
+		return
+	}
+	w.Write([]byte(resp.Status.String()))
+}
+
+// Serve accepts connections on lis and hands each of them to the gRPC or the HTTP server.
+// It blocks until lis is closed or one of the servers fails.
+func (s *Server) Serve(lis net.Listener) error {
+	s.mux = cmux.New(lis)
+	errCh := make(chan error, 3)
+
+	if s.grpcServer != nil {
+		// gRPC clients wait for the server SETTINGS frame before sending the headers,
+		// so the matcher has to write it while sniffing the content-type.
+		grpcL := s.mux.MatchWithWriters(
+			cmux.HTTP2MatchHeaderFieldPrefixSendSettings("content-type", "application/grpc"))
+		go func() { errCh <- s.grpcServer.Serve(grpcL) }()
+	}
+	httpL := s.mux.Match(cmux.Any())
+	go func() { errCh <- s.httpServer.Serve(httpL) }()
+	go func() { errCh <- s.mux.Serve() }()
+
+	err := <-errCh
+	switch {
+	case errors.Is(err, grpc.ErrServerStopped), errors.Is(err, http.ErrServerClosed),
+		errors.Is(err, cmux.ErrServerClosed), errors.Is(err, cmux.ErrListenerClosed), errors.Is(err, net.ErrClosed):
+		return nil
+	}
+	return err
+}
+
+// Shutdown stops accepting connections and gracefully stops the gRPC and HTTP servers.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if s.health != nil {
+		s.health.Shutdown()
+	}
+	if s.grpcServer != nil {
+		s.grpcServer.GracefulStop()
+	}
+	err := s.httpServer.Shutdown(ctx)
+	if s.mux != nil {
+		s.mux.Close()
+	}
+	return err
+}
@@ -0,0 +1,108 @@
+package muxserver
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func startServer(t *testing.T, opts ...Option) string {
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := New(opts...)
+	go s.Serve(lis)
+	t.Cleanup(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
+	})
+	return lis.Addr().String()
+}
+
+func httpGet(t *testing.T, url string) (int, string) {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s failed: %v", url, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, string(body)
+}
+
+// gRPC and HTTP requests on the same port reach their own server.
+func TestServer_SinglePort(t *testing.T) {
+	healthServer := health.NewServer()
+	metrics := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("grpc_server_started_total 1\n"))
+	})
+	addr := startServer(t,
+		WithGRPC(grpc.NewServer()),
+		WithMetrics(metrics),
+		WithHealth(healthServer),
+	)
+
+	conn, err := grpc.Dial(addr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	resp, err := healthpb.NewHealthClient(conn).Check(ctx, &healthpb.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("gRPC health check failed: %v", err)
+	}
+	if resp.Status != healthpb.HealthCheckResponse_SERVING {
+		t.Errorf("gRPC health = %s, want SERVING", resp.Status)
+	}
+
+	if code, body := httpGet(t, "http://"+addr+MetricsPath); code != http.StatusOK || body != "grpc_server_started_total 1\n" {
+		t.Errorf("GET %s = %d %q, want the metrics", MetricsPath, code, body)
+	}
+	if code, _ := httpGet(t, "http://"+addr+HealthPath); code != http.StatusOK {
+		t.Errorf("GET %s = %d, want 200", HealthPath, code)
+	}
+	healthServer.SetServingStatus("", healthpb.HealthCheckResponse_NOT_SERVING)
+	if code, _ := httpGet(t, "http://"+addr+HealthPath); code != http.StatusServiceUnavailable {
+		t.Errorf("GET %s = %d, want 503 once NOT_SERVING", HealthPath, code)
+	}
+}
+
+// Surfaces without an Option are not served.
+func TestServer_DisabledSurfaces(t *testing.T) {
+	gateway := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "gateway", http.StatusTeapot)
+	})
+	addr := startServer(t, WithPprof())
+
+	if code, _ := httpGet(t, "http://"+addr+PprofPath); code != http.StatusOK {
+		t.Errorf("GET %s = %d, want 200", PprofPath, code)
+	}
+	for _, path := range []string{MetricsPath, HealthPath, AdminPath, "/v1/product/1"} {
+		if code, _ := httpGet(t, "http://"+addr+path); code != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, code)
+		}
+	}
+
+	// every path which is not taken by another surface goes to the gateway
+	admin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("channelz"))
+	})
+	addr = startServer(t, WithGateway(gateway), WithAdmin(admin))
+	if code, _ := httpGet(t, "http://"+addr+"/v1/product/1"); code != http.StatusTeapot {
+		t.Errorf("GET /v1/product/1 = %d, want the gateway", code)
+	}
+	if code, body := httpGet(t, "http://"+addr+AdminPath); code != http.StatusOK || body != "channelz" {
+		t.Errorf("GET %s = %d %q, want the admin page", AdminPath, code, body)
+	}
+}
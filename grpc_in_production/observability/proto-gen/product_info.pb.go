@@ -1,216 +1,193 @@
 // Code generated by protoc-gen-go. DO NOT EDIT.
-// source: proto-gen/product_info.proto-gen
+// versions:
+// 	protoc-gen-go v1.30.0
+// 	protoc        (unknown)
+// source: product_info.proto
 
 package ecommerce
 
 import (
-	context "context"
-	fmt "fmt"
-	proto "github.com/golang/protobuf/proto"
 	wrappers "github.com/golang/protobuf/ptypes/wrappers"
-	grpc "google.golang.org/grpc"
-	math "math"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
 )
 
-// Reference imports to suppress errors if they are not otherwise used.
-var _ = proto.Marshal
-var _ = fmt.Errorf
-var _ = math.Inf
-
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the proto-gen package it is being compiled against.
-// A compilation error at this line likely means your copy of the
-// proto-gen package needs to be updated.
-const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto-gen package
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
 
 type Product struct {
-	Id                   string   `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
-	Name                 string   `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
-	Description          string   `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
-	Price                float32  `protobuf:"fixed32,4,opt,name=price,proto3" json:"price,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
-}
-
-func (m *Product) Reset()         { *m = Product{} }
-func (m *Product) String() string { return proto.CompactTextString(m) }
-func (*Product) ProtoMessage()    {}
-func (*Product) Descriptor() ([]byte, []int) {
-	return fileDescriptor_bca18e0841a4a514, []int{0}
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Id          string  `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Name        string  `protobuf:"bytes,2,opt,name=name,proto3" json:"name,omitempty"`
+	Description string  `protobuf:"bytes,3,opt,name=description,proto3" json:"description,omitempty"`
+	Price       float32 `protobuf:"fixed32,4,opt,name=price,proto3" json:"price,omitempty"`
+}
+
+func (x *Product) Reset() {
+	*x = Product{}
+	if protoimpl.UnsafeEnabled {
+		mi := &file_product_info_proto_msgTypes[0]
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		ms.StoreMessageInfo(mi)
+	}
 }
 
-func (m *Product) XXX_Unmarshal(b []byte) error {
-	return xxx_messageInfo_Product.Unmarshal(m, b)
-}
-func (m *Product) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
-	return xxx_messageInfo_Product.Marshal(b, m, deterministic)
-}
-func (m *Product) XXX_Merge(src proto.Message) {
-	xxx_messageInfo_Product.Merge(m, src)
-}
-func (m *Product) XXX_Size() int {
-	return xxx_messageInfo_Product.Size(m)
-}
-func (m *Product) XXX_DiscardUnknown() {
-	xxx_messageInfo_Product.DiscardUnknown(m)
+func (x *Product) String() string {
+	return protoimpl.X.MessageStringOf(x)
 }
 
-var xxx_messageInfo_Product proto.InternalMessageInfo
+func (*Product) ProtoMessage() {}
 
-func (m *Product) GetId() string {
-	if m != nil {
-		return m.Id
+func (x *Product) ProtoReflect() protoreflect.Message {
+	mi := &file_product_info_proto_msgTypes[0]
+	if protoimpl.UnsafeEnabled && x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
 	}
-	return ""
+	return mi.MessageOf(x)
 }
 
-func (m *Product) GetName() string {
-	if m != nil {
-		return m.Name
-	}
-	return ""
+// Deprecated: Use Product.ProtoReflect.Descriptor instead.
+func (*Product) Descriptor() ([]byte, []int) {
+	return file_product_info_proto_rawDescGZIP(), []int{0}
 }
 
-func (m *Product) GetDescription() string {
-	if m != nil {
-		return m.Description
+func (x *Product) GetId() string {
+	if x != nil {
+		return x.Id
 	}
 	return ""
 }
 
-func (m *Product) GetPrice() float32 {
-	if m != nil {
-		return m.Price
+func (x *Product) GetName() string {
+	if x != nil {
+		return x.Name
 	}
-	return 0
-}
-
-func init() {
-	proto.RegisterType((*Product)(nil), "ecommerce.Product")
-}
-
-func init() { proto.RegisterFile("proto-gen/product_info.proto-gen", fileDescriptor_bca18e0841a4a514) }
-
-var fileDescriptor_bca18e0841a4a514 = []byte{
-	// 217 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0x7c, 0x8e, 0xbd, 0x4a, 0x04, 0x31,
-	0x10, 0xc7, 0xd9, 0xf5, 0x54, 0x6e, 0x0e, 0x2c, 0x06, 0x8b, 0xb0, 0x88, 0x2c, 0x56, 0x57, 0x65,
-	0x41, 0x7b, 0x7b, 0x3b, 0x39, 0xc1, 0x56, 0x72, 0xc9, 0x6c, 0x08, 0xdc, 0x66, 0xc2, 0x5c, 0x16,
-	0x9f, 0xc2, 0x77, 0x16, 0x93, 0x5b, 0xb1, 0x90, 0xeb, 0x92, 0xdf, 0xfc, 0xbf, 0x40, 0x25, 0xe1,
-	0xcc, 0x43, 0x12, 0x76, 0xb3, 0xcd, 0x1f, 0x21, 0x8e, 0xac, 0x0b, 0xc2, 0x35, 0x59, 0x9e, 0x26,
-	0x12, 0x4b, 0xdd, 0xbd, 0x67, 0xf6, 0x07, 0x1a, 0xca, 0x61, 0x3f, 0x8f, 0xc3, 0xa7, 0x98, 0x94,
-	0x48, 0x8e, 0x55, 0xfa, 0x40, 0x70, 0xfd, 0x5a, 0x03, 0xf0, 0x06, 0xda, 0xe0, 0x54, 0xd3, 0x37,
-	0xdb, 0xf5, 0xae, 0x0d, 0x0e, 0x11, 0x56, 0xd1, 0x4c, 0xa4, 0xda, 0x42, 0xca, 0x1b, 0x7b, 0xd8,
-	0x38, 0x3a, 0x5a, 0x09, 0x29, 0x07, 0x8e, 0xea, 0xa2, 0x9c, 0xfe, 0x22, 0xbc, 0x85, 0xcb, 0x24,
-	0xc1, 0x92, 0x5a, 0xf5, 0xcd, 0xb6, 0xdd, 0xd5, 0xcf, 0xe3, 0x57, 0x03, 0x9b, 0x53, 0xcf, 0x4b,
-	0x1c, 0x19, 0x9f, 0x01, 0x8c, 0x73, 0x4b, 0x33, 0xea, 0xdf, 0xc1, 0xfa, 0xc4, 0xba, 0x3b, 0x5d,
-	0x97, 0xeb, 0x65, 0xb9, 0x7e, 0xcb, 0x12, 0xa2, 0x7f, 0x37, 0x87, 0x99, 0x7e, 0xfc, 0x9e, 0xf2,
-	0xe2, 0x3f, 0xab, 0xed, 0xfe, 0x49, 0xdf, 0x5f, 0x15, 0xe5, 0xd3, 0x77, 0x00, 0x00, 0x00, 0xff,
-	0xff, 0xa8, 0x07, 0xc1, 0x73, 0x44, 0x01, 0x00, 0x00,
-}
-
-// Reference imports to suppress errors if they are not otherwise used.
-var _ context.Context
-var _ grpc.ClientConn
-
-// This is a compile-time assertion to ensure that this generated file
-// is compatible with the grpc package it is being compiled against.
-const _ = grpc.SupportPackageIsVersion4
-
-// ProductInfoClient is the client API for ProductInfo service.
-//
-// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://godoc.org/google.golang.org/grpc#ClientConn.NewStream.
-type ProductInfoClient interface {
-	AddProduct(ctx context.Context, in *Product, opts ...grpc.CallOption) (*wrappers.StringValue, error)
-	GetProduct(ctx context.Context, in *wrappers.StringValue, opts ...grpc.CallOption) (*Product, error)
-}
-
-type productInfoClient struct {
-	cc *grpc.ClientConn
-}
-
-func NewProductInfoClient(cc *grpc.ClientConn) ProductInfoClient {
-	return &productInfoClient{cc}
+	return ""
 }
 
-func (c *productInfoClient) AddProduct(ctx context.Context, in *Product, opts ...grpc.CallOption) (*wrappers.StringValue, error) {
-	out := new(wrappers.StringValue)
-	err := c.cc.Invoke(ctx, "/ecommerce.ProductInfo/addProduct", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (x *Product) GetDescription() string {
+	if x != nil {
+		return x.Description
 	}
-	return out, nil
+	return ""
 }
 
-func (c *productInfoClient) GetProduct(ctx context.Context, in *wrappers.StringValue, opts ...grpc.CallOption) (*Product, error) {
-	out := new(Product)
-	err := c.cc.Invoke(ctx, "/ecommerce.ProductInfo/getProduct", in, out, opts...)
-	if err != nil {
-		return nil, err
+func (x *Product) GetPrice() float32 {
+	if x != nil {
+		return x.Price
 	}
-	return out, nil
-}
-
-// ProductInfoServer is the server API for ProductInfo service.
-type ProductInfoServer interface {
-	AddProduct(context.Context, *Product) (*wrappers.StringValue, error)
-	GetProduct(context.Context, *wrappers.StringValue) (*Product, error)
-}
-
-func RegisterProductInfoServer(s *grpc.Server, srv ProductInfoServer) {
-	s.RegisterService(&_ProductInfo_serviceDesc, srv)
+	return 0
 }
 
-func _ProductInfo_AddProduct_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(Product)
-	if err := dec(in); err != nil {
-		return nil, err
-	}
-	if interceptor == nil {
-		return srv.(ProductInfoServer).AddProduct(ctx, in)
-	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/ecommerce.ProductInfo/AddProduct",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ProductInfoServer).AddProduct(ctx, req.(*Product))
-	}
-	return interceptor(ctx, in, info, handler)
-}
+var File_product_info_proto protoreflect.FileDescriptor
+
+var file_product_info_proto_rawDesc = []byte{
+	0x0a, 0x12, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x5f, 0x69, 0x6e, 0x66, 0x6f, 0x2e, 0x70,
+	0x72, 0x6f, 0x74, 0x6f, 0x12, 0x09, 0x65, 0x63, 0x6f, 0x6d, 0x6d, 0x65, 0x72, 0x63, 0x65, 0x1a,
+	0x1e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66,
+	0x2f, 0x77, 0x72, 0x61, 0x70, 0x70, 0x65, 0x72, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x1a,
+	0x1c, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2f, 0x61, 0x70, 0x69, 0x2f, 0x61, 0x6e, 0x6e, 0x6f,
+	0x74, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x73, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0x65, 0x0a,
+	0x07, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x20, 0x0a, 0x0b,
+	0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0b, 0x64, 0x65, 0x73, 0x63, 0x72, 0x69, 0x70, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x14,
+	0x0a, 0x05, 0x70, 0x72, 0x69, 0x63, 0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x02, 0x52, 0x05, 0x70,
+	0x72, 0x69, 0x63, 0x65, 0x32, 0xc2, 0x01, 0x0a, 0x0b, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74,
+	0x49, 0x6e, 0x66, 0x6f, 0x12, 0x56, 0x0a, 0x0a, 0x61, 0x64, 0x64, 0x50, 0x72, 0x6f, 0x64, 0x75,
+	0x63, 0x74, 0x12, 0x12, 0x2e, 0x65, 0x63, 0x6f, 0x6d, 0x6d, 0x65, 0x72, 0x63, 0x65, 0x2e, 0x50,
+	0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x1a, 0x1c, 0x2e, 0x67, 0x6f, 0x6f, 0x67, 0x6c, 0x65, 0x2e,
+	0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72, 0x69, 0x6e, 0x67, 0x56,
+	0x61, 0x6c, 0x75, 0x65, 0x22, 0x16, 0x82, 0xd3, 0xe4, 0x93, 0x02, 0x10, 0x3a, 0x01, 0x2a, 0x22,
+	0x0b, 0x2f, 0x76, 0x31, 0x2f, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x12, 0x5b, 0x0a, 0x0a,
+	0x67, 0x65, 0x74, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x12, 0x1c, 0x2e, 0x67, 0x6f, 0x6f,
+	0x67, 0x6c, 0x65, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x62, 0x75, 0x66, 0x2e, 0x53, 0x74, 0x72,
+	0x69, 0x6e, 0x67, 0x56, 0x61, 0x6c, 0x75, 0x65, 0x1a, 0x12, 0x2e, 0x65, 0x63, 0x6f, 0x6d, 0x6d,
+	0x65, 0x72, 0x63, 0x65, 0x2e, 0x50, 0x72, 0x6f, 0x64, 0x75, 0x63, 0x74, 0x22, 0x1b, 0x82, 0xd3,
+	0xe4, 0x93, 0x02, 0x15, 0x12, 0x13, 0x2f, 0x76, 0x31, 0x2f, 0x70, 0x72, 0x6f, 0x64, 0x75, 0x63,
+	0x74, 0x2f, 0x7b, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x7d, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f,
+	0x33,
+}
+
+var (
+	file_product_info_proto_rawDescOnce sync.Once
+	file_product_info_proto_rawDescData = file_product_info_proto_rawDesc
+)
 
-func _ProductInfo_GetProduct_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
-	in := new(wrappers.StringValue)
-	if err := dec(in); err != nil {
-		return nil, err
+func file_product_info_proto_rawDescGZIP() []byte {
+	file_product_info_proto_rawDescOnce.Do(func() {
+		file_product_info_proto_rawDescData = protoimpl.X.CompressGZIP(file_product_info_proto_rawDescData)
+	})
+	return file_product_info_proto_rawDescData
+}
+
+var file_product_info_proto_msgTypes = make([]protoimpl.MessageInfo, 1)
+var file_product_info_proto_goTypes = []interface{}{
+	(*Product)(nil),              // 0: ecommerce.Product
+	(*wrappers.StringValue)(nil), // 1: google.protobuf.StringValue
+}
+var file_product_info_proto_depIdxs = []int32{
+	0, // 0: ecommerce.ProductInfo.addProduct:input_type -> ecommerce.Product
+	1, // 1: ecommerce.ProductInfo.getProduct:input_type -> google.protobuf.StringValue
+	1, // 2: ecommerce.ProductInfo.addProduct:output_type -> google.protobuf.StringValue
+	0, // 3: ecommerce.ProductInfo.getProduct:output_type -> ecommerce.Product
+	2, // [2:4] is the sub-list for method output_type
+	0, // [0:2] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_product_info_proto_init() }
+func file_product_info_proto_init() {
+	if File_product_info_proto != nil {
+		return
 	}
-	if interceptor == nil {
-		return srv.(ProductInfoServer).GetProduct(ctx, in)
+	if !protoimpl.UnsafeEnabled {
+		file_product_info_proto_msgTypes[0].Exporter = func(v interface{}, i int) interface{} {
+			switch v := v.(*Product); i {
+			case 0:
+				return &v.state
+			case 1:
+				return &v.sizeCache
+			case 2:
+				return &v.unknownFields
+			default:
+				return nil
+			}
+		}
 	}
-	info := &grpc.UnaryServerInfo{
-		Server:     srv,
-		FullMethod: "/ecommerce.ProductInfo/GetProduct",
-	}
-	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
-		return srv.(ProductInfoServer).GetProduct(ctx, req.(*wrappers.StringValue))
-	}
-	return interceptor(ctx, in, info, handler)
-}
-
-var _ProductInfo_serviceDesc = grpc.ServiceDesc{
-	ServiceName: "ecommerce.ProductInfo",
-	HandlerType: (*ProductInfoServer)(nil),
-	Methods: []grpc.MethodDesc{
-		{
-			MethodName: "addProduct",
-			Handler:    _ProductInfo_AddProduct_Handler,
-		},
-		{
-			MethodName: "getProduct",
-			Handler:    _ProductInfo_GetProduct_Handler,
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: file_product_info_proto_rawDesc,
+			NumEnums:      0,
+			NumMessages:   1,
+			NumExtensions: 0,
+			NumServices:   1,
 		},
-	},
-	Streams:  []grpc.StreamDesc{},
-	Metadata: "proto-gen/product_info.proto-gen",
+		GoTypes:           file_product_info_proto_goTypes,
+		DependencyIndexes: file_product_info_proto_depIdxs,
+		MessageInfos:      file_product_info_proto_msgTypes,
+	}.Build()
+	File_product_info_proto = out.File
+	file_product_info_proto_rawDesc = nil
+	file_product_info_proto_goTypes = nil
+	file_product_info_proto_depIdxs = nil
 }
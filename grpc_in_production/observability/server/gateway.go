@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/encoding/protojson"
+	pb "observability/proto-gen"
+	"rpcerrors"
+)
+
+const productPath = "/v1/product"
+
+// newGateway returns the REST/JSON front of the ProductInfo service, generated by
+// protoc-gen-grpc-gateway from the google.api.http options of product_info.proto. It
+// calls the service over conn so that the requests are counted by the metrics interceptor.
+//
+//	POST /v1/product       {"name": ..., "description": ..., "price": ...}
+//	GET  /v1/product/{id}
+func newGateway(ctx context.Context, conn *grpc.ClientConn) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		// the JSON fields keep the names of the proto, like the details of the errors
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{UseProtoNames: true},
+		}),
+		runtime.WithIncomingHeaderMatcher(headerMatcher),
+	)
+	if err := pb.RegisterProductInfoHandler(ctx, mux, conn); err != nil {
+		return nil, err
+	}
+	return mux, nil
+}
+
+// headerMatcher passes the Accept-Language header on as the accept-language metadata
+// the service localizes the messages of its errors with, the other headers as the
+// default matcher does.
+func headerMatcher(key string) (string, bool) {
+	if strings.EqualFold(key, "Accept-Language") {
+		return rpcerrors.AcceptLanguageKey, true
+	}
+	return runtime.DefaultHeaderMatcher(key)
+}
@@ -6,21 +6,32 @@
 package main
 
 import (
+	"admin"
 	"context"
-	"errors"
-	"fmt"
-	grpc_prometheus "github.com/grpc-ecosystem/go-grpc-prometheus"
+	"cost"
+	"flag"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"log"
 	"net"
-	"net/http"
+	"os"
+	"os/signal"
+	"rpcerrors"
+	"syscall"
+	"time"
 
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/reflection"
-	pb "grpc_prod/proto-gen"
+	"grpc_prod/tracer"
+	"observability/metrics"
+	"observability/muxserver"
+	pb "observability/proto-gen"
+	"observability/slo"
 	"sync"
 )
 
@@ -31,21 +42,31 @@ const (
 var (
 	// metrics registry. This holds all data collectors registered in the system
 	reg = prometheus.NewRegistry()
-	// creates standard client metrics, these are predefined metrics in lib
-	grpcMetrics = grpc_prometheus.NewServerMetrics()
-	//creates a custom metrics counter
-	customMetricCounter = prometheus.NewCounterVec(prometheus.CounterOpts{
-		Name: "product_mgt_server_handle_count",
-		Help: "Total number of RPCs handled on the server",
-	}, []string{"name"})
+	// creates standard server metrics, these are predefined metrics in lib
+	grpcMetrics = metrics.NewServerMetrics()
+	// the handling time histograms, with the trace IDs of the calls as exemplars
+	handlingTime = metrics.NewHandlingTime()
+	// the number of messages of each stream
+	streamMessages = metrics.NewStreamMessages()
+	// the domain metrics of the orders
+	orderMetrics = metrics.NewOrders()
+	// the cost of the calls by method and caller, the grpc_server_cost_* metrics
+	costs = cost.NewHandler(cost.DefaultMaxCallers)
+	// creates a custom metrics counter, without labels: a label taking the product
+	// names would create a time series per product
+	productsAdded = prometheus.NewCounter(prometheus.CounterOpts{
+		Name: "product_mgt_products_added_total",
+		Help: "Total number of products added",
+	})
 )
 
 func init() {
-	reg.MustRegister(grpcMetrics, customMetricCounter)
+	reg.MustRegister(grpcMetrics, handlingTime, streamMessages, orderMetrics, costs, productsAdded)
 }
 
 // server is used to implement ecommerce/product_info.
 type server struct {
+	pb.UnimplementedProductInfoServer
 	sync.RWMutex
 	productMap map[string]*pb.Product
 }
@@ -63,8 +84,8 @@ func (s *server) AddProduct(ctx context.Context, in *pb.Product) (*wrapper.Strin
 		s.productMap = make(map[string]*pb.Product)
 	}
 	s.productMap[in.Id] = in
-	// inc the counter for given product name
-	customMetricCounter.WithLabelValues(in.Name).Inc()
+	// inc the counter of products added
+	productsAdded.Inc()
 	log.Printf("New product added - ID : %s, Name : %s", in.Id, in.Name)
 	return &wrapper.StringValue{Value: in.Id}, nil
 }
@@ -79,39 +100,152 @@ func (s *server) GetProduct(ctx context.Context, in *wrapper.StringValue) (*pb.P
 		return value, nil
 	}
 
-	return nil, errors.New("Product does not exist for the ID" + in.Value)
+	return nil, rpcerrors.NotFound("Product", in.Value)
 }
 
+var (
+	// every surface is served on the same port, each of them can be turned off
+	enableGRPC    = flag.Bool("grpc", true, "serve the gRPC services")
+	enableMetrics = flag.Bool("metrics", true, "serve prometheus metrics on "+muxserver.MetricsPath)
+	enableHealth  = flag.Bool("health", true, "serve grpc.health.v1 and "+muxserver.HealthPath)
+	enablePprof   = flag.Bool("pprof", false, "serve runtime profiles on "+muxserver.PprofPath)
+	enableGateway = flag.Bool("gateway", false, "serve the REST/JSON gateway on "+productPath)
+	enableAdmin   = flag.Bool("admin", false, "serve the channelz page on "+muxserver.AdminPath+" and the channelz service")
+
+	// the spans of the calls, their trace IDs are the exemplars of the histograms
+	exporter     = flag.String("exporter", tracer.ExporterNone, "where the spans go: otlp, stdout or none")
+	otlpEndpoint = flag.String("otlp-endpoint", tracer.DefaultOTLPEndpoint, "host:port of the OpenTelemetry collector")
+
+	// the SLOs tracked on the metrics, e.g. slo/slos.yaml
+	sloFile = flag.String("slo", "", "YAML file of the SLOs, exported as the slo_* metrics; none if empty")
+)
+
 func main() {
+	flag.Parse()
+	// The histograms only get exemplars with an exporter: the trace IDs of spans
+	// dropped would link to nothing, so without one the spans are not sampled.
+	cfg := tracer.Config{
+		ServiceName:  "ecommerce.observability.server",
+		Exporter:     *exporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: true,
+	}
+	if cfg.Exporter == tracer.ExporterNone {
+		cfg.Sampler = tracer.SamplerAlwaysOff
+	}
+	tp, err := tracer.Init(context.Background(), cfg)
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	// Creates an HTTP server for Prometheus
-	httpServer := &http.Server{
-		Handler: promhttp.HandlerFor(reg, promhttp.HandlerOpts{}),
-		Addr:    fmt.Sprintf("0.0.0.0:%d", 9092),
-	}
-	// Creates a gRPC server with a metrics interceptor.
-	// we use grpcMetrics.UnaryServerInterceptor, since we have unary service.
-	// There is another interceptor called grpcMetrics.StreamServerInterceptor()
-	// for streaming services.
-	grpcServer := grpc.NewServer(
-		grpc.UnaryInterceptor(grpcMetrics.UnaryServerInterceptor()),
-	)
-	pb.RegisterProductInfoServer(grpcServer, &server{})
-	// Initializes all standard metrics.
-	grpcMetrics.InitializeMetrics(grpcServer)
-
-	// start HTTP server for prometheus
-	go func() {
-		if err := httpServer.ListenAndServe(); err != nil {
-			log.Fatal("Unable to start a http server")
+
+	if *sloFile != "" {
+		c, err := slo.Load(*sloFile)
+		if err != nil {
+			log.Fatalf("failed to load the SLOs: %v", err)
 		}
+		// the burn rates and the error budgets, from the metrics of this registry
+		tracker := slo.NewTracker(c, reg)
+		reg.MustRegister(tracker)
+		go tracker.Run(context.Background(), slo.DefaultInterval)
+	}
+
+	var opts []muxserver.Option
+	if *enableGRPC {
+		// Creates a gRPC server with the metrics interceptors: the unary ones for
+		// ProductInfo and the unary calls of OrderManagement, the stream ones for
+		// the streaming calls of OrderManagement. The span of a call is started by
+		// the stats handler of the tracing package before the interceptors run, the
+		// histograms take its trace ID. The errors get their messages in the
+		// languages of the accept-language metadata.
+		grpcServer := grpc.NewServer(
+			grpc.StatsHandler(tracer.NewServerHandler()),
+			grpc.StatsHandler(costs),
+			grpc.ChainUnaryInterceptor(
+				grpcMetrics.UnaryServerInterceptor(),
+				handlingTime.UnaryServerInterceptor(),
+				rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer),
+			),
+			grpc.ChainStreamInterceptor(
+				grpcMetrics.StreamServerInterceptor(),
+				handlingTime.StreamServerInterceptor(),
+				streamMessages.StreamServerInterceptor(),
+				rpcerrors.StreamServerInterceptor(rpcerrors.DefaultLocalizer),
+			),
+		)
+		pb.RegisterProductInfoServer(grpcServer, &server{})
+		pb.RegisterOrderManagementServer(grpcServer, newOrderServer(orderMetrics))
+		// the cost report on demand
+		costs.Register(grpcServer)
+		// Initializes all standard metrics.
+		grpcMetrics.InitializeMetrics(grpcServer)
+		// Register reflection service on gRPC server.
+		reflection.Register(grpcServer)
+		if *enableAdmin {
+			// the channelz service for grpcdebug
+			admin.Register(grpcServer)
+		}
+		opts = append(opts, muxserver.WithGRPC(grpcServer))
+	}
+	if *enableMetrics {
+		// prometheus scrapes the same port as the gRPC clients use. The exemplars are
+		// only served in the OpenMetrics format, which prometheus negotiates.
+		opts = append(opts, muxserver.WithMetrics(promhttp.HandlerFor(reg, promhttp.HandlerOpts{EnableOpenMetrics: true})))
+	}
+	if *enableHealth {
+		// SERVING for the whole server, ecommerce.ProductInfo and ecommerce.OrderManagement
+		healthServer := health.NewServer()
+		healthServer.SetServingStatus("ecommerce.ProductInfo", healthpb.HealthCheckResponse_SERVING)
+		healthServer.SetServingStatus("ecommerce.OrderManagement", healthpb.HealthCheckResponse_SERVING)
+		opts = append(opts, muxserver.WithHealth(healthServer))
+	}
+	if *enablePprof {
+		opts = append(opts, muxserver.WithPprof())
+	}
+	if *enableAdmin {
+		// the connections of the clients and of the gateway, with their streams
+		opts = append(opts, muxserver.WithAdmin(admin.NewHandler()))
+	}
+	if *enableGateway {
+		if !*enableGRPC {
+			log.Fatalf("the gateway needs the gRPC services, run with -grpc")
+		}
+		// the gateway reaches the gRPC services through the multiplexed port itself
+		conn, err := grpc.Dial("localhost"+port,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			// the calls of the gateway are the parents of the spans of the server
+			grpc.WithStatsHandler(tracer.NewClientHandler()))
+		if err != nil {
+			log.Fatalf("did not connect: %v", err)
+		}
+		defer conn.Close()
+		gateway, err := newGateway(context.Background(), conn)
+		if err != nil {
+			log.Fatalf("failed to register the gateway: %v", err)
+		}
+		opts = append(opts, muxserver.WithGateway(gateway))
+	}
+
+	log.Printf("serving gRPC=%t metrics=%t health=%t pprof=%t admin=%t gateway=%t on %s",
+		*enableGRPC, *enableMetrics, *enableHealth, *enablePprof, *enableAdmin, *enableGateway, port)
+	s := muxserver.New(opts...)
+	go func() {
+		// flush the spans on SIGINT or SIGTERM
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		s.Shutdown(ctx)
 	}()
-	// Register reflection service on gRPC server.
-	reflection.Register(grpcServer)
-	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+	if err := s.Serve(lis); err != nil {
+		log.Printf("serve: %v", err)
+	}
+	if err := tp.Shutdown(context.Background()); err != nil {
+		log.Printf("failed to flush the spans: %v", err)
 	}
 }
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes/wrappers"
+	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"observability/metrics"
+	pb "observability/proto-gen"
+	"rpcerrors"
+)
+
+const orderBatchSize = 3
+
+// orderServer is used to implement ecommerce/order_management, it records the domain
+// metrics of the orders.
+type orderServer struct {
+	pb.UnimplementedOrderManagementServer
+	metrics *metrics.Orders
+
+	sync.RWMutex
+	orderMap map[string]*pb.Order
+}
+
+func newOrderServer(m *metrics.Orders) *orderServer {
+	s := &orderServer{metrics: m, orderMap: make(map[string]*pb.Order)}
+	for _, order := range []*pb.Order{
+		{Id: "101", Items: []string{"Apple Mouse", "Mac Magic Keyboard"}, Destination: "Mountain View, CA", Price: 50.00},
+		{Id: "102", Items: []string{"Google Pixel 3A", "Mac Book Pro"}, Destination: "Mountain View, CA", Price: 1800.00},
+		{Id: "103", Items: []string{"Apple Watch S4"}, Destination: "San Jose, CA", Price: 400.00},
+		{Id: "104", Items: []string{"Google Home Mini", "Google Nest Hub"}, Destination: "Mountain View, CA", Price: 400.00},
+		{Id: "105", Items: []string{"Amazon Echo"}, Destination: "San Jose, CA", Price: 30.00},
+		{Id: "106", Items: []string{"Amazon Echo", "Apple iPhone XS"}, Destination: "Mountain View, CA", Price: 300.00},
+	} {
+		s.orderMap[order.Id] = order
+	}
+	return s
+}
+
+// AddOrder implements ecommerce.AddOrder
+func (s *orderServer) AddOrder(ctx context.Context, order *pb.Order) (*wrappers.StringValue, error) {
+	if violations := validateOrder(order); len(violations) > 0 {
+		s.metrics.Added(metrics.OrderInvalid)
+		return nil, rpcerrors.InvalidArgument("an order needs an ID and items", violations...)
+	}
+	s.Lock()
+	s.orderMap[order.Id] = order
+	s.Unlock()
+	s.metrics.Added(metrics.OrderAdded)
+	log.Printf("Order : %s -> Added", order.Id)
+	return &wrappers.StringValue{Value: "Order Added: " + order.Id}, nil
+}
+
+// validateOrder returns the violations of the fields of an order, none if it is valid.
+func validateOrder(order *pb.Order) []*epb.BadRequest_FieldViolation {
+	var violations []*epb.BadRequest_FieldViolation
+	if order.Id == "" {
+		violations = append(violations, rpcerrors.FieldViolation("id", "an order needs an ID"))
+	}
+	if len(order.Items) == 0 {
+		violations = append(violations, rpcerrors.FieldViolation("items", "an order needs items"))
+	}
+	return violations
+}
+
+// GetOrder implements ecommerce.GetOrder
+func (s *orderServer) GetOrder(ctx context.Context, orderId *wrappers.StringValue) (*pb.Order, error) {
+	s.RLock()
+	defer s.RUnlock()
+	order, found := s.orderMap[orderId.Value]
+	if !found {
+		return nil, rpcerrors.NotFound("Order", orderId.Value)
+	}
+	return order, nil
+}
+
+// SearchOrders implements ecommerce.SearchOrders, a server stream of the orders with an
+// item containing the query.
+func (s *orderServer) SearchOrders(searchQuery *wrappers.StringValue, stream pb.OrderManagement_SearchOrdersServer) error {
+	start := time.Now()
+	s.RLock()
+	var found []*pb.Order
+	for _, order := range s.orderMap {
+		for _, item := range order.Items {
+			if strings.Contains(item, searchQuery.Value) {
+				found = append(found, order)
+				break
+			}
+		}
+	}
+	s.RUnlock()
+	s.metrics.Searched(stream.Context(), start, len(found))
+	for _, order := range found {
+		if err := stream.Send(order); err != nil {
+			return fmt.Errorf("error sending message to stream : %v", err)
+		}
+	}
+	return nil
+}
+
+// UpdateOrders implements ecommerce.UpdateOrders, a client stream of the orders to update.
+func (s *orderServer) UpdateOrders(stream pb.OrderManagement_UpdateOrdersServer) error {
+	ordersStr := "Updated Order IDs : "
+	for {
+		order, err := stream.Recv()
+		if err == io.EOF {
+			return stream.SendAndClose(&wrappers.StringValue{Value: "Orders processed " + ordersStr})
+		}
+		if err != nil {
+			return err
+		}
+		s.Lock()
+		s.orderMap[order.Id] = order
+		s.Unlock()
+		s.metrics.Updated()
+		log.Printf("Order ID %s : Updated", order.Id)
+		ordersStr += order.Id + ", "
+	}
+}
+
+// ProcessOrders implements ecommerce.ProcessOrders: it combines the orders received by
+// destination, and emits the combined shipments every orderBatchSize orders and at the
+// end of the client stream.
+func (s *orderServer) ProcessOrders(stream pb.OrderManagement_ProcessOrdersServer) error {
+	shipments := make(map[string]*pb.CombinedShipment)
+	emit := func(trigger string) error {
+		for _, shipment := range shipments {
+			if err := stream.Send(shipment); err != nil {
+				return err
+			}
+			s.metrics.ShipmentEmitted(trigger, len(shipment.OrdersList))
+		}
+		shipments = make(map[string]*pb.CombinedShipment)
+		return nil
+	}
+	for batch := 1; ; batch++ {
+		orderId, err := stream.Recv()
+		if err == io.EOF {
+			return emit(metrics.ShipmentEndOfStream)
+		}
+		if err != nil {
+			return err
+		}
+		s.RLock()
+		order, found := s.orderMap[orderId.GetValue()]
+		s.RUnlock()
+		if !found {
+			return rpcerrors.NotFound("Order", orderId.GetValue())
+		}
+		shipment, ok := shipments[order.Destination]
+		if !ok {
+			shipment = &pb.CombinedShipment{Id: "cmb - " + order.Destination, Status: "Processed!"}
+			shipments[order.Destination] = shipment
+		}
+		shipment.OrdersList = append(shipment.OrdersList, order)
+		if batch%orderBatchSize == 0 {
+			if err := emit(metrics.ShipmentBatch); err != nil {
+				return err
+			}
+		}
+	}
+}
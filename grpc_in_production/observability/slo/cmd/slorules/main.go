@@ -0,0 +1,31 @@
+// Command slorules generates the Prometheus recording and alerting rules of the SLOs of
+// a YAML file, the error budgets and the multi-window burn rate alerts:
+//
+//	observability$ go run ./slo/cmd/slorules -config slo/slos.yaml > slo/rules.yaml
+//	$ promtool check rules slo/rules.yaml
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	"observability/slo"
+)
+
+var config = flag.String("config", "slo/slos.yaml", "YAML file of the SLOs")
+
+func main() {
+	flag.Parse()
+	c, err := slo.Load(*config)
+	if err != nil {
+		log.Fatal(err)
+	}
+	enc := yaml.NewEncoder(os.Stdout)
+	enc.SetIndent(2)
+	if err := enc.Encode(slo.Rules(c)); err != nil {
+		log.Fatalf("failed to write the rules: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package slo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// RuleFile is a Prometheus rule file.
+type RuleFile struct {
+	Groups []RuleGroup `yaml:"groups"`
+}
+
+type RuleGroup struct {
+	Name  string `yaml:"name"`
+	Rules []Rule `yaml:"rules"`
+}
+
+// Rule is a recording rule, or an alerting rule with Alert.
+type Rule struct {
+	Record      string            `yaml:"record,omitempty"`
+	Alert       string            `yaml:"alert,omitempty"`
+	Expr        string            `yaml:"expr"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+// The names of the recording rules and of the alerts, labelled by slo.
+const (
+	// ErrorRatioRecord is the prefix of the ratio of bad calls over a window,
+	// slo:error_ratio:rate1h
+	ErrorRatioRecord = "slo:error_ratio:rate"
+	// ErrorBudgetRecord is the ratio of the error budget left over the window of the SLO,
+	// negative once overspent.
+	ErrorBudgetRecord = "slo:error_budget_remaining:ratio"
+	// BurnAlert is the multi-window burn rate alert.
+	BurnAlert = "SLOErrorBudgetBurn"
+)
+
+// Rules returns the rules of the SLOs, a group for each: the ratio of bad calls over
+// each window, the error budget left, and the burn rate alerts of AlertWindows.
+func Rules(c *Config) *RuleFile {
+	f := &RuleFile{}
+	for i := range c.SLOs {
+		s := &c.SLOs[i]
+		labels := map[string]string{"slo": s.Name}
+		g := RuleGroup{Name: "slo-" + s.Name}
+		for _, w := range windows(s) {
+			g.Rules = append(g.Rules, Rule{Record: ErrorRatioRecord + w.String(), Expr: errorRatioExpr(s, w.String()), Labels: labels})
+		}
+		g.Rules = append(g.Rules, Rule{
+			Record: ErrorBudgetRecord,
+			Expr:   fmt.Sprintf("1 - %s{slo=%q} / %s", ErrorRatioRecord+s.Window.String(), s.Name, number(s.ErrorBudget())),
+			Labels: labels,
+		})
+		for _, w := range AlertWindows {
+			burn := w.BurnRate(s.Window)
+			threshold := number(burn * s.ErrorBudget())
+			g.Rules = append(g.Rules, Rule{
+				Alert: BurnAlert,
+				Expr: fmt.Sprintf("%s{slo=%q} > %s and %s{slo=%q} > %s",
+					ErrorRatioRecord+w.Long.String(), s.Name, threshold, ErrorRatioRecord+w.Short.String(), s.Name, threshold),
+				Labels: map[string]string{"slo": s.Name, "severity": w.Severity, "long_window": w.Long.String()},
+				Annotations: map[string]string{
+					"summary": fmt.Sprintf("%s burns its error budget %sx too fast", s.Name, number(burn)),
+					"description": fmt.Sprintf("%s of the %s error budget of %s (objective %s) burnt in %s, and still burning over the last %s.",
+						percent(w.Consumption), s.Window, s.Name, percent(s.Objective), w.Long, w.Short),
+				},
+			})
+		}
+		f.Groups = append(f.Groups, g)
+	}
+	return f
+}
+
+// errorRatioExpr returns the expression of the ratio of bad calls over a window.
+func errorRatioExpr(s *SLO, window string) string {
+	sel := fmt.Sprintf("grpc_service=%q", s.Service)
+	if s.Method != "" {
+		sel += fmt.Sprintf(",grpc_method=%q", s.Method)
+	}
+	if s.Latency != 0 {
+		return fmt.Sprintf("1 - sum(rate(grpc_server_handling_seconds_bucket{%s,le=%q}[%s])) / sum(rate(grpc_server_handling_seconds_count{%s}[%s]))",
+			sel, s.le(), window, sel, window)
+	}
+	return fmt.Sprintf("sum(rate(grpc_server_handled_total{%s,grpc_code=~%q}[%s])) / sum(rate(grpc_server_handled_total{%s}[%s]))",
+		sel, strings.Join(s.ErrorCodes, "|"), window, sel, window)
+}
+
+// number formats a float without its rounding noise, 0.001 for 1 - 0.999.
+func number(f float64) string {
+	return strconv.FormatFloat(f, 'g', 10, 64)
+}
+
+func percent(f float64) string {
+	return number(f*100) + "%"
+}
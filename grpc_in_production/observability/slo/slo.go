@@ -0,0 +1,206 @@
+// Package slo tracks the service-level objectives of the gRPC methods on the metrics of
+// the server: the availability SLOs on grpc_server_handled_total, the latency SLOs on
+// the grpc_server_handling_seconds histograms.
+//
+// The SLOs are defined in YAML, see Load. From them:
+//   - Rules generates the Prometheus recording and alerting rules, the error budget and
+//     multi-window burn rate alerts (cmd/slorules)
+//   - a Tracker computes the same burn rates and error budgets in the server, from its
+//     own registry, and exports them as metrics
+package slo
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/common/model"
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+
+	"observability/metrics"
+)
+
+// DefaultWindow is the window of the SLOs without one.
+const DefaultWindow = model.Duration(30 * 24 * time.Hour)
+
+// DefaultErrorCodes are the codes of the calls failed by the server, counted against
+// the availability SLOs without error codes. The codes of the calls failed by their
+// client, such as NotFound or InvalidArgument, are not.
+var DefaultErrorCodes = []string{
+	codes.Unknown.String(),
+	codes.DeadlineExceeded.String(),
+	codes.Unimplemented.String(),
+	codes.Internal.String(),
+	codes.Unavailable.String(),
+	codes.DataLoss.String(),
+}
+
+// Config is the YAML definition of the SLOs:
+//
+//	slos:
+//	  - name: getorder-latency
+//	    service: ecommerce.OrderManagement
+//	    method: getOrder
+//	    objective: 0.99   # p99 < 50ms: 99% of the calls handled in 50ms
+//	    latency: 50ms
+//	  - name: getorder-availability
+//	    service: ecommerce.OrderManagement
+//	    method: getOrder
+//	    objective: 0.999
+//	    window: 30d
+type Config struct {
+	SLOs []SLO `yaml:"slos"`
+}
+
+// SLO is the objective of a method, or of every method of a service without method.
+type SLO struct {
+	// Name is the slo label of the rules and of the metrics.
+	Name    string `yaml:"name"`
+	Service string `yaml:"service"`
+	Method  string `yaml:"method"`
+	// Objective is the ratio of good calls over Window, 0.999 for 99.9%.
+	Objective float64        `yaml:"objective"`
+	Window    model.Duration `yaml:"window"`
+	// Latency makes a latency SLO, the good calls are handled within Latency. It is an
+	// upper bound of the buckets of the histograms, metrics.HandlingTimeBuckets.
+	Latency model.Duration `yaml:"latency"`
+	// ErrorCodes are the codes of the bad calls of an availability SLO,
+	// DefaultErrorCodes if empty.
+	ErrorCodes []string `yaml:"errorCodes"`
+}
+
+// ErrorBudget returns the ratio of bad calls the SLO allows over its window.
+func (s *SLO) ErrorBudget() float64 {
+	return 1 - s.Objective
+}
+
+// le returns the le label of the bucket of the latency threshold.
+func (s *SLO) le() string {
+	return strconv.FormatFloat(time.Duration(s.Latency).Seconds(), 'g', -1, 64)
+}
+
+// Load reads the SLOs of a YAML file.
+func Load(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return Parse(data)
+}
+
+// Parse parses and validates the YAML definition of the SLOs, and sets their defaults.
+func Parse(data []byte) (*Config, error) {
+	var c Config
+	if err := yaml.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("invalid SLOs: %v", err)
+	}
+	if len(c.SLOs) == 0 {
+		return nil, errors.New("invalid SLOs: none defined")
+	}
+	names := make(map[string]bool)
+	for i := range c.SLOs {
+		s := &c.SLOs[i]
+		if err := s.validate(); err != nil {
+			return nil, fmt.Errorf("invalid SLO %q: %v", s.Name, err)
+		}
+		if names[s.Name] {
+			return nil, fmt.Errorf("invalid SLO %q: defined twice", s.Name)
+		}
+		names[s.Name] = true
+	}
+	return &c, nil
+}
+
+func (s *SLO) validate() error {
+	if s.Name == "" || s.Service == "" {
+		return errors.New("name and service are required")
+	}
+	if s.Objective <= 0 || s.Objective >= 1 {
+		return fmt.Errorf("objective %v out of (0, 1)", s.Objective)
+	}
+	if s.Window == 0 {
+		s.Window = DefaultWindow
+	}
+	if time.Duration(s.Window) < time.Duration(AlertWindows[len(AlertWindows)-1].Long) {
+		return fmt.Errorf("window %s shorter than the alert windows", s.Window)
+	}
+	if s.Latency != 0 {
+		if len(s.ErrorCodes) > 0 {
+			return errors.New("errorCodes of a latency SLO")
+		}
+		for _, b := range metrics.HandlingTimeBuckets {
+			if b == time.Duration(s.Latency).Seconds() {
+				return nil
+			}
+		}
+		return fmt.Errorf("latency %s is not a bucket of the histograms, one of %v seconds", s.Latency, metrics.HandlingTimeBuckets)
+	}
+	if len(s.ErrorCodes) == 0 {
+		s.ErrorCodes = DefaultErrorCodes
+	}
+	for _, name := range s.ErrorCodes {
+		if !isCode(name) {
+			return fmt.Errorf("unknown error code %q", name)
+		}
+	}
+	return nil
+}
+
+// isCode tells whether name is the name of a gRPC code, the grpc_code label of the
+// metrics.
+func isCode(name string) bool {
+	for c := codes.OK; c <= codes.Unauthenticated; c++ {
+		if c.String() == name {
+			return true
+		}
+	}
+	return false
+}
+
+// AlertWindow is a multi-window burn rate alert: it fires when the SLO burns Consumption
+// of its error budget in Long, and still burns it that fast over Short, so that the
+// alert resets soon after the burn stops.
+type AlertWindow struct {
+	Long, Short model.Duration
+	Consumption float64
+	Severity    string
+}
+
+// AlertWindows are the burn rate alerts of the SLOs, from the Site Reliability
+// Workbook: a page for 2% of the budget in 1h or 5% in 6h, a ticket for 10% in 1d or 3d.
+var AlertWindows = []AlertWindow{
+	{Long: model.Duration(time.Hour), Short: model.Duration(5 * time.Minute), Consumption: 0.02, Severity: "page"},
+	{Long: model.Duration(6 * time.Hour), Short: model.Duration(30 * time.Minute), Consumption: 0.05, Severity: "page"},
+	{Long: model.Duration(24 * time.Hour), Short: model.Duration(2 * time.Hour), Consumption: 0.1, Severity: "ticket"},
+	{Long: model.Duration(72 * time.Hour), Short: model.Duration(6 * time.Hour), Consumption: 0.1, Severity: "ticket"},
+}
+
+// BurnRate returns the burn rate of the alert for an SLO window: 14.4 for 2% of the
+// budget of 30 days in 1h.
+func (w AlertWindow) BurnRate(window model.Duration) float64 {
+	return w.Consumption * float64(window) / float64(w.Long)
+}
+
+// windows returns the windows of the burn rates of an SLO: those of the alerts, shortest
+// first, and the window of the SLO.
+func windows(s *SLO) []model.Duration {
+	seen := make(map[model.Duration]bool)
+	var ws []model.Duration
+	for _, w := range AlertWindows {
+		for _, d := range []model.Duration{w.Short, w.Long} {
+			if !seen[d] {
+				seen[d] = true
+				ws = append(ws, d)
+			}
+		}
+	}
+	if !seen[s.Window] {
+		ws = append(ws, s.Window)
+	}
+	sort.Slice(ws, func(i, j int) bool { return ws[i] < ws[j] })
+	return ws
+}
@@ -0,0 +1,207 @@
+package slo
+
+import (
+	"bytes"
+	"math"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/yaml.v3"
+
+	"observability/metrics"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`
+slos:
+  - name: getorder-latency
+    service: ecommerce.OrderManagement
+    method: getOrder
+    objective: 0.99
+    latency: 50ms
+  - name: productinfo-availability
+    service: ecommerce.ProductInfo
+    objective: 0.999
+    window: 28d
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if s := c.SLOs[0]; s.Window != DefaultWindow || s.ErrorCodes != nil {
+		t.Errorf("latency SLO with window %s and error codes %v, want %s and none", s.Window, s.ErrorCodes, DefaultWindow)
+	}
+	if s := c.SLOs[1]; s.Window.String() != "4w" || len(s.ErrorCodes) != len(DefaultErrorCodes) {
+		t.Errorf("availability SLO with window %s and error codes %v, want 28d and the default ones", s.Window, s.ErrorCodes)
+	}
+
+	for _, invalid := range []string{
+		`slos: []`,
+		`slos: [{name: a, service: s, objective: 1}]`,
+		`slos: [{name: a, service: s, objective: 0.99, latency: 40ms}]`,
+		`slos: [{name: a, service: s, objective: 0.99, window: 1d}]`,
+		`slos: [{name: a, service: s, objective: 0.99, errorCodes: [Unavailable, Timeout]}]`,
+		`slos: [{name: a, service: s, objective: 0.99}, {name: a, service: t, objective: 0.99}]`,
+	} {
+		if _, err := Parse([]byte(invalid)); err == nil {
+			t.Errorf("Parse(%s) succeeded, want an error", invalid)
+		}
+	}
+}
+
+func TestRules(t *testing.T) {
+	c, err := Parse([]byte(`slos: [{name: getorder-availability, service: ecommerce.OrderManagement, method: getOrder, objective: 0.999}]`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	rules := Rules(c).Groups[0].Rules
+	want := map[string]string{
+		"slo:error_ratio:rate5m": `sum(rate(grpc_server_handled_total{grpc_service="ecommerce.OrderManagement",grpc_method="getOrder",grpc_code=~"Unknown|DeadlineExceeded|Unimplemented|Internal|Unavailable|DataLoss"}[5m])) / sum(rate(grpc_server_handled_total{grpc_service="ecommerce.OrderManagement",grpc_method="getOrder"}[5m]))`,
+		ErrorBudgetRecord:        `1 - slo:error_ratio:rate30d{slo="getorder-availability"} / 0.001`,
+		BurnAlert + " 1h":        `slo:error_ratio:rate1h{slo="getorder-availability"} > 0.0144 and slo:error_ratio:rate5m{slo="getorder-availability"} > 0.0144`,
+		BurnAlert + " 3d":        `slo:error_ratio:rate3d{slo="getorder-availability"} > 0.001 and slo:error_ratio:rate6h{slo="getorder-availability"} > 0.001`,
+	}
+	for _, r := range rules {
+		name := r.Record
+		if r.Alert != "" {
+			name = r.Alert + " " + r.Labels["long_window"]
+		}
+		if expr, ok := want[name]; ok {
+			if r.Expr != expr {
+				t.Errorf("%s:\n got %s\nwant %s", name, r.Expr, expr)
+			}
+			delete(want, name)
+		}
+	}
+	for name := range want {
+		t.Errorf("no rule %s", name)
+	}
+}
+
+// The committed rules are those of the committed SLOs.
+func TestRules_File(t *testing.T) {
+	c, err := Load("slos.yaml")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(Rules(c)); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	committed, err := os.ReadFile("rules.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), committed) {
+		t.Errorf("rules.yaml is out of date, run: go run ./slo/cmd/slorules -config slo/slos.yaml > slo/rules.yaml")
+	}
+}
+
+func TestTracker(t *testing.T) {
+	c, err := Parse([]byte(`
+slos:
+  - {name: getorder-availability, service: ecommerce.OrderManagement, method: getOrder, objective: 0.999}
+  - {name: getorder-latency, service: ecommerce.OrderManagement, method: getOrder, objective: 0.99, latency: 50ms}
+`))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// the metrics of the server, as go-grpc-prometheus and metrics.HandlingTime name them
+	handled := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "grpc_server_handled_total"},
+		[]string{"grpc_type", "grpc_service", "grpc_method", "grpc_code"})
+	seconds := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: "grpc_server_handling_seconds", Buckets: metrics.HandlingTimeBuckets},
+		[]string{"grpc_type", "grpc_service", "grpc_method"})
+	reg := prometheus.NewRegistry()
+	tr := NewTracker(c, reg)
+	reg.MustRegister(handled, seconds, tr)
+	calls := func(code string, n int, latency float64) {
+		handled.WithLabelValues("unary", "ecommerce.OrderManagement", "getOrder", code).Add(float64(n))
+		for i := 0; i < n; i++ {
+			seconds.WithLabelValues("unary", "ecommerce.OrderManagement", "getOrder").Observe(latency)
+		}
+	}
+
+	start := time.Now()
+	// the calls of another method don't count
+	handled.WithLabelValues("unary", "ecommerce.OrderManagement", "addOrder", "Internal").Add(10)
+	if err := tr.sample(start); err != nil {
+		t.Fatalf("sample failed: %v", err)
+	}
+	calls("OK", 1000, 0.01)
+	if err := tr.sample(start.Add(55 * time.Minute)); err != nil {
+		t.Fatalf("sample failed: %v", err)
+	}
+	// in the last 5m, 10% of the calls fail and 20% are slow; NotFound is not a failure
+	calls("OK", 65, 0.01)
+	calls("OK", 20, 0.2)
+	calls("NotFound", 5, 0.01)
+	calls("Unavailable", 10, 0.01)
+	if err := tr.sample(start.Add(time.Hour)); err != nil {
+		t.Fatalf("sample failed: %v", err)
+	}
+
+	for _, c := range []struct {
+		name   string
+		labels map[string]string
+		want   float64
+	}{
+		{"slo_burn_rate", map[string]string{"slo": "getorder-availability", "window": "5m"}, 0.1 / 0.001},
+		{"slo_burn_rate", map[string]string{"slo": "getorder-availability", "window": "1h"}, 10.0 / 1100 / 0.001},
+		{"slo_burn_rate", map[string]string{"slo": "getorder-latency", "window": "5m"}, 0.2 / 0.01},
+		{"slo_error_ratio", map[string]string{"slo": "getorder-latency", "window": "1h"}, 20.0 / 1100},
+		// the window of the SLO covers the calls since the start
+		{"slo_error_budget_remaining", map[string]string{"slo": "getorder-availability"}, 1 - 10.0/1100/0.001},
+		{"slo_objective", map[string]string{"slo": "getorder-latency"}, 0.99},
+	} {
+		got, ok := gauge(t, reg, c.name, c.labels)
+		if !ok || math.Abs(got-c.want) > 1e-9 {
+			t.Errorf("%s%v = %v (found %t), want %v", c.name, c.labels, got, ok, c.want)
+		}
+	}
+}
+
+// gauge returns the value of the gauge of reg with the labels.
+func gauge(t *testing.T, reg prometheus.Gatherer, name string, labels map[string]string) (float64, bool) {
+	t.Helper()
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatalf("Gather failed: %v", err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() != name {
+			continue
+		}
+	next:
+		for _, m := range mf.Metric {
+			for k, v := range labels {
+				if label(m, k) != v {
+					continue next
+				}
+			}
+			return m.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// The ratio covers the window ending at the last sample, without the older samples.
+func TestErrorRatio(t *testing.T) {
+	start := time.Now()
+	series := []sample{
+		{t: start, total: 0, bad: 0},
+		{t: start.Add(time.Hour), total: 100, bad: 50},
+		{t: start.Add(2 * time.Hour), total: 200, bad: 50},
+	}
+	if got := errorRatio(series, time.Hour); got != 0 {
+		t.Errorf("errorRatio over the last hour = %v, want 0", got)
+	}
+	if got := errorRatio(series, 3*time.Hour); got != 0.25 {
+		t.Errorf("errorRatio since the start = %v, want 0.25", got)
+	}
+	if got := errorRatio(series[:1], time.Hour); got != 0 {
+		t.Errorf("errorRatio without calls = %v, want 0", got)
+	}
+}
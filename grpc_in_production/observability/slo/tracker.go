@@ -0,0 +1,192 @@
+package slo
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// DefaultInterval is the interval between two samples of the metrics by a Tracker.
+const DefaultInterval = 30 * time.Second
+
+var (
+	objectiveDesc = prometheus.NewDesc("slo_objective", "Ratio of good calls of the SLO over its window.", []string{"slo"}, nil)
+	ratioDesc     = prometheus.NewDesc("slo_error_ratio", "Ratio of bad calls over the window, or since the server started if it is younger.", []string{"slo", "window"}, nil)
+	burnDesc      = prometheus.NewDesc("slo_burn_rate", "Error ratio over the window divided by the error budget, 1 spends the budget exactly over the window of the SLO.", []string{"slo", "window"}, nil)
+	budgetDesc    = prometheus.NewDesc("slo_error_budget_remaining", "Ratio of the error budget left over the window of the SLO, negative once overspent.", []string{"slo"}, nil)
+)
+
+// Tracker computes the error ratios, the burn rates and the error budgets of the SLOs
+// from the metrics of a registry, the server's own: it samples the counters of the calls
+// and keeps the samples of the window of each SLO. It is a prometheus.Collector of the
+// slo_* metrics, and may be registered in the registry it samples.
+//
+// The server only knows its own calls since it started, the windows longer than its
+// uptime cover the calls since it started: the rules of Rules, on the series kept by
+// Prometheus, are the reference for the alerts.
+type Tracker struct {
+	slos     []SLO
+	gatherer prometheus.Gatherer
+
+	mu     sync.Mutex
+	series [][]sample // by SLO, oldest first
+}
+
+// sample is the number of calls of an SLO at a time, and the number of bad ones.
+type sample struct {
+	t          time.Time
+	total, bad float64
+}
+
+// NewTracker returns a tracker of the SLOs of c on the metrics of g.
+func NewTracker(c *Config, g prometheus.Gatherer) *Tracker {
+	return &Tracker{slos: c.SLOs, gatherer: g, series: make([][]sample, len(c.SLOs))}
+}
+
+// Run samples the metrics every interval until ctx is done.
+func (t *Tracker) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if err := t.sample(time.Now()); err != nil {
+			log.Printf("[slo] failed to sample the metrics: %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sample adds a sample of the metrics to the series of every SLO.
+func (t *Tracker) sample(now time.Time) error {
+	// not under t.mu: gathering collects the tracker too
+	mfs, err := t.gatherer.Gather()
+	if err != nil {
+		return err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.slos {
+		s := &t.slos[i]
+		total, bad := count(mfs, s)
+		series := append(t.series[i], sample{t: now, total: total, bad: bad})
+		// keep the last sample at the start of the window, drop the older ones
+		start := 0
+		for j := range series {
+			if series[j].t.After(now.Add(-time.Duration(s.Window))) {
+				break
+			}
+			start = j
+		}
+		t.series[i] = series[start:]
+	}
+	return nil
+}
+
+// count returns the number of calls of an SLO in the metrics, and of bad ones.
+func count(mfs []*dto.MetricFamily, s *SLO) (total, bad float64) {
+	for _, mf := range mfs {
+		switch {
+		case s.Latency == 0 && mf.GetName() == "grpc_server_handled_total":
+			for _, m := range mf.Metric {
+				if !matches(m, s) {
+					continue
+				}
+				v := m.GetCounter().GetValue()
+				total += v
+				if code := label(m, "grpc_code"); contains(s.ErrorCodes, code) {
+					bad += v
+				}
+			}
+		case s.Latency != 0 && mf.GetName() == "grpc_server_handling_seconds":
+			threshold := time.Duration(s.Latency).Seconds()
+			for _, m := range mf.Metric {
+				if !matches(m, s) {
+					continue
+				}
+				h := m.GetHistogram()
+				n := float64(h.GetSampleCount())
+				total += n
+				for _, b := range h.Bucket {
+					if b.GetUpperBound() == threshold {
+						bad += n - float64(b.GetCumulativeCount())
+					}
+				}
+			}
+		}
+	}
+	return total, bad
+}
+
+// matches tells whether a metric is of the service and the method of an SLO.
+func matches(m *dto.Metric, s *SLO) bool {
+	return label(m, "grpc_service") == s.Service && (s.Method == "" || label(m, "grpc_method") == s.Method)
+}
+
+func label(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+func contains(values []string, v string) bool {
+	for _, x := range values {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
+
+// errorRatio returns the ratio of bad calls of a series over the window ending at its
+// last sample, 0 without calls.
+func errorRatio(series []sample, window time.Duration) float64 {
+	last := series[len(series)-1]
+	first := series[0]
+	for _, x := range series {
+		if x.t.After(last.t.Add(-window)) {
+			break
+		}
+		first = x
+	}
+	if last.total == first.total {
+		return 0
+	}
+	return (last.bad - first.bad) / (last.total - first.total)
+}
+
+func (t *Tracker) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{objectiveDesc, ratioDesc, burnDesc, budgetDesc} {
+		ch <- d
+	}
+}
+
+// Collect collects the slo_* metrics of the last sample.
+func (t *Tracker) Collect(ch chan<- prometheus.Metric) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := range t.slos {
+		s := &t.slos[i]
+		ch <- prometheus.MustNewConstMetric(objectiveDesc, prometheus.GaugeValue, s.Objective, s.Name)
+		series := t.series[i]
+		if len(series) == 0 {
+			continue
+		}
+		for _, w := range windows(s) {
+			ratio := errorRatio(series, time.Duration(w))
+			ch <- prometheus.MustNewConstMetric(ratioDesc, prometheus.GaugeValue, ratio, s.Name, w.String())
+			ch <- prometheus.MustNewConstMetric(burnDesc, prometheus.GaugeValue, ratio/s.ErrorBudget(), s.Name, w.String())
+		}
+		budget := 1 - errorRatio(series, time.Duration(s.Window))/s.ErrorBudget()
+		ch <- prometheus.MustNewConstMetric(budgetDesc, prometheus.GaugeValue, budget, s.Name)
+	}
+}
@@ -0,0 +1,89 @@
+package rpcerrors
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Details is an error received by a client, its status and its details, nil those it
+// doesn't have.
+type Details struct {
+	Code       codes.Code
+	Message    string
+	Resource   *epb.ResourceInfo
+	BadRequest *epb.BadRequest
+	Retry      *epb.RetryInfo
+	Info       *epb.ErrorInfo
+	// Localized is the message to show to the user, in the language of AcceptLanguageKey.
+	Localized *epb.LocalizedMessage
+	// Other are the details of other types.
+	Other []interface{}
+}
+
+// Decode returns the status and the details of the error of a call, nil without error.
+// An error which isn't a gRPC status is of code Unknown.
+func Decode(err error) *Details {
+	if err == nil {
+		return nil
+	}
+	st := status.Convert(err)
+	d := &Details{Code: st.Code(), Message: st.Message()}
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *epb.ResourceInfo:
+			d.Resource = detail
+		case *epb.BadRequest:
+			d.BadRequest = detail
+		case *epb.RetryInfo:
+			d.Retry = detail
+		case *epb.ErrorInfo:
+			d.Info = detail
+		case *epb.LocalizedMessage:
+			d.Localized = detail
+		default:
+			// the details which can't be unmarshalled are errors too
+			d.Other = append(d.Other, detail)
+		}
+	}
+	return d
+}
+
+// RetryDelay returns how long to wait before retrying, false if the server didn't say.
+func (d *Details) RetryDelay() (time.Duration, bool) {
+	if d.Retry.GetRetryDelay() == nil {
+		return 0, false
+	}
+	return d.Retry.GetRetryDelay().AsDuration(), true
+}
+
+// Reason returns the reason of the ErrorInfo, empty without.
+func (d *Details) Reason() string {
+	return d.Info.GetReason()
+}
+
+// String returns the code, the message and the details of the error on a line.
+func (d *Details) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s: %s", d.Code, d.Message)
+	if d.Resource != nil {
+		fmt.Fprintf(&b, " [resource %s %s]", d.Resource.ResourceType, d.Resource.ResourceName)
+	}
+	for _, v := range d.BadRequest.GetFieldViolations() {
+		fmt.Fprintf(&b, " [field %s: %s]", v.Field, v.Description)
+	}
+	if delay, ok := d.RetryDelay(); ok {
+		fmt.Fprintf(&b, " [retry in %s]", delay)
+	}
+	if d.Info != nil {
+		fmt.Fprintf(&b, " [%s/%s %v]", d.Info.Domain, d.Info.Reason, d.Info.Metadata)
+	}
+	if d.Localized != nil {
+		fmt.Fprintf(&b, " [%s: %s]", d.Localized.Locale, d.Localized.Message)
+	}
+	return b.String()
+}
@@ -0,0 +1,210 @@
+package rpcerrors
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+
+	"golang.org/x/text/language"
+	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// AcceptLanguageKey is the metadata key of the languages of the client, in the format of
+// the HTTP Accept-Language header: "fr-CH, fr;q=0.9, en;q=0.8".
+const AcceptLanguageKey = "accept-language"
+
+// Fallback is the language of the messages when the client accepts none of the catalogs,
+// its catalog has every message.
+const Fallback = "en"
+
+// A Catalog holds the messages of a language, by key:
+//
+//	NotFound                 without ResourceInfo
+//	NotFound.<type>          the resource of this type, e.g. NotFound.Order, with {id}
+//	NotFound.*               the resource of another type, with {type} and {id}
+//	InvalidArgument          without field violations
+//	InvalidArgument.<field>  the violation of this field, in lower case, e.g. InvalidArgument.id
+//	InvalidArgument.*        the violation of another field, with {field}
+type Catalog map[string]string
+
+//go:embed catalogs/*.json
+var catalogs embed.FS
+
+// DefaultLocalizer localizes with the catalogs of the package, English, French and Spanish.
+var DefaultLocalizer = mustLocalizer(catalogs, "catalogs")
+
+// LoadCatalogs reads the catalogs of the JSON files of dir, one per language named after
+// its tag, fr.json or pt-BR.json.
+func LoadCatalogs(fsys fs.FS, dir string) (map[string]Catalog, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	cs := make(map[string]Catalog)
+	for _, f := range files {
+		data, err := fs.ReadFile(fsys, f)
+		if err != nil {
+			return nil, err
+		}
+		var c Catalog
+		if err := json.Unmarshal(data, &c); err != nil {
+			return nil, fmt.Errorf("catalog %s: %v", f, err)
+		}
+		cs[strings.TrimSuffix(path.Base(f), ".json")] = c
+	}
+	return cs, nil
+}
+
+// Localizer adds the LocalizedMessage of the language the client accepts to the
+// validation and not-found errors.
+type Localizer struct {
+	tags     []language.Tag
+	catalogs []Catalog
+	matcher  language.Matcher
+}
+
+// NewLocalizer returns the localizer of the catalogs by language, which must include
+// the Fallback one.
+func NewLocalizer(cs map[string]Catalog) (*Localizer, error) {
+	if _, ok := cs[Fallback]; !ok {
+		return nil, fmt.Errorf("no %s catalog", Fallback)
+	}
+	// the matcher falls back on its first language
+	l := &Localizer{tags: []language.Tag{language.MustParse(Fallback)}, catalogs: []Catalog{cs[Fallback]}}
+	for lang, c := range cs {
+		if lang == Fallback {
+			continue
+		}
+		tag, err := language.Parse(lang)
+		if err != nil {
+			return nil, fmt.Errorf("catalog %s: %v", lang, err)
+		}
+		l.tags = append(l.tags, tag)
+		l.catalogs = append(l.catalogs, c)
+	}
+	l.matcher = language.NewMatcher(l.tags)
+	return l, nil
+}
+
+func mustLocalizer(fsys fs.FS, dir string) *Localizer {
+	cs, err := LoadCatalogs(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	l, err := NewLocalizer(cs)
+	if err != nil {
+		panic(err)
+	}
+	return l
+}
+
+// Localize returns err with the LocalizedMessage of the language accepted by the client
+// of ctx if it is a NotFound or an InvalidArgument error, in English if the client
+// doesn't accept any of the catalogs. The other errors are returned as is.
+func (l *Localizer) Localize(ctx context.Context, err error) error {
+	st, ok := status.FromError(err)
+	if !ok || (st.Code() != codes.NotFound && st.Code() != codes.InvalidArgument) {
+		return err
+	}
+	var msgs []entry
+	switch d := Decode(err); {
+	case d.Localized != nil:
+		return err
+	case d.Code == codes.NotFound && d.Resource != nil:
+		msgs = []entry{{
+			keys: []string{"NotFound." + d.Resource.ResourceType, "NotFound.*"},
+			vars: strings.NewReplacer("{type}", d.Resource.ResourceType, "{id}", d.Resource.ResourceName),
+		}}
+	case d.Code == codes.NotFound:
+		msgs = []entry{{keys: []string{"NotFound"}}}
+	case len(d.BadRequest.GetFieldViolations()) > 0:
+		// a message for each invalid field
+		for _, v := range d.BadRequest.FieldViolations {
+			msgs = append(msgs, entry{
+				keys: []string{"InvalidArgument." + strings.ToLower(v.Field), "InvalidArgument.*"},
+				vars: strings.NewReplacer("{field}", v.Field),
+			})
+		}
+	default:
+		msgs = []entry{{keys: []string{"InvalidArgument"}}}
+	}
+
+	i := l.match(ctx)
+	msg, ok := message(l.catalogs[i], msgs)
+	if !ok {
+		i = 0
+		msg, _ = message(l.catalogs[0], msgs)
+	}
+	return withDetails(st, &epb.LocalizedMessage{Locale: l.tags[i].String(), Message: msg})
+}
+
+// entry is a message of an error: its keys in the catalogs, the first found wins, and
+// the values of its placeholders.
+type entry struct {
+	keys []string
+	vars *strings.Replacer
+}
+
+// match returns the index of the catalog of the language accepted by the client of ctx,
+// 0 for the fallback.
+func (l *Localizer) match(ctx context.Context) int {
+	md, _ := metadata.FromIncomingContext(ctx)
+	accepted, _, err := language.ParseAcceptLanguage(strings.Join(md.Get(AcceptLanguageKey), ","))
+	if err != nil || len(accepted) == 0 {
+		return 0
+	}
+	_, i, confidence := l.matcher.Match(accepted...)
+	if confidence == language.No {
+		return 0
+	}
+	return i
+}
+
+// message returns the messages of c joined, false if c lacks one of them.
+func message(c Catalog, msgs []entry) (string, bool) {
+	joined := make([]string, 0, len(msgs))
+next:
+	for _, m := range msgs {
+		for _, k := range m.keys {
+			if msg, ok := c[k]; ok {
+				if m.vars != nil {
+					msg = m.vars.Replace(msg)
+				}
+				joined = append(joined, msg)
+				continue next
+			}
+		}
+		return "", false
+	}
+	return strings.Join(joined, " "), true
+}
+
+// UnaryServerInterceptor localizes the errors of the unary calls with l.
+func UnaryServerInterceptor(l *Localizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		resp, err := handler(ctx, req)
+		if err != nil {
+			err = l.Localize(ctx, err)
+		}
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor localizes the errors of the streams with l.
+func StreamServerInterceptor(l *Localizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		err := handler(srv, ss)
+		if err != nil {
+			err = l.Localize(ss.Context(), err)
+		}
+		return err
+	}
+}
@@ -0,0 +1,106 @@
+package rpcerrors
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func acceptLanguage(languages string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs(AcceptLanguageKey, languages))
+}
+
+func TestLocalize(t *testing.T) {
+	invalidOrder := InvalidArgument("an order needs an ID and items",
+		FieldViolation("id", "an order needs an ID"), FieldViolation("items", "an order needs items"))
+	tests := []struct {
+		ctx    context.Context
+		err    error
+		locale string
+		want   string
+	}{
+		{acceptLanguage("fr-CH, fr;q=0.9, en;q=0.8"), NotFound("Order", "999"), "fr", "La commande 999 n'existe pas."},
+		{acceptLanguage("es"), invalidOrder, "es", "Se requiere un ID válido. Se requiere al menos un artículo."},
+		// the fields and the types without their own message
+		{acceptLanguage("fr"), InvalidArgument("invalid", FieldViolation("destination", "")), "fr", "Le champ destination n'est pas valide."},
+		{acceptLanguage("es"), NotFound("Lease", "a1"), "es", "Lease a1 no existe."},
+		{acceptLanguage("fr"), InvalidArgument("invalid product: EOF"), "fr", "La requête n'est pas valide."},
+		{acceptLanguage("fr"), status.Error(codes.NotFound, "gone"), "fr", "La ressource demandée n'existe pas."},
+		// the English fallback
+		{context.Background(), NotFound("Product", "1"), "en", "Product 1 does not exist."},
+		{acceptLanguage("de-DE, ja;q=0.5"), NotFound("Product", "1"), "en", "Product 1 does not exist."},
+		{acceptLanguage("not a language;q=x"), invalidOrder, "en", "A valid ID is required. At least one item is required."},
+	}
+	for _, tt := range tests {
+		d := Decode(DefaultLocalizer.Localize(tt.ctx, tt.err))
+		if d.Localized.GetLocale() != tt.locale || d.Localized.GetMessage() != tt.want {
+			t.Errorf("Localize(%s) = %v, want %s: %s", tt.err, d.Localized, tt.locale, tt.want)
+		}
+		// the other details are kept
+		if want := Decode(tt.err); d.Code != want.Code || d.Message != want.Message ||
+			(want.Resource != nil) != (d.Resource != nil) || (want.BadRequest != nil) != (d.BadRequest != nil) {
+			t.Errorf("Localize(%s) = %s, want the error and its details", tt.err, d)
+		}
+	}
+
+	for _, err := range []error{
+		Unavailable("failing", time.Second),
+		status.Error(codes.Internal, "internal"),
+		// already localized
+		withDetails(status.New(codes.NotFound, "gone"), &epb.LocalizedMessage{Locale: "de", Message: "weg"}),
+	} {
+		if got := DefaultLocalizer.Localize(acceptLanguage("fr"), err); Decode(got).Localized.GetLocale() == "fr" {
+			t.Errorf("Localize(%s) = %s, want it unchanged", err, Decode(got))
+		}
+	}
+}
+
+// A language missing a message of the error is replaced by English as a whole.
+func TestLocalize_Fallback(t *testing.T) {
+	l, err := NewLocalizer(map[string]Catalog{
+		"en": {"InvalidArgument.*": "The field {field} is invalid.", "InvalidArgument.id": "A valid ID is required."},
+		"fr": {"InvalidArgument.id": "Un identifiant valide est requis."},
+	})
+	if err != nil {
+		t.Fatalf("NewLocalizer failed: %v", err)
+	}
+	d := Decode(l.Localize(acceptLanguage("fr"), InvalidArgument("invalid", FieldViolation("id", ""), FieldViolation("items", ""))))
+	if d.Localized.GetLocale() != "en" || d.Localized.GetMessage() != "A valid ID is required. The field items is invalid." {
+		t.Errorf("Localized = %v, want the English messages", d.Localized)
+	}
+
+	if _, err := NewLocalizer(map[string]Catalog{"fr": {}}); err == nil {
+		t.Errorf("NewLocalizer without an English catalog succeeded")
+	}
+}
+
+// Every catalog has the messages of the English one.
+func TestCatalogs(t *testing.T) {
+	cs, err := LoadCatalogs(catalogs, "catalogs")
+	if err != nil {
+		t.Fatalf("LoadCatalogs failed: %v", err)
+	}
+	for lang, c := range cs {
+		for k := range cs[Fallback] {
+			if c[k] == "" {
+				t.Errorf("the %s catalog has no %s message", lang, k)
+			}
+		}
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return nil, NotFound("Order", "999")
+	}
+	_, err := UnaryServerInterceptor(DefaultLocalizer)(acceptLanguage("es"), nil, &grpc.UnaryServerInfo{}, handler)
+	if d := Decode(err); d.String() != "NotFound: Order does not exist for the ID : 999 [resource Order 999] [es: El pedido 999 no existe.]" {
+		t.Errorf("error %s", d)
+	}
+}
@@ -0,0 +1,80 @@
+// Package rpcerrors builds the errors of the servers as gRPC statuses with the standard
+// details of google.golang.org/genproto/googleapis/rpc/errdetails, so that a client,
+// or the REST gateway, tells the errors apart by their code and their details rather
+// than by their message:
+//
+//	return nil, rpcerrors.NotFound("Order", id)                  // NOT_FOUND + ResourceInfo
+//	return nil, rpcerrors.InvalidArgument("Invalid information received",
+//		rpcerrors.FieldViolation("id", "an order needs an ID"))   // INVALID_ARGUMENT + BadRequest
+//	return nil, rpcerrors.Unavailable("backend is failing", time.Second) // UNAVAILABLE + RetryInfo
+//	return nil, rpcerrors.Error(codes.PermissionDenied, "IDENTITY_NOT_ALLOWED", rpcerrors.Domain,
+//		"not allowed", map[string]string{"identity": name})     // + ErrorInfo
+//
+// A client reads them back with Decode.
+//
+// The interceptors of a Localizer add to the NotFound and InvalidArgument errors the
+// LocalizedMessage to show to the user, from the message catalogs of the languages of
+// the accept-language metadata of the call, English by default.
+package rpcerrors
+
+import (
+	"time"
+
+	epb "google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/runtime/protoiface"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Domain is the domain of the ErrorInfo of the errors of the ecommerce services.
+const Domain = "ecommerce.example"
+
+// NotFound returns a NOT_FOUND error with the ResourceInfo of the missing resource, its
+// type ("Order", "Product") and its ID.
+func NotFound(resourceType, id string) error {
+	st := status.Newf(codes.NotFound, "%s does not exist for the ID : %s", resourceType, id)
+	return withDetails(st, &epb.ResourceInfo{ResourceType: resourceType, ResourceName: id})
+}
+
+// InvalidArgument returns an INVALID_ARGUMENT error with a BadRequest of the invalid
+// fields of the request, none if the request is invalid as a whole.
+func InvalidArgument(message string, violations ...*epb.BadRequest_FieldViolation) error {
+	st := status.New(codes.InvalidArgument, message)
+	if len(violations) == 0 {
+		return st.Err()
+	}
+	return withDetails(st, &epb.BadRequest{FieldViolations: violations})
+}
+
+// FieldViolation returns the violation of a field of a request, for InvalidArgument.
+func FieldViolation(field, description string) *epb.BadRequest_FieldViolation {
+	return &epb.BadRequest_FieldViolation{Field: field, Description: description}
+}
+
+// Unavailable returns an UNAVAILABLE error with the RetryInfo telling the client how
+// long to wait before retrying, no RetryInfo if retryDelay is 0.
+func Unavailable(message string, retryDelay time.Duration) error {
+	st := status.New(codes.Unavailable, message)
+	if retryDelay == 0 {
+		return st.Err()
+	}
+	return withDetails(st, &epb.RetryInfo{RetryDelay: durationpb.New(retryDelay)})
+}
+
+// Error returns an error of code with the ErrorInfo of its cause: reason is a constant
+// in UPPER_SNAKE_CASE, unique in domain, and metadata holds the values of the error.
+func Error(code codes.Code, reason, domain, message string, metadata map[string]string) error {
+	st := status.New(code, message)
+	return withDetails(st, &epb.ErrorInfo{Reason: reason, Domain: domain, Metadata: metadata})
+}
+
+// withDetails returns the error of st with the details, the error of st alone if they
+// can't be marshalled.
+func withDetails(st *status.Status, details ...protoiface.MessageV1) error {
+	ds, err := st.WithDetails(details...)
+	if err != nil {
+		return st.Err()
+	}
+	return ds.Err()
+}
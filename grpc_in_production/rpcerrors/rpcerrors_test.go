@@ -0,0 +1,56 @@
+package rpcerrors
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code codes.Code
+		want string
+	}{
+		{NotFound("Order", "999"), codes.NotFound, "NotFound: Order does not exist for the ID : 999 [resource Order 999]"},
+		{InvalidArgument("Invalid information received", FieldViolation("id", "an order needs an ID"), FieldViolation("items", "an order needs items")),
+			codes.InvalidArgument, "InvalidArgument: Invalid information received [field id: an order needs an ID] [field items: an order needs items]"},
+		{InvalidArgument("invalid product"), codes.InvalidArgument, "InvalidArgument: invalid product"},
+		{Unavailable("localhost:50052 is failing", 2*time.Second), codes.Unavailable, "Unavailable: localhost:50052 is failing [retry in 2s]"},
+		{Error(codes.PermissionDenied, "IDENTITY_NOT_ALLOWED", Domain, "not allowed", map[string]string{"identity": "cn:reader"}),
+			codes.PermissionDenied, "PermissionDenied: not allowed [ecommerce.example/IDENTITY_NOT_ALLOWED map[identity:cn:reader]]"},
+		// a plain error reaches the client as Unknown
+		{errors.New("Product does not exist"), codes.Unknown, "Unknown: Product does not exist"},
+	}
+	for _, tt := range tests {
+		d := Decode(tt.err)
+		if d.Code != tt.code {
+			t.Errorf("Decode(%v).Code = %s, want %s", tt.err, d.Code, tt.code)
+		}
+		if got := d.String(); got != tt.want {
+			t.Errorf("Decode(%v) =\n %s\nwant\n %s", tt.err, got, tt.want)
+		}
+	}
+	if Decode(nil) != nil {
+		t.Errorf("Decode(nil) != nil")
+	}
+}
+
+func TestDetails(t *testing.T) {
+	d := Decode(Unavailable("failing", 500*time.Millisecond))
+	if delay, ok := d.RetryDelay(); !ok || delay != 500*time.Millisecond {
+		t.Errorf("RetryDelay() = %s, %t, want 500ms", delay, ok)
+	}
+	if _, ok := Decode(Unavailable("failing", 0)).RetryDelay(); ok {
+		t.Errorf("RetryDelay() of an error without RetryInfo is set")
+	}
+	d = Decode(Error(codes.FailedPrecondition, "ORDER_SHIPPED", Domain, "shipped", nil))
+	if d.Reason() != "ORDER_SHIPPED" || d.Info.Domain != Domain {
+		t.Errorf("ErrorInfo %v, want ORDER_SHIPPED in %s", d.Info, Domain)
+	}
+	if d := Decode(NotFound("Product", "1")); d.Resource.ResourceType != "Product" || d.Reason() != "" {
+		t.Errorf("NotFound details %+v", d)
+	}
+}
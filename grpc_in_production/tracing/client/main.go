@@ -1,15 +1,20 @@
 package main
 
 import (
+	"admin"
 	"context"
+	"flag"
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
-	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
 	pb "grpc_prod/proto-gen"
 	"grpc_prod/tracer"
 	"log"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 )
 
@@ -17,6 +22,14 @@ const (
 	port = ":50051"
 )
 
+var (
+	exporter     = flag.String("exporter", tracer.ExporterOTLP, "where the spans go: otlp, stdout or none")
+	otlpEndpoint = flag.String("otlp-endpoint", tracer.DefaultOTLPEndpoint, "host:port of the OpenTelemetry collector")
+	sampler      = flag.String("sampler", tracer.SamplerParentBasedAlwaysOn, "always_on, always_off, traceidratio or their parentbased_ variants")
+	samplerRatio = flag.Float64("sampler-ratio", 1, "fraction of the traces sampled by the ratio samplers")
+	adminAddr    = flag.String("admin", "", "address of the channelz page with the channel of the client, e.g. :8083; off if empty")
+)
+
 func getHostName() string {
 	hostname := os.Getenv("hostname")
 	if hostname == "" {
@@ -28,24 +41,49 @@ func getHostName() string {
 }
 
 func main() {
-	tracer.RegisterExporterWithTracer()
+	flag.Parse()
+	tp, err := tracer.Init(context.Background(), tracer.Config{
+		ServiceName:  "ecommerce.client",
+		Exporter:     *exporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: true,
+		Sampler:      *sampler,
+		Ratio:        *samplerRatio,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
+	// export the spans still buffered
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := tp.Shutdown(ctx); err != nil {
+			log.Printf("failed to flush the spans: %v", err)
+		}
+	}()
+	tr := otel.Tracer("grpc_prod/client")
 
 	// Set up a connection to the server along with tracing stats handler
 	conn, err := grpc.Dial(
 		getHostName(),
-		grpc.WithInsecure(),
-		grpc.WithStatsHandler(new(ocgrpc.ClientHandler)),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(tracer.NewClientHandler()),
 	)
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
+	if *adminAddr != "" {
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
 	c := pb.NewProductInfoClient(conn)
 
-	// infinite loop with each loop in a 3 sec delay
-	for {
+	// loop with each loop in a 3 sec delay, until interrupted
+	stop, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer cancel()
+	for stop.Err() == nil {
 		// create a context and a span for AddProduct grpc call
-		addProductCtx, addProductSpan := trace.StartSpan(context.Background(), "ecommerce.client.AddProduct")
+		addProductCtx, addProductSpan := tr.Start(context.Background(), "ecommerce.client.AddProduct")
 
 		// Contact the server and print out its response.
 		name := "Sumsung S10"
@@ -55,26 +93,31 @@ func main() {
 		r, err := c.AddProduct(addProductCtx, &pb.Product{Name: name, Description: description, Price: price})
 		if err != nil {
 			// set the status code and error message to span in case there is any error
-			addProductSpan.SetStatus(
-				trace.Status{Code: trace.StatusCodeInternal,
-					Message: err.Error()},
-			)
-			log.Fatalf("Could not add product: %v", err)
+			addProductSpan.SetStatus(codes.Error, err.Error())
+			addProductSpan.End()
+			log.Printf("Could not add product: %v", err)
+			return
 		}
 		// end the add product span to show the end of grpc request sent to AddProduct procedure
 		addProductSpan.End()
 		log.Printf("Product ID: %s added successfully", r.Value)
 
 		// create a context and a span for GetProduct
-		getProductContext, getProductSpan := trace.StartSpan(context.Background(), "ecommerce.client.GetProduct")
+		getProductContext, getProductSpan := tr.Start(context.Background(), "ecommerce.client.GetProduct")
 		product, err := c.GetProduct(getProductContext, &wrapper.StringValue{Value: r.Value})
 		if err != nil {
-			log.Fatalf("Could not get product: %v", err)
+			getProductSpan.SetStatus(codes.Error, err.Error())
+			getProductSpan.End()
+			log.Printf("Could not get product: %v", err)
+			return
 		}
 		// end the add product span to show the end of grpc request sent to GetProduct procedure
 		getProductSpan.End()
-		log.Printf("Product: ", product.String())
+		log.Printf("Product: %s", product.String())
 
-		time.Sleep(3 * time.Second)
+		select {
+		case <-stop.Done():
+		case <-time.After(3 * time.Second):
+		}
 	}
 }
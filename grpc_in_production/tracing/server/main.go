@@ -6,34 +6,50 @@
 package main
 
 import (
+	"admin"
 	"context"
-	"errors"
+	"flag"
 	wrapper "github.com/golang/protobuf/ptypes/wrappers"
 	"github.com/google/uuid"
-	"go.opencensus.io/plugin/ocgrpc"
-	"go.opencensus.io/trace"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
 	"google.golang.org/grpc"
 	pb "grpc_prod/proto-gen"
 	"grpc_prod/tracer"
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"rpcerrors"
 	"sync"
+	"syscall"
+	"time"
 )
 
 const (
 	port = ":50051"
 )
 
+var (
+	exporter     = flag.String("exporter", tracer.ExporterOTLP, "where the spans go: otlp, stdout or none")
+	otlpEndpoint = flag.String("otlp-endpoint", tracer.DefaultOTLPEndpoint, "host:port of the OpenTelemetry collector")
+	sampler      = flag.String("sampler", tracer.SamplerParentBasedAlwaysOn, "always_on, always_off, traceidratio or their parentbased_ variants")
+	samplerRatio = flag.Float64("sampler-ratio", 1, "fraction of the traces sampled by the ratio samplers")
+	adminAddr    = flag.String("admin", "", "address of the channelz page, e.g. :8081, the channelz service is registered too; off if empty")
+)
+
 // server is used to implement ecommerce/product_info.
 type server struct {
 	sync.RWMutex
 	productMap map[string]*pb.Product
+	// tracer starts the spans of the handlers, the children of the span of the stats handler
+	tracer trace.Tracer
 }
 
 // AddProduct implements ecommerce.AddProduct
 func (s *server) AddProduct(ctx context.Context, in *pb.Product) (*wrapper.StringValue, error) {
 	// give a context and name to span
-	ctx, span := trace.StartSpan(ctx, "ecommerce.server.AddProduct")
+	ctx, span := s.tracer.Start(ctx, "ecommerce.server.AddProduct")
 	defer span.End()
 
 	out, err := uuid.NewUUID()
@@ -55,7 +71,7 @@ func (s *server) AddProduct(ctx context.Context, in *pb.Product) (*wrapper.Strin
 // GetProduct implements ecommerce.GetProduct
 func (s *server) GetProduct(ctx context.Context, in *wrapper.StringValue) (*pb.Product, error) {
 	// give a context and name to span
-	ctx, span := trace.StartSpan(ctx, "ecommerce.server.GetProduct")
+	ctx, span := s.tracer.Start(ctx, "ecommerce.server.GetProduct")
 	defer span.End()
 
 	s.Lock()
@@ -66,22 +82,55 @@ func (s *server) GetProduct(ctx context.Context, in *wrapper.StringValue) (*pb.P
 		return value, nil
 	}
 
-	return nil, errors.New("Product does not exist for the ID" + in.Value)
+	err := rpcerrors.NotFound("Product", in.Value)
+	span.SetStatus(codes.Error, err.Error())
+	return nil, err
 }
 
 func main() {
-	tracer.RegisterExporterWithTracer()
+	flag.Parse()
+	tp, err := tracer.Init(context.Background(), tracer.Config{
+		ServiceName:  "ecommerce.server",
+		Exporter:     *exporter,
+		OTLPEndpoint: *otlpEndpoint,
+		OTLPInsecure: true,
+		Sampler:      *sampler,
+		Ratio:        *samplerRatio,
+	})
+	if err != nil {
+		log.Fatalf("failed to set up tracing: %v", err)
+	}
 
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
-	// Create a gRPC Server with OpenCensus Tracer
-	grpcServer := grpc.NewServer(grpc.StatsHandler(&ocgrpc.ServerHandler{}))
+	// Create a gRPC Server with the OpenTelemetry stats handler, the messages of the
+	// errors in the languages of the accept-language metadata
+	grpcServer := grpc.NewServer(
+		grpc.StatsHandler(tracer.NewServerHandler()),
+		grpc.UnaryInterceptor(rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer)),
+	)
 
-	pb.RegisterProductInfoServer(grpcServer, &server{})
+	pb.RegisterProductInfoServer(grpcServer, &server{tracer: tp.Tracer("grpc_prod/server")})
+	if *adminAddr != "" {
+		admin.Register(grpcServer)
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+	}
 
+	go func() {
+		sig := make(chan os.Signal, 1)
+		signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+		<-sig
+		grpcServer.GracefulStop()
+	}()
 	if err := grpcServer.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
+	// export the spans still buffered
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tp.Shutdown(ctx); err != nil {
+		log.Printf("failed to flush the spans: %v", err)
+	}
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	wrapper "github.com/golang/protobuf/ptypes/wrappers"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"google.golang.org/grpc"
+	pb "grpc_prod/proto-gen"
+	"grpc_prod/tracer/tracertest"
+)
+
+func dialProductInfo(t *testing.T, c *tracertest.Collector) pb.ProductInfoClient {
+	conn := tracertest.Dial(t, c, func(s *grpc.Server) {
+		pb.RegisterProductInfoServer(s, &server{tracer: c.Provider.Tracer("grpc_prod/server")})
+	})
+	return pb.NewProductInfoClient(conn)
+}
+
+// The span of a handler is the child of the server span of its call, itself the child
+// of the client span.
+func TestServer_Spans(t *testing.T) {
+	c := tracertest.NewCollector()
+	client := dialProductInfo(t, c)
+
+	ctx, span := c.Provider.Tracer("test").Start(context.Background(), "ecommerce.client.AddProduct")
+	id, err := client.AddProduct(ctx, &pb.Product{Name: "Sumsung S10", Price: 700})
+	if err != nil {
+		t.Fatalf("AddProduct failed: %v", err)
+	}
+	span.End()
+	if _, err := client.GetProduct(context.Background(), id); err != nil {
+		t.Fatalf("GetProduct failed: %v", err)
+	}
+
+	tracertest.AssertTree(t, c, `
+		ecommerce.client.AddProduct
+		  ecommerce.ProductInfo/addProduct (client)
+		    ecommerce.ProductInfo/addProduct (server)
+		      ecommerce.server.AddProduct
+		ecommerce.ProductInfo/getProduct (client)
+		  ecommerce.ProductInfo/getProduct (server)
+		    ecommerce.server.GetProduct
+	`)
+	tree := c.Tree()
+	tracertest.AssertAttribute(t, tree.Find("ecommerce.ProductInfo/addProduct"), semconv.RPCMethod("addProduct"))
+	tracertest.AssertStatus(t, tree.Find("ecommerce.server.GetProduct"), codes.Unset)
+}
+
+// A product not found ends the spans of the call and of the handler with an error.
+func TestServer_NotFound(t *testing.T) {
+	c := tracertest.NewCollector()
+	client := dialProductInfo(t, c)
+
+	if _, err := client.GetProduct(context.Background(), &wrapper.StringValue{Value: "unknown"}); err == nil {
+		t.Fatalf("GetProduct of an unknown ID succeeded, want error")
+	}
+	tracertest.AssertTree(t, c, `
+		ecommerce.ProductInfo/getProduct (client)
+		  ecommerce.ProductInfo/getProduct (server)
+		    ecommerce.server.GetProduct
+	`)
+	tree := c.Tree()
+	call := tree.Find("ecommerce.ProductInfo/getProduct")
+	tracertest.AssertStatus(t, call, codes.Error)
+	// the server returns a NotFound status
+	tracertest.AssertAttribute(t, call.Children[0], semconv.RPCGRPCStatusCodeKey.Int(5))
+	tracertest.AssertStatus(t, tree.Find("ecommerce.server.GetProduct"), codes.Error)
+}
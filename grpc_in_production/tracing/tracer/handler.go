@@ -0,0 +1,180 @@
+package tracer
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+)
+
+// InstrumentationName names the tracer of the stats handlers.
+const InstrumentationName = "grpc_prod/tracer"
+
+// MessageEvent is the name of the event added to the span of a call for every message
+// sent or received.
+const MessageEvent = "message"
+
+// Option configures a stats handler.
+type Option func(*handler)
+
+// WithTracerProvider starts the spans with tp instead of the global provider.
+func WithTracerProvider(tp trace.TracerProvider) Option {
+	return func(h *handler) { h.tracer = tp.Tracer(InstrumentationName) }
+}
+
+// WithPropagator carries the trace context with p instead of the global propagator.
+func WithPropagator(p propagation.TextMapPropagator) Option {
+	return func(h *handler) { h.propagator = p }
+}
+
+// handler is a grpc stats.Handler tracing the calls of a client or of a server.
+type handler struct {
+	kind       trace.SpanKind
+	tracer     trace.Tracer
+	propagator propagation.TextMapPropagator
+}
+
+// NewServerHandler returns a stats handler for grpc.StatsHandler starting a server span
+// for every call, the child of the span of the client when the metadata carry one.
+func NewServerHandler(opts ...Option) stats.Handler {
+	return newHandler(trace.SpanKindServer, opts)
+}
+
+// NewClientHandler returns a stats handler for grpc.WithStatsHandler starting a client
+// span for every call, and sending its trace context in the metadata.
+func NewClientHandler(opts ...Option) stats.Handler {
+	return newHandler(trace.SpanKindClient, opts)
+}
+
+func newHandler(kind trace.SpanKind, opts []Option) *handler {
+	h := &handler{kind: kind}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.tracer == nil {
+		h.tracer = otel.Tracer(InstrumentationName)
+	}
+	if h.propagator == nil {
+		h.propagator = otel.GetTextMapPropagator()
+	}
+	return h
+}
+
+// callKey is the context key of the *call of an RPC.
+type callKey struct{}
+
+// call counts the messages of an RPC, to number their events.
+type call struct {
+	sent, received int64
+	// stream is whether the client or the server streams
+	stream bool
+	// remote is the span of the client of a server call
+	remote trace.SpanContext
+}
+
+func (h *handler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	name, attrs := spanInfo(info.FullMethodName)
+	c := &call{}
+	if h.kind == trace.SpanKindServer {
+		md, _ := metadata.FromIncomingContext(ctx)
+		ctx = h.propagator.Extract(ctx, metadataCarrier(md))
+		c.remote = trace.SpanContextFromContext(ctx)
+	}
+	ctx, _ = h.tracer.Start(ctx, name, trace.WithSpanKind(h.kind), trace.WithAttributes(attrs...))
+	if h.kind == trace.SpanKindClient {
+		// the headers are built from the outgoing metadata after TagRPC
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		h.propagator.Inject(ctx, metadataCarrier(md))
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	return context.WithValue(ctx, callKey{}, c)
+}
+
+func (h *handler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	span := trace.SpanFromContext(ctx)
+	c, _ := ctx.Value(callKey{}).(*call)
+	if c == nil {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.Begin:
+		c.stream = s.IsClientStream || s.IsServerStream
+	case *stats.InPayload:
+		span.AddEvent(MessageEvent, trace.WithTimestamp(s.RecvTime), trace.WithAttributes(
+			semconv.MessageTypeReceived,
+			semconv.MessageIDKey.Int64(atomic.AddInt64(&c.received, 1)),
+			semconv.MessageUncompressedSizeKey.Int(s.Length),
+			semconv.MessageCompressedSizeKey.Int(s.WireLength),
+		))
+	case *stats.OutPayload:
+		span.AddEvent(MessageEvent, trace.WithTimestamp(s.SentTime), trace.WithAttributes(
+			semconv.MessageTypeSent,
+			semconv.MessageIDKey.Int64(atomic.AddInt64(&c.sent, 1)),
+			semconv.MessageUncompressedSizeKey.Int(s.Length),
+			semconv.MessageCompressedSizeKey.Int(s.WireLength),
+		))
+	case *stats.End:
+		st := status.Convert(s.Error)
+		span.SetAttributes(semconv.RPCGRPCStatusCodeKey.Int(int(st.Code())))
+		if c.stream {
+			span.SetAttributes(
+				MessagesSentKey.Int64(atomic.LoadInt64(&c.sent)),
+				MessagesReceivedKey.Int64(atomic.LoadInt64(&c.received)),
+			)
+		}
+		if s.Error != nil {
+			span.SetStatus(otelcodes.Error, st.Message())
+		}
+		span.End(trace.WithTimestamp(s.EndTime))
+	}
+}
+
+func (h *handler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (h *handler) HandleConn(context.Context, stats.ConnStats) {}
+
+// spanInfo returns the span name and the attributes of a method /package.Service/Method:
+// package.Service/Method, as in the OpenTelemetry conventions for RPC.
+func spanInfo(fullMethod string) (string, []attribute.KeyValue) {
+	name := strings.TrimPrefix(fullMethod, "/")
+	attrs := []attribute.KeyValue{semconv.RPCSystemGRPC}
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		attrs = append(attrs, semconv.RPCService(name[:i]), semconv.RPCMethod(name[i+1:]))
+	}
+	return name, attrs
+}
+
+// metadataCarrier carries the trace context in the gRPC metadata: the W3C traceparent
+// and tracestate headers, and baggage.
+type metadataCarrier metadata.MD
+
+func (c metadataCarrier) Get(key string) string {
+	if values := metadata.MD(c).Get(key); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func (c metadataCarrier) Set(key, value string) {
+	metadata.MD(c).Set(key, value)
+}
+
+func (c metadataCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+	return keys
+}
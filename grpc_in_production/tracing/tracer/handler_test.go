@@ -0,0 +1,191 @@
+package tracer
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	otelcodes "go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// newProvider returns a provider of the sampler recording its spans in memory.
+func newProvider(t *testing.T, sampler string) (*sdktrace.TracerProvider, *tracetest.InMemoryExporter) {
+	t.Helper()
+	exporter := tracetest.NewInMemoryExporter()
+	tp, err := NewProvider(Config{ServiceName: "test", Sampler: sampler}, exporter)
+	if err != nil {
+		t.Fatalf("NewProvider failed: %v", err)
+	}
+	t.Cleanup(func() { tp.Shutdown(context.Background()) })
+	return tp, exporter
+}
+
+// dialHealth serves the health service over bufconn, traced with serverTP, and returns
+// a client traced with clientTP.
+func dialHealth(t *testing.T, serverTP, clientTP trace.TracerProvider) healthpb.HealthClient {
+	t.Helper()
+	propagator := propagation.TraceContext{}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StatsHandler(NewServerHandler(WithTracerProvider(serverTP), WithPropagator(propagator))))
+	healthpb.RegisterHealthServer(s, health.NewServer())
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(NewClientHandler(WithTracerProvider(clientTP), WithPropagator(propagator))),
+	)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return healthpb.NewHealthClient(conn)
+}
+
+// waitSpans returns the spans of exporter once it holds n of them: the server ends its
+// span after sending the status, maybe after the client returned.
+func waitSpans(t *testing.T, exporter *tracetest.InMemoryExporter, n int) tracetest.SpanStubs {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		spans := exporter.GetSpans()
+		if len(spans) >= n || time.Now().After(deadline) {
+			return spans
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func attr(attrs []attribute.KeyValue, key attribute.Key) attribute.Value {
+	for _, a := range attrs {
+		if a.Key == key {
+			return a.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+// The server span of a call is the child of its client span, across the metadata.
+func TestHandlers(t *testing.T) {
+	tp, exporter := newProvider(t, SamplerAlwaysOn)
+	client := dialHealth(t, tp, tp)
+
+	ctx, parent := tp.Tracer("test").Start(context.Background(), "ecommerce.client.Check")
+	if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	parent.End()
+
+	spans := waitSpans(t, exporter, 3)
+	if len(spans) != 3 {
+		t.Fatalf("got %d spans, want the server, client and parent spans", len(spans))
+	}
+	server, clientSpan := spans[0], spans[1]
+	if server.SpanKind == trace.SpanKindClient {
+		server, clientSpan = clientSpan, server
+	}
+	if server.SpanKind != trace.SpanKindServer || clientSpan.SpanKind != trace.SpanKindClient {
+		t.Fatalf("spans of kinds %v and %v, want a server and a client span", server.SpanKind, clientSpan.SpanKind)
+	}
+	const name = "grpc.health.v1.Health/Check"
+	if server.Name != name || clientSpan.Name != name {
+		t.Errorf("span names = %q, %q, want %q", server.Name, clientSpan.Name, name)
+	}
+	if clientSpan.Parent.SpanID() != parent.SpanContext().SpanID() {
+		t.Errorf("the client span is not a child of the span of its context")
+	}
+	if !server.Parent.IsRemote() || server.Parent.SpanID() != clientSpan.SpanContext.SpanID() ||
+		server.SpanContext.TraceID() != clientSpan.SpanContext.TraceID() {
+		t.Errorf("the server span is not a remote child of the client span")
+	}
+	if got := attr(server.Attributes, semconv.RPCServiceKey).AsString(); got != "grpc.health.v1.Health" {
+		t.Errorf("rpc.service = %q, want grpc.health.v1.Health", got)
+	}
+
+	// one message each way
+	for _, span := range []tracetest.SpanStub{server, clientSpan} {
+		if len(span.Events) != 2 {
+			t.Errorf("%v span has %d events, want 2", span.SpanKind, len(span.Events))
+			continue
+		}
+		for _, e := range span.Events {
+			if e.Name != MessageEvent || attr(e.Attributes, semconv.MessageIDKey).AsInt64() != 1 {
+				t.Errorf("%v span event %s %v, want the first message", span.SpanKind, e.Name, e.Attributes)
+			}
+		}
+	}
+}
+
+// A failed call ends both spans with an error status and its gRPC code.
+func TestHandlers_Error(t *testing.T) {
+	tp, exporter := newProvider(t, SamplerAlwaysOn)
+	client := dialHealth(t, tp, tp)
+
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: "unknown"}); err == nil {
+		t.Fatalf("Check of an unknown service succeeded, want NotFound")
+	}
+	for _, span := range waitSpans(t, exporter, 2) {
+		if span.Status.Code != otelcodes.Error {
+			t.Errorf("%v span status = %v, want Error", span.SpanKind, span.Status)
+		}
+		// codes.NotFound
+		if got := attr(span.Attributes, semconv.RPCGRPCStatusCodeKey).AsInt64(); got != 5 {
+			t.Errorf("%v span status code = %d, want 5", span.SpanKind, got)
+		}
+	}
+}
+
+// A parent-based server follows the sampling decision of the client.
+func TestHandlers_ParentBased(t *testing.T) {
+	serverTP, serverSpans := newProvider(t, SamplerParentBasedAlwaysOn)
+	clientTP, clientSpans := newProvider(t, SamplerAlwaysOff)
+	client := dialHealth(t, serverTP, clientTP)
+
+	if _, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{}); err != nil {
+		t.Fatalf("Check failed: %v", err)
+	}
+	if n := len(clientSpans.GetSpans()) + len(serverSpans.GetSpans()); n != 0 {
+		t.Errorf("got %d spans of a trace the client didn't sample, want none", n)
+	}
+}
+
+func TestNewSampler(t *testing.T) {
+	for _, tt := range []struct {
+		name  string
+		ratio float64
+		want  string
+	}{
+		{"", 0, "ParentBased{root:AlwaysOnSampler"},
+		{SamplerAlwaysOff, 0, "AlwaysOffSampler"},
+		{SamplerTraceIDRatio, 0.25, "TraceIDRatioBased{0.25}"},
+		{SamplerParentBasedTraceIDRatio, 0.5, "ParentBased{root:TraceIDRatioBased{0.5}"},
+	} {
+		s, err := NewSampler(tt.name, tt.ratio)
+		if err != nil {
+			t.Errorf("NewSampler(%q) failed: %v", tt.name, err)
+			continue
+		}
+		if got := s.Description(); len(got) < len(tt.want) || got[:len(tt.want)] != tt.want {
+			t.Errorf("NewSampler(%q) = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+	if _, err := NewSampler(SamplerTraceIDRatio, 2); err == nil {
+		t.Errorf("NewSampler with a ratio of 2 succeeded, want error")
+	}
+	if _, err := NewSampler("sometimes", 0); err == nil {
+		t.Errorf("NewSampler of an unknown sampler succeeded, want error")
+	}
+}
@@ -0,0 +1,50 @@
+package tracer
+
+import (
+	"context"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of the span of a streaming call, set when the stream ends.
+const (
+	MessagesSentKey     = attribute.Key("rpc.grpc.messages_sent")
+	MessagesReceivedKey = attribute.Key("rpc.grpc.messages_received")
+)
+
+// Received returns the sequence number, from 1, of the last message received by the
+// call of ctx, the context of a stream or of a handler. It is 0 without a stats handler
+// of this package.
+func Received(ctx context.Context) int64 {
+	if c, ok := ctx.Value(callKey{}).(*call); ok {
+		return atomic.LoadInt64(&c.received)
+	}
+	return 0
+}
+
+// Sent returns the sequence number, from 1, of the last message sent by the call of ctx.
+func Sent(ctx context.Context) int64 {
+	if c, ok := ctx.Value(callKey{}).(*call); ok {
+		return atomic.LoadInt64(&c.sent)
+	}
+	return 0
+}
+
+// SenderLink returns a link to the message id sent by the client of the server call of
+// ctx: the span of the client stream, with the message.id of its event for the message.
+// A span built from several messages of a stream, such as a batch, links to each of
+// them. The link is invalid, and ignored by the tracer, when the client didn't send its
+// trace context.
+func SenderLink(ctx context.Context, id int64) trace.Link {
+	c, ok := ctx.Value(callKey{}).(*call)
+	if !ok {
+		return trace.Link{}
+	}
+	return trace.Link{
+		SpanContext: c.remote,
+		Attributes:  []attribute.KeyValue{semconv.MessageTypeSent, semconv.MessageIDKey.Int64(id)},
+	}
+}
@@ -0,0 +1,120 @@
+package tracer
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// batchDesc is a bidirectional stream answering the messages of the client with a single
+// message, sent in a batch span linked to them.
+func batchDesc(tp *sdktrace.TracerProvider) *grpc.ServiceDesc {
+	return &grpc.ServiceDesc{
+		ServiceName: "test.Batcher",
+		HandlerType: (*interface{})(nil),
+		Streams: []grpc.StreamDesc{{
+			StreamName:    "Batch",
+			ServerStreams: true,
+			ClientStreams: true,
+			Handler: func(_ interface{}, stream grpc.ServerStream) error {
+				ctx := stream.Context()
+				var links []trace.Link
+				for {
+					if err := stream.RecvMsg(&wrapperspb.StringValue{}); err == io.EOF {
+						break
+					} else if err != nil {
+						return err
+					}
+					links = append(links, SenderLink(ctx, Received(ctx)))
+				}
+				_, span := tp.Tracer("test").Start(ctx, "batch", trace.WithLinks(links...))
+				defer span.End()
+				return stream.SendMsg(&wrapperspb.StringValue{Value: "batch"})
+			},
+		}},
+	}
+}
+
+// The batch span of the server is a child of the server stream, linked to the messages
+// of the client stream.
+func TestStream(t *testing.T) {
+	tp, exporter := newProvider(t, SamplerAlwaysOn)
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StatsHandler(NewServerHandler(WithTracerProvider(tp), WithPropagator(propagation.TraceContext{}))))
+	s.RegisterService(batchDesc(tp), nil)
+	go s.Serve(lis)
+	defer s.Stop()
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(NewClientHandler(WithTracerProvider(tp), WithPropagator(propagation.TraceContext{}))),
+	)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	defer conn.Close()
+
+	stream, err := conn.NewStream(context.Background(), &batchDesc(tp).Streams[0], "/test.Batcher/Batch")
+	if err != nil {
+		t.Fatalf("NewStream failed: %v", err)
+	}
+	for i := 1; i <= 3; i++ {
+		if err := stream.SendMsg(&wrapperspb.StringValue{Value: "order"}); err != nil {
+			t.Fatalf("SendMsg failed: %v", err)
+		}
+		if got := Sent(stream.Context()); got != int64(i) {
+			t.Errorf("Sent = %d after %d messages", got, i)
+		}
+	}
+	stream.CloseSend()
+	if err := stream.RecvMsg(&wrapperspb.StringValue{}); err != nil {
+		t.Fatalf("RecvMsg failed: %v", err)
+	}
+	if err := stream.RecvMsg(&wrapperspb.StringValue{}); err != io.EOF {
+		t.Fatalf("RecvMsg = %v, want the end of the stream", err)
+	}
+
+	byName := make(map[string]sdktrace.ReadOnlySpan)
+	var client, server sdktrace.ReadOnlySpan
+	for _, span := range waitSpans(t, exporter, 3).Snapshots() {
+		byName[span.Name()] = span
+		switch span.SpanKind() {
+		case trace.SpanKindClient:
+			client = span
+		case trace.SpanKindServer:
+			server = span
+		}
+	}
+	batch := byName["batch"]
+	if client == nil || server == nil || batch == nil {
+		t.Fatalf("got spans %v, want the client, server and batch spans", byName)
+	}
+	if batch.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("the batch span is not a child of the server stream")
+	}
+	if len(batch.Links()) != 3 {
+		t.Fatalf("the batch span has %d links, want one per message", len(batch.Links()))
+	}
+	for i, link := range batch.Links() {
+		if link.SpanContext.SpanID() != client.SpanContext().SpanID() ||
+			attr(link.Attributes, semconv.MessageIDKey).AsInt64() != int64(i+1) {
+			t.Errorf("link %d = %v %v, want the message %d of the client span", i, link.SpanContext.SpanID(), link.Attributes, i+1)
+		}
+	}
+	if got := attr(server.Attributes(), MessagesReceivedKey).AsInt64(); got != 3 {
+		t.Errorf("the server stream received %d messages, want 3", got)
+	}
+	if got := attr(client.Attributes(), MessagesSentKey).AsInt64(); got != 3 {
+		t.Errorf("the client stream sent %d messages, want 3", got)
+	}
+}
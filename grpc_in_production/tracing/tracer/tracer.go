@@ -1,32 +1,158 @@
+// Package tracer traces gRPC calls with OpenTelemetry.
+//
+// Init installs a tracer provider exporting the spans to an OTLP collector, to stdout or
+// to memory, with a configurable sampler, and the W3C trace context propagator. The
+// stats handlers of NewServerHandler and NewClientHandler start a span for every call
+// and carry the traceparent header in the gRPC metadata, so that the server span of a
+// call is a child of its client span.
 package tracer
 
 import (
-	"contrib.go.opencensus.io/exporter/zipkin"
+	"context"
 	"fmt"
-	openzipkin "github.com/openzipkin/zipkin-go"
-	zipkinHTTP "github.com/openzipkin/zipkin-go/reporter/http"
-	"go.opencensus.io/trace"
-	"log"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.20.0"
+)
+
+// Exporters, the values of Config.Exporter.
+const (
+	// ExporterOTLP sends the spans to an OpenTelemetry collector over gRPC.
+	ExporterOTLP = "otlp"
+	// ExporterStdout writes the spans to stdout as JSON.
+	ExporterStdout = "stdout"
+	// ExporterMemory keeps the spans in a tracetest.InMemoryExporter, for the tests.
+	ExporterMemory = "memory"
+	// ExporterNone drops the spans, the trace context is still propagated.
+	ExporterNone = "none"
 )
 
+// Samplers, the values of Config.Sampler. They are the names of the
+// OTEL_TRACES_SAMPLER environment variable.
 const (
-	grpcServerPort   = ":50051"
-	zipkinServerPort = "9411"
+	SamplerAlwaysOn                = "always_on"
+	SamplerAlwaysOff               = "always_off"
+	SamplerTraceIDRatio            = "traceidratio"
+	SamplerParentBasedAlwaysOn     = "parentbased_always_on"
+	SamplerParentBasedAlwaysOff    = "parentbased_always_off"
+	SamplerParentBasedTraceIDRatio = "parentbased_traceidratio"
 )
 
-func NewExporter() *zipkin.Exporter {
-	// 1. Configure exporter to export traces to Zipkin.
-	localEndpoint, err := openzipkin.NewEndpoint("ecommerce service tracing", "localhost"+grpcServerPort)
+// DefaultOTLPEndpoint is the gRPC port of a local OpenTelemetry collector.
+const DefaultOTLPEndpoint = "localhost:4317"
+
+// Config configures the tracer provider of Init.
+type Config struct {
+	// ServiceName is the service.name of the spans, the name of the program if empty.
+	ServiceName string
+	// Exporter is one of the Exporter constants, ExporterOTLP if empty.
+	Exporter string
+	// OTLPEndpoint is the host:port of the collector, DefaultOTLPEndpoint if empty.
+	OTLPEndpoint string
+	// OTLPInsecure sends the spans to the collector without TLS.
+	OTLPInsecure bool
+	// Sampler is one of the Sampler constants, SamplerParentBasedAlwaysOn if empty.
+	Sampler string
+	// Ratio is the fraction of the traces sampled by the ratio samplers, from 0 to 1.
+	Ratio float64
+}
+
+// NewSampler returns the sampler of a Sampler constant. The parent-based samplers follow
+// the sampling decision of the caller for the spans of a remote parent, and apply the
+// named sampler to the root spans only.
+func NewSampler(name string, ratio float64) (sdktrace.Sampler, error) {
+	if (name == SamplerTraceIDRatio || name == SamplerParentBasedTraceIDRatio) && (ratio < 0 || ratio > 1) {
+		return nil, fmt.Errorf("invalid sampler ratio %v, want a value from 0 to 1", ratio)
+	}
+	switch name {
+	case SamplerAlwaysOn:
+		return sdktrace.AlwaysSample(), nil
+	case SamplerAlwaysOff:
+		return sdktrace.NeverSample(), nil
+	case SamplerTraceIDRatio:
+		return sdktrace.TraceIDRatioBased(ratio), nil
+	case SamplerParentBasedAlwaysOn, "":
+		return sdktrace.ParentBased(sdktrace.AlwaysSample()), nil
+	case SamplerParentBasedAlwaysOff:
+		return sdktrace.ParentBased(sdktrace.NeverSample()), nil
+	case SamplerParentBasedTraceIDRatio:
+		return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio)), nil
+	}
+	return nil, fmt.Errorf("unknown sampler %q", name)
+}
+
+// NewExporter returns the span exporter of cfg, nil for ExporterNone.
+func NewExporter(ctx context.Context, cfg Config) (sdktrace.SpanExporter, error) {
+	switch cfg.Exporter {
+	case ExporterOTLP, "":
+		endpoint := cfg.OTLPEndpoint
+		if endpoint == "" {
+			endpoint = DefaultOTLPEndpoint
+		}
+		opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(endpoint)}
+		if cfg.OTLPInsecure {
+			opts = append(opts, otlptracegrpc.WithInsecure())
+		}
+		// the client connects in the background, a collector down doesn't fail Init
+		return otlptracegrpc.New(ctx, opts...)
+	case ExporterStdout:
+		return stdouttrace.New(stdouttrace.WithPrettyPrint())
+	case ExporterMemory:
+		return tracetest.NewInMemoryExporter(), nil
+	case ExporterNone:
+		return nil, nil
+	}
+	return nil, fmt.Errorf("unknown exporter %q", cfg.Exporter)
+}
+
+// NewProvider returns a tracer provider sampling with the sampler of cfg and exporting
+// to exporter, which may be nil to drop the spans. The spans are exported in batches,
+// but synchronously by a tracetest.InMemoryExporter so that the tests see them at once.
+func NewProvider(cfg Config, exporter sdktrace.SpanExporter) (*sdktrace.TracerProvider, error) {
+	sampler, err := NewSampler(cfg.Sampler, cfg.Ratio)
+	if err != nil {
+		return nil, err
+	}
+	name := cfg.ServiceName
+	if name == "" {
+		name = os.Args[0]
+	}
+	// schemaless, the schema of the default resource is the one of the SDK
+	res, err := resource.Merge(resource.Default(), resource.NewSchemaless(semconv.ServiceName(name)))
 	if err != nil {
-		log.Fatalf("Failed to create the local zipkinEndpoint: %v", err)
+		return nil, err
 	}
-	reporter := zipkinHTTP.NewReporter(fmt.Sprintf("http://localhost:%s/api/v2/spans", zipkinServerPort))
-	zipkinExporter := zipkin.NewExporter(reporter, localEndpoint)
-	return zipkinExporter
+	opts := []sdktrace.TracerProviderOption{sdktrace.WithSampler(sampler), sdktrace.WithResource(res)}
+	switch exporter.(type) {
+	case nil:
+	case *tracetest.InMemoryExporter:
+		opts = append(opts, sdktrace.WithSyncer(exporter))
+	default:
+		opts = append(opts, sdktrace.WithBatcher(exporter))
+	}
+	return sdktrace.NewTracerProvider(opts...), nil
 }
 
-func RegisterExporterWithTracer() {
-	trace.RegisterExporter(NewExporter())
-	// 2. Configure 100% sample rate, otherwise, few traces will be sampled.
-	trace.ApplyConfig(trace.Config{DefaultSampler: trace.AlwaysSample()})
+// Init installs the tracer provider of cfg and the W3C trace context and baggage
+// propagators as the global ones, used by the stats handlers and otel.Tracer. The
+// provider must be shut down before exiting to export the spans still buffered.
+func Init(ctx context.Context, cfg Config) (*sdktrace.TracerProvider, error) {
+	exporter, err := NewExporter(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+	tp, err := NewProvider(cfg, exporter)
+	if err != nil {
+		return nil, err
+	}
+	otel.SetTracerProvider(tp)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	return tp, nil
 }
@@ -0,0 +1,251 @@
+// Package tracertest collects the spans of gRPC calls in memory and asserts them in tests.
+//
+// A Collector records the spans of its tracer provider. Dial serves a gRPC server over
+// bufconn with the stats handlers of the tracer package bound to the Collector, and
+// returns a client traced the same way, so that a test sees both sides of its calls:
+//
+//	c := tracertest.NewCollector()
+//	conn := tracertest.Dial(t, c, func(s *grpc.Server) {
+//		pb.RegisterProductInfoServer(s, &server{tracer: c.Provider.Tracer("test")})
+//	})
+//	... make calls with conn ...
+//	tracertest.AssertTree(t, c, `
+//	ecommerce.ProductInfo/addProduct (client)
+//	  ecommerce.ProductInfo/addProduct (server)
+//	    ecommerce.server.AddProduct`)
+package tracertest
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+	"grpc_prod/tracer"
+)
+
+// WaitTimeout is how long the assertions wait for the spans still open: the server ends
+// the span of a call after sending its status, maybe after the client returned.
+var WaitTimeout = 2 * time.Second
+
+// Collector records the spans ended by Provider, which samples every trace.
+type Collector struct {
+	Provider *sdktrace.TracerProvider
+	exporter *tracetest.InMemoryExporter
+}
+
+// NewCollector returns a Collector, its provider doesn't need to be shut down.
+func NewCollector() *Collector {
+	exporter := tracetest.NewInMemoryExporter()
+	tp, err := tracer.NewProvider(tracer.Config{ServiceName: "test", Sampler: tracer.SamplerAlwaysOn}, exporter)
+	if err != nil {
+		// the sampler is valid
+		panic(err)
+	}
+	return &Collector{Provider: tp, exporter: exporter}
+}
+
+// Spans returns the spans ended so far, in the order they ended.
+func (c *Collector) Spans() []sdktrace.ReadOnlySpan {
+	return c.exporter.GetSpans().Snapshots()
+}
+
+// Wait returns the spans once at least n of them ended, or after WaitTimeout.
+func (c *Collector) Wait(n int) []sdktrace.ReadOnlySpan {
+	deadline := time.Now().Add(WaitTimeout)
+	for {
+		spans := c.Spans()
+		if len(spans) >= n || time.Now().After(deadline) {
+			return spans
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Reset forgets the spans ended so far.
+func (c *Collector) Reset() {
+	c.exporter.Reset()
+}
+
+// Tree returns the spans ended so far as a tree.
+func (c *Collector) Tree() Tree {
+	return NewTree(c.Spans())
+}
+
+// Dial serves the services registered by register on a bufconn listener, and returns a
+// client connection to it. The server and the client trace the calls with the stats
+// handlers of the tracer package, the W3C trace context propagator and the provider of
+// c. Both are closed at the end of the test.
+func Dial(t testing.TB, c *Collector, register func(*grpc.Server), opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	propagator := propagation.TraceContext{}
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer(grpc.StatsHandler(tracer.NewServerHandler(
+		tracer.WithTracerProvider(c.Provider), tracer.WithPropagator(propagator))))
+	register(s)
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithStatsHandler(tracer.NewClientHandler(
+			tracer.WithTracerProvider(c.Provider), tracer.WithPropagator(propagator))),
+	}, opts...)
+	conn, err := grpc.Dial("bufnet", opts...)
+	if err != nil {
+		t.Fatalf("did not connect: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// Node is a span of a Tree, with its children in the order they started.
+type Node struct {
+	Span     sdktrace.ReadOnlySpan
+	Children []*Node
+}
+
+// Tree is the roots of a set of spans, the spans whose parent is not in the set, in the
+// order they started.
+type Tree []*Node
+
+// NewTree returns the tree of spans.
+func NewTree(spans []sdktrace.ReadOnlySpan) Tree {
+	nodes := make(map[trace.SpanID]*Node, len(spans))
+	for _, s := range spans {
+		nodes[s.SpanContext().SpanID()] = &Node{Span: s}
+	}
+	var roots Tree
+	for _, s := range spans {
+		n := nodes[s.SpanContext().SpanID()]
+		if parent, ok := nodes[s.Parent().SpanID()]; ok && s.Parent().TraceID() == s.SpanContext().TraceID() {
+			parent.Children = append(parent.Children, n)
+		} else {
+			roots = append(roots, n)
+		}
+	}
+	byStart(roots)
+	for _, n := range nodes {
+		byStart(n.Children)
+	}
+	return roots
+}
+
+func byStart(nodes []*Node) {
+	sort.SliceStable(nodes, func(i, j int) bool {
+		return nodes[i].Span.StartTime().Before(nodes[j].Span.StartTime())
+	})
+}
+
+// String returns a line per span, its name and its kind when it is a client or a
+// server span, indented by two spaces per level:
+//
+//	ecommerce.ProductInfo/addProduct (client)
+//	  ecommerce.ProductInfo/addProduct (server)
+//	    ecommerce.server.AddProduct
+func (t Tree) String() string {
+	var b strings.Builder
+	var write func(nodes []*Node, depth int)
+	write = func(nodes []*Node, depth int) {
+		for _, n := range nodes {
+			b.WriteString(strings.Repeat("  ", depth))
+			b.WriteString(n.Span.Name())
+			switch kind := n.Span.SpanKind(); kind {
+			case trace.SpanKindClient, trace.SpanKindServer:
+				fmt.Fprintf(&b, " (%s)", kind)
+			}
+			b.WriteByte('\n')
+			write(n.Children, depth+1)
+		}
+	}
+	write(t, 0)
+	return b.String()
+}
+
+// Find returns the first span named name, depth first, or nil.
+func (t Tree) Find(name string) *Node {
+	for _, n := range t {
+		if n.Span.Name() == name {
+			return n
+		}
+		if found := Tree(n.Children).Find(name); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// AssertTree checks that the spans of c make the tree want, in the format of
+// Tree.String. The indentation common to the lines of want and the blank lines around
+// it are ignored. It waits up to WaitTimeout for the spans still open.
+func AssertTree(t testing.TB, c *Collector, want string) {
+	t.Helper()
+	want = dedent(want)
+	deadline := time.Now().Add(WaitTimeout)
+	for {
+		got := c.Tree().String()
+		if got == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("span tree:\n%s\nwant:\n%s", got, want)
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// dedent removes the blank lines around s and the indentation of its first line from
+// every line, and ends it with a newline.
+func dedent(s string) string {
+	s = strings.TrimRight(strings.TrimLeft(s, "\n"), " \t\n")
+	lines := strings.Split(s, "\n")
+	indent := lines[0][:len(lines[0])-len(strings.TrimLeft(lines[0], " \t"))]
+	for i, line := range lines {
+		lines[i] = strings.TrimPrefix(line, indent)
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
+
+// AssertStatus checks the status code of the span n.
+func AssertStatus(t testing.TB, n *Node, want codes.Code) {
+	t.Helper()
+	if n == nil {
+		t.Errorf("no span, want one of status %v", want)
+		return
+	}
+	if got := n.Span.Status().Code; got != want {
+		t.Errorf("span %s has the status %v %q, want %v", n.Span.Name(), got, n.Span.Status().Description, want)
+	}
+}
+
+// AssertAttribute checks that the span n has the attribute want.
+func AssertAttribute(t testing.TB, n *Node, want attribute.KeyValue) {
+	t.Helper()
+	if n == nil {
+		t.Errorf("no span, want one with %s=%s", want.Key, want.Value.Emit())
+		return
+	}
+	for _, kv := range n.Span.Attributes() {
+		if kv.Key == want.Key {
+			if kv.Value != want.Value {
+				t.Errorf("span %s has %s=%s, want %s", n.Span.Name(), kv.Key, kv.Value.Emit(), want.Value.Emit())
+			}
+			return
+		}
+	}
+	t.Errorf("span %s has no %s attribute, want %s", n.Span.Name(), want.Key, want.Value.Emit())
+}
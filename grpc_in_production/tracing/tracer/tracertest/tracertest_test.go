@@ -0,0 +1,45 @@
+package tracertest
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// The spans whose parent was not collected are roots, the children are in the order
+// they started.
+func TestTree(t *testing.T) {
+	c := NewCollector()
+	tr := c.Provider.Tracer("test")
+	// a remote parent, as the one of the server span of a client which isn't traced
+	remote := trace.ContextWithRemoteSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID: trace.TraceID{1}, SpanID: trace.SpanID{1}, TraceFlags: trace.FlagsSampled, Remote: true,
+	}))
+	ctx, server := tr.Start(remote, "ecommerce.ProductInfo/getProduct", trace.WithSpanKind(trace.SpanKindServer))
+	_, first := tr.Start(ctx, "first")
+	_, second := tr.Start(ctx, "second", trace.WithAttributes(attribute.String("order.id", "101")))
+	second.SetStatus(codes.Error, "failed")
+	second.End()
+	first.End()
+	server.End()
+
+	AssertTree(t, c, `
+		ecommerce.ProductInfo/getProduct (server)
+		  first
+		  second
+	`)
+	tree := c.Tree()
+	AssertStatus(t, tree.Find("second"), codes.Error)
+	AssertAttribute(t, tree.Find("second"), attribute.String("order.id", "101"))
+	if tree.Find("third") != nil {
+		t.Errorf("Find of a span which doesn't exist returned a span")
+	}
+
+	c.Reset()
+	if spans := c.Spans(); len(spans) != 0 {
+		t.Errorf("got %d spans after Reset, want none", len(spans))
+	}
+}
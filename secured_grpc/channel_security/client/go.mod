@@ -3,8 +3,10 @@ module client
 go 1.18
 
 require (
+	admin v0.0.0-00010101000000-000000000000
 	google.golang.org/grpc v1.55.0
 	google.golang.org/protobuf v1.30.0
+	pki v0.0.0-00010101000000-000000000000
 )
 
 require (
@@ -14,3 +16,7 @@ require (
 	golang.org/x/text v0.8.0 // indirect
 	google.golang.org/genproto v0.0.0-20230306155012-7f2fa6fef1f4 // indirect
 )
+
+replace pki => ../pki
+
+replace admin => ../../../grpc_in_production/admin
@@ -1,13 +1,17 @@
 package main
 
 import (
+	"admin"
 	// pb "client/ecommerce"
 	pb "client/ecommerce"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
+	"flag"
+	"fmt"
 	"io/ioutil"
 	"log"
+	"pki"
 	"time"
 
 	"google.golang.org/grpc"
@@ -20,14 +24,20 @@ var (
 	crtFile  = "cert/client.crt"
 	keyFile  = "cert/client.key"
 	caFile   = "cert/ca.crt"
+
+	repeat    = flag.Duration("repeat", 0, "call the server again every interval on the same connection, e.g. 5s")
+	adminAddr = flag.String("admin", "", "address of the channelz page with the channel of the client, e.g. :8083, served until interrupted; off if empty")
 )
 
 func main() {
-	// Create X.509 key pairs directly from the server certificate and key.
-	certificate, err := tls.LoadX509KeyPair(crtFile, keyFile)
+	flag.Parse()
+	// Create X.509 key pairs directly from the client certificate and key,
+	// reloaded when the files are rotated.
+	certificate, err := pki.NewReloader(crtFile, keyFile, pki.DefaultReloadInterval)
 	if err != nil {
 		log.Fatalf("failed to load credentials: %v", err)
 	}
+	defer certificate.Close()
 	// Create a certificate pool from the CA.
 	certPool := x509.NewCertPool()
 	ca, err := ioutil.ReadFile(caFile)
@@ -41,9 +51,9 @@ func main() {
 
 	opts := []grpc.DialOption{
 		grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{
-			ServerName:   hostname, // NOTE: this is required!
-			Certificates: []tls.Certificate{certificate},
-			RootCAs:      certPool,
+			ServerName:           hostname, // NOTE: this is required!
+			GetClientCertificate: certificate.GetClientCertificate,
+			RootCAs:              certPool,
 		})),
 	}
 
@@ -52,9 +62,26 @@ func main() {
 		log.Fatalf("did not connect: %v", err)
 	}
 	defer conn.Close()
+	if *adminAddr != "" {
+		go func() { log.Fatal(admin.ListenAndServe(*adminAddr)) }()
+		defer admin.Linger(*adminAddr)
+	}
 
 	c := pb.NewProductInfoClient(conn)
+	if err := addAndGetProduct(c); err != nil {
+		log.Fatal(err)
+	}
+	// Keep calling on the same connection, it stays up while the certificates
+	// are rotated and reloaded.
+	for *repeat > 0 {
+		time.Sleep(*repeat)
+		if err := addAndGetProduct(c); err != nil {
+			log.Print(err)
+		}
+	}
+}
 
+func addAndGetProduct(c pb.ProductInfoClient) error {
 	// Contact the server and print out its response.
 	name := "Sumsung S10"
 	description := "Samsung Galaxy S10 is the latest smart phone, launched in February 2019"
@@ -66,13 +93,14 @@ func main() {
 	// Add a product
 	r, err := c.AddProduct(ctx, &pb.Product{Name: name, Description: description, Price: price})
 	if err != nil {
-		log.Fatalf("Could not add product: %v", err)
+		return fmt.Errorf("Could not add product: %v", err)
 	}
 	log.Printf("Product ID: %s added successfully", r.Value)
 	// get the same product details which we added
 	product, err := c.GetProduct(ctx, &pb.ProductID{Value: r.Value})
 	if err != nil {
-		log.Fatalf("Could not get product: %v", err)
+		return fmt.Errorf("Could not get product: %v", err)
 	}
 	log.Printf("Product: %s", product.String())
+	return nil
 }
@@ -0,0 +1,167 @@
+// Command certgen generates the certificates of the mTLS examples, like gen_cert.sh
+// without openssl. Run it again to rotate the server and client certificates, the
+// running servers and clients reload them without restarting:
+//
+//	pki$ go run ./cmd/certgen -validity 1h
+//
+// It also keeps the CRL of the CA, copied to server/cert/crl.pem, and serves the local
+// stand-in for OCSP:
+//
+//	pki$ go run ./cmd/certgen -revoke ../client/cert/client.crt
+//	pki$ go run ./cmd/certgen -renew-crl -serve-status :8090
+package main
+
+import (
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"pki"
+)
+
+var (
+	dir        = flag.String("dir", "..", "channel_security directory, holding ca.crt and the client and server directories")
+	newCA      = flag.Bool("new-ca", false, "generate a new CA even if ca.crt exists, the servers and clients must then be restarted")
+	caValidity = flag.Duration("ca-validity", pki.DefaultCAValidity, "validity of a new CA")
+	validity   = flag.Duration("validity", pki.DefaultLeafValidity, "validity of the server and client certificates")
+	clientCN   = flag.String("client-cn", "product-client", "common name of the client certificate")
+	clientURI  = flag.String("client-uri", "", "URI SAN of the client certificate, e.g. spiffe://ecommerce.example/product-client")
+
+	revoke      = flag.String("revoke", "", "comma separated certificate files to revoke, only the CRL is written")
+	renewCRL    = flag.Bool("renew-crl", false, "only sign a new CRL, with the same revoked certificates")
+	crlValidity = flag.Duration("crl-validity", pki.DefaultCRLValidity, "validity of the CRL")
+	serveStatus = flag.String("serve-status", "", "address serving the revocation status of the certificates from the CRL, e.g. :8090")
+)
+
+func main() {
+	flag.Parse()
+	caCert, caKey := filepath.Join(*dir, "ca.crt"), filepath.Join(*dir, "ca.key")
+	crlFile := filepath.Join(*dir, "crl.pem")
+
+	ca, err := pki.LoadCA(caCert, caKey)
+	if *newCA || os.IsNotExist(err) {
+		if ca, err = pki.NewCA("ecommerce CA", *caValidity); err != nil {
+			log.Fatalf("failed to generate the CA: %v", err)
+		}
+		if err := ca.WriteFiles(caCert, caKey); err != nil {
+			log.Fatalf("failed to write the CA: %v", err)
+		}
+		log.Printf("generated a CA valid until %s", ca.Cert.NotAfter.Format(time.RFC3339))
+	} else if err != nil {
+		log.Fatalf("failed to load the CA: %v", err)
+	}
+
+	switch {
+	case *revoke != "":
+		var revoked []pkix.RevokedCertificate
+		for _, file := range strings.Split(*revoke, ",") {
+			cert := readCertificate(file)
+			revoked = append(revoked, pkix.RevokedCertificate{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()})
+			log.Printf("revoking %s : serial %x, CN %q", file, cert.SerialNumber, cert.Subject.CommonName)
+		}
+		writeCRL(ca, crlFile, revoked)
+	case *renewCRL:
+		writeCRL(ca, crlFile, nil)
+	default:
+		issue("server", pki.LeafOptions{
+			CommonName:  "*.server.com",
+			DNSNames:    []string{"localhost"},
+			IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1)},
+			Validity:    *validity,
+			Server:      true,
+		}, ca)
+
+		clientOpts := pki.LeafOptions{CommonName: *clientCN, Validity: *validity, Client: true}
+		if *clientURI != "" {
+			u, err := url.Parse(*clientURI)
+			if err != nil {
+				log.Fatalf("invalid client URI: %v", err)
+			}
+			clientOpts.URIs = []*url.URL{u}
+		}
+		issue("client", clientOpts, ca)
+		writeCRL(ca, crlFile, nil)
+	}
+
+	if *serveStatus != "" {
+		log.Printf("serving the revocation status on %s", *serveStatus)
+		log.Fatal(http.ListenAndServe(*serveStatus, pki.StatusHandler(crlFile, ca.Cert)))
+	}
+}
+
+// issue writes the certificate of name and the CA certificate in <dir>/<name>/cert.
+func issue(name string, opts pki.LeafOptions, ca *pki.CA) {
+	certDir := filepath.Join(*dir, name, "cert")
+	if err := os.WriteFile(filepath.Join(certDir, "ca.crt"), ca.CertPEM(), 0o644); err != nil {
+		log.Fatalf("failed to write the CA certificate: %v", err)
+	}
+	certPEM, keyPEM, err := ca.Issue(opts)
+	if err != nil {
+		log.Fatalf("failed to issue the %s certificate: %v", name, err)
+	}
+	certFile, keyFile := filepath.Join(certDir, name+".crt"), filepath.Join(certDir, name+".key")
+	if err := pki.WriteKeyPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+		log.Fatalf("failed to write the %s certificate: %v", name, err)
+	}
+	log.Printf("issued %s, valid for %v", certFile, opts.Validity)
+}
+
+// writeCRL signs a CRL revoking the certificates of the current CRL and the new ones,
+// and writes it to crlFile and to the server.
+func writeCRL(ca *pki.CA, crlFile string, newlyRevoked []pkix.RevokedCertificate) {
+	var revoked []pkix.RevokedCertificate
+	if crlPEM, err := os.ReadFile(crlFile); err == nil {
+		crl, err := pki.ParseCRL(crlPEM, ca.Cert)
+		if err != nil {
+			// e.g. the CRL of a previous CA
+			log.Printf("starting a new CRL, the current one can't be read: %v", err)
+		} else {
+			revoked = crl.RevokedCertificates
+		}
+	}
+	for _, r := range newlyRevoked {
+		if !isRevoked(revoked, r) {
+			revoked = append(revoked, r)
+		}
+	}
+
+	crlPEM, err := ca.CreateCRL(revoked, *crlValidity)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, file := range []string{crlFile, filepath.Join(*dir, "server", "cert", "crl.pem")} {
+		if err := pki.WriteFile(file, crlPEM, 0o644); err != nil {
+			log.Fatalf("failed to write the CRL: %v", err)
+		}
+	}
+	log.Printf("signed %s : %d revoked certificates, valid for %v", crlFile, len(revoked), *crlValidity)
+}
+
+func isRevoked(revoked []pkix.RevokedCertificate, r pkix.RevokedCertificate) bool {
+	for _, other := range revoked {
+		if other.SerialNumber.Cmp(r.SerialNumber) == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func readCertificate(file string) *x509.Certificate {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		log.Fatal(err)
+	}
+	cert, err := pki.ParseCertificate(data)
+	if err != nil {
+		log.Fatalf("failed to parse %s: %v", file, err)
+	}
+	return cert
+}
@@ -0,0 +1,221 @@
+// Package pki generates the certificate authority and the leaf certificates of the
+// mTLS examples, reloads rotated certificates from disk (see Reloader) and rejects
+// the revoked ones (see RevocationChecker).
+//
+// It replaces gen_cert.sh: the keys are ECDSA P-256 and the certificates are short
+// lived, rotate them with cmd/certgen before they expire.
+package pki
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// DefaultCAValidity is how long a new CA is valid.
+	DefaultCAValidity = 365 * 24 * time.Hour
+	// DefaultLeafValidity is how long a leaf certificate is valid.
+	DefaultLeafValidity = 30 * 24 * time.Hour
+	// clockSkew backdates the certificates, so that they are valid on hosts whose clock is a bit late.
+	clockSkew = 5 * time.Minute
+)
+
+// CA is a certificate authority signing leaf certificates.
+type CA struct {
+	Cert *x509.Certificate
+	Key  crypto.Signer
+}
+
+// NewCA generates a self-signed CA valid for validity, DefaultCAValidity if 0.
+func NewCA(commonName string, validity time.Duration) (*CA, error) {
+	if validity == 0 {
+		validity = DefaultCAValidity
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the CA key: %v", err)
+	}
+	template, err := newTemplate(commonName, validity)
+	if err != nil {
+		return nil, err
+	}
+	template.IsCA = true
+	template.BasicConstraintsValid = true
+	template.KeyUsage = x509.KeyUsageCertSign | x509.KeyUsageCRLSign | x509.KeyUsageDigitalSignature
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create the CA certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return nil, err
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// LoadCA reads a CA from PEM files, such as the ones written by WriteFiles or by gen_cert.sh.
+func LoadCA(certFile, keyFile string) (*CA, error) {
+	pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load the CA: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		return nil, err
+	}
+	if !cert.IsCA {
+		return nil, fmt.Errorf("%s is not a CA certificate", certFile)
+	}
+	key, ok := pair.PrivateKey.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported CA key type %T", pair.PrivateKey)
+	}
+	return &CA{Cert: cert, Key: key}, nil
+}
+
+// ParseCertificate parses the first PEM encoded certificate of certPEM.
+func ParseCertificate(certPEM []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(certPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no CERTIFICATE PEM block")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// CertPEM returns the certificate of the CA, to put in the pools of the peers.
+func (ca *CA) CertPEM() []byte {
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: ca.Cert.Raw})
+}
+
+// WriteFiles writes the certificate and the key of the CA.
+func (ca *CA) WriteFiles(certFile, keyFile string) error {
+	keyPEM, err := encodeKey(ca.Key)
+	if err != nil {
+		return err
+	}
+	return WriteKeyPair(certFile, keyFile, ca.CertPEM(), keyPEM)
+}
+
+// LeafOptions describes a leaf certificate. A server certificate needs the names the
+// clients dial in DNSNames or IPAddresses, a client certificate identifies the client
+// with its CommonName or a SPIFFE ID in URIs.
+type LeafOptions struct {
+	CommonName  string
+	DNSNames    []string
+	IPAddresses []net.IP
+	URIs        []*url.URL
+	// Validity is how long the certificate is valid, DefaultLeafValidity if 0.
+	// It is capped by the expiry of the CA.
+	Validity time.Duration
+	// Server and Client set the extended key usages, the certificate can be both.
+	Server, Client bool
+}
+
+// Issue generates a key and a certificate signed by the CA, both PEM encoded.
+func (ca *CA) Issue(opts LeafOptions) (certPEM, keyPEM []byte, err error) {
+	if !opts.Server && !opts.Client {
+		return nil, nil, errors.New("a leaf certificate needs the server or the client usage")
+	}
+	if opts.Validity == 0 {
+		opts.Validity = DefaultLeafValidity
+	}
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate the key: %v", err)
+	}
+	template, err := newTemplate(opts.CommonName, opts.Validity)
+	if err != nil {
+		return nil, nil, err
+	}
+	if template.NotAfter.After(ca.Cert.NotAfter) {
+		template.NotAfter = ca.Cert.NotAfter
+	}
+	template.DNSNames = opts.DNSNames
+	template.IPAddresses = opts.IPAddresses
+	template.URIs = opts.URIs
+	template.KeyUsage = x509.KeyUsageDigitalSignature
+	if opts.Server {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageServerAuth)
+	}
+	if opts.Client {
+		template.ExtKeyUsage = append(template.ExtKeyUsage, x509.ExtKeyUsageClientAuth)
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.Cert, key.Public(), ca.Key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to sign the certificate: %v", err)
+	}
+	keyPEM, err = encodeKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), keyPEM, nil
+}
+
+func newTemplate(commonName string, validity time.Duration) (*x509.Certificate, error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate the serial number: %v", err)
+	}
+	now := time.Now()
+	return &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    now.Add(-clockSkew),
+		NotAfter:     now.Add(validity),
+	}, nil
+}
+
+func encodeKey(key crypto.Signer) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode the key: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// WriteKeyPair writes a certificate and its key. Each file is written to a temporary
+// file renamed over the old one, so that a Reloader never reads a partial file, and the
+// key is written first: a Reloader reading the new key with the old certificate fails
+// to load the pair and retries once the certificate is written too.
+func WriteKeyPair(certFile, keyFile string, certPEM, keyPEM []byte) error {
+	if err := WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return err
+	}
+	return WriteFile(certFile, certPEM, 0o644)
+}
+
+// WriteFile writes data to a temporary file renamed to name, so that the readers of
+// name see either the old or the new content.
+func WriteFile(name string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(name), "."+filepath.Base(name)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), name)
+}
@@ -0,0 +1,220 @@
+package pki
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestCA(t *testing.T) *CA {
+	ca, err := NewCA("test CA", time.Hour)
+	if err != nil {
+		t.Fatalf("NewCA failed: %v", err)
+	}
+	return ca
+}
+
+func pool(ca *CA) *x509.CertPool {
+	p := x509.NewCertPool()
+	p.AddCert(ca.Cert)
+	return p
+}
+
+func parse(t *testing.T, certPEM, keyPEM []byte) *x509.Certificate {
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair failed: %v", err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatalf("ParseCertificate failed: %v", err)
+	}
+	return cert
+}
+
+func TestIssue(t *testing.T) {
+	ca := newTestCA(t)
+	certPEM, keyPEM, err := ca.Issue(LeafOptions{CommonName: "server", DNSNames: []string{"localhost"}, Validity: 2 * time.Hour, Server: true})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	cert := parse(t, certPEM, keyPEM)
+	if _, err := cert.Verify(x509.VerifyOptions{DNSName: "localhost", Roots: pool(ca), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth}}); err != nil {
+		t.Errorf("server certificate doesn't verify: %v", err)
+	}
+	if _, err := cert.Verify(x509.VerifyOptions{Roots: pool(ca), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err == nil {
+		t.Errorf("server certificate verifies as a client certificate")
+	}
+	if cert.NotAfter.After(ca.Cert.NotAfter) {
+		t.Errorf("certificate expires at %v, after its CA at %v", cert.NotAfter, ca.Cert.NotAfter)
+	}
+	if _, _, err := ca.Issue(LeafOptions{CommonName: "nothing"}); err == nil {
+		t.Errorf("Issue without usage succeeded, want error")
+	}
+}
+
+func TestLoadCA(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	if err := ca.WriteFiles(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key")); err != nil {
+		t.Fatalf("WriteFiles failed: %v", err)
+	}
+	loaded, err := LoadCA(filepath.Join(dir, "ca.crt"), filepath.Join(dir, "ca.key"))
+	if err != nil {
+		t.Fatalf("LoadCA failed: %v", err)
+	}
+	certPEM, keyPEM, err := loaded.Issue(LeafOptions{CommonName: "client", Client: true})
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	if _, err := parse(t, certPEM, keyPEM).Verify(x509.VerifyOptions{Roots: pool(ca), KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth}}); err != nil {
+		t.Errorf("certificate of the loaded CA doesn't verify with the original one: %v", err)
+	}
+}
+
+// The server and the client both reload their rotated certificate: the new connections
+// use it, the established one keeps going.
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	issue := func(name string, opts LeafOptions) {
+		certPEM, keyPEM, err := ca.Issue(opts)
+		if err != nil {
+			t.Fatalf("Issue failed: %v", err)
+		}
+		if err := WriteKeyPair(filepath.Join(dir, name+".crt"), filepath.Join(dir, name+".key"), certPEM, keyPEM); err != nil {
+			t.Fatalf("WriteKeyPair failed: %v", err)
+		}
+	}
+	serverOpts := LeafOptions{CommonName: "server", DNSNames: []string{"localhost"}, Server: true}
+	clientOpts := LeafOptions{CommonName: "client", Client: true}
+	issue("server", serverOpts)
+	issue("client", clientOpts)
+
+	serverCerts, err := NewReloader(filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	defer serverCerts.Close()
+	clientCerts, err := NewReloader(filepath.Join(dir, "client.crt"), filepath.Join(dir, "client.key"), 10*time.Millisecond)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	defer clientCerts.Close()
+
+	// the server echoes lines and each connection tells the client serial it saw
+	clientSerials := make(chan string, 10)
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		GetCertificate: serverCerts.GetCertificate,
+		ClientAuth:     tls.RequireAndVerifyClientCert,
+		ClientCAs:      pool(ca),
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				r := bufio.NewReader(conn)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if state := conn.(*tls.Conn).ConnectionState(); len(clientSerials) == 0 {
+						clientSerials <- state.PeerCertificates[0].SerialNumber.String()
+					}
+					conn.Write([]byte(line))
+				}
+			}()
+		}
+	}()
+
+	dial := func() (*tls.Conn, string) {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{
+			ServerName:           "localhost",
+			RootCAs:              pool(ca),
+			GetClientCertificate: clientCerts.GetClientCertificate,
+		})
+		if err != nil {
+			t.Fatalf("failed to dial: %v", err)
+		}
+		echo(t, conn)
+		return conn, conn.ConnectionState().PeerCertificates[0].SerialNumber.String()
+	}
+
+	conn1, serverSerial1 := dial()
+	defer conn1.Close()
+	clientSerial1 := <-clientSerials
+
+	issue("server", serverOpts)
+	issue("client", clientOpts)
+	deadline := time.Now().Add(5 * time.Second)
+	for serverCerts.Certificate().Leaf.SerialNumber.String() == serverSerial1 ||
+		clientCerts.Certificate().Leaf.SerialNumber.String() == clientSerial1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("the rotated certificates were not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	conn2, serverSerial2 := dial()
+	defer conn2.Close()
+	if serverSerial2 == serverSerial1 {
+		t.Errorf("new connection got the old server certificate")
+	}
+	if clientSerial2 := <-clientSerials; clientSerial2 == clientSerial1 {
+		t.Errorf("new connection sent the old client certificate")
+	}
+	// the connection established with the old certificates is still up
+	echo(t, conn1)
+}
+
+func echo(t *testing.T, conn *tls.Conn) {
+	t.Helper()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.Write([]byte("ping\n")); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	if line, err := bufio.NewReader(conn).ReadString('\n'); err != nil || line != "ping\n" {
+		t.Fatalf("echo = %q, %v, want ping", line, err)
+	}
+}
+
+// A key pair which doesn't match, e.g. the new key with the old certificate, is not
+// loaded: the reloader keeps the previous one.
+func TestReloader_KeepsCurrentOnError(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	certPEM, keyPEM, _ := ca.Issue(LeafOptions{CommonName: "server", Server: true})
+	certFile, keyFile := filepath.Join(dir, "server.crt"), filepath.Join(dir, "server.key")
+	if err := WriteKeyPair(certFile, keyFile, certPEM, keyPEM); err != nil {
+		t.Fatalf("WriteKeyPair failed: %v", err)
+	}
+	r, err := NewReloader(certFile, keyFile, time.Hour)
+	if err != nil {
+		t.Fatalf("NewReloader failed: %v", err)
+	}
+	defer r.Close()
+	before := r.Certificate()
+
+	_, otherKey, _ := ca.Issue(LeafOptions{CommonName: "server", Server: true})
+	if err := WriteFile(keyFile, otherKey, 0o600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	if _, err := r.reload(); err == nil {
+		t.Errorf("reload of a mismatched pair succeeded, want error")
+	}
+	if r.Certificate() != before {
+		t.Errorf("certificate changed after a failed reload")
+	}
+}
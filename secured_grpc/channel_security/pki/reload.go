@@ -0,0 +1,126 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultReloadInterval is how often a Reloader checks its files.
+const DefaultReloadInterval = 10 * time.Second
+
+// Reloader serves a key pair read from disk, and reloads it when the files change.
+// Plug it in a tls.Config with GetCertificate on a server and GetClientCertificate on
+// a client: the certificate is only used by the handshakes, so a rotated certificate
+// applies to the new connections while the established ones keep going.
+//
+// A pair failing to load, e.g. the new key written before the new certificate, is logged
+// and the previous one is kept until the next check.
+type Reloader struct {
+	certFile, keyFile string
+
+	mu              sync.RWMutex
+	cert            *tls.Certificate
+	certPEM, keyPEM []byte // content of the files cert was loaded from
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewReloader loads the key pair and checks its files every interval,
+// DefaultReloadInterval if 0. Call Close to stop checking.
+func NewReloader(certFile, keyFile string, interval time.Duration) (*Reloader, error) {
+	if interval == 0 {
+		interval = DefaultReloadInterval
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile, done: make(chan struct{})}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	r.wg.Add(1)
+	go r.run(interval)
+	return r, nil
+}
+
+func (r *Reloader) run(interval time.Duration) {
+	defer r.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			reloaded, err := r.reload()
+			if err != nil {
+				log.Printf("[pki] keeping the current certificate, failed to reload %s: %v", r.certFile, err)
+			} else if reloaded {
+				log.Printf("[pki] reloaded %s : %s", r.certFile, describe(r.Certificate()))
+			}
+		}
+	}
+}
+
+// reload loads the key pair if the files changed since the last load,
+// and tells whether it did. The files are compared rather than their modification
+// times, which may not change when they are rewritten within the same tick.
+func (r *Reloader) reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, err
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, err
+	}
+	if cert.Leaf, err = x509.ParseCertificate(cert.Certificate[0]); err != nil {
+		return false, err
+	}
+	r.mu.Lock()
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Certificate returns the current key pair, with its Leaf parsed.
+func (r *Reloader) Certificate() *tls.Certificate {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// GetClientCertificate implements tls.Config.GetClientCertificate.
+func (r *Reloader) GetClientCertificate(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+	return r.Certificate(), nil
+}
+
+// Close stops checking the files.
+func (r *Reloader) Close() {
+	close(r.done)
+	r.wg.Wait()
+}
+
+func describe(cert *tls.Certificate) string {
+	return fmt.Sprintf("serial %x, CN %q, valid until %s", cert.Leaf.SerialNumber, cert.Leaf.Subject.CommonName, cert.Leaf.NotAfter.Format(time.RFC3339))
+}
@@ -0,0 +1,282 @@
+package pki
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCRLValidity is how long a CRL is valid, sign a new one before it expires.
+const DefaultCRLValidity = 30 * 24 * time.Hour
+
+// CreateCRL signs a certificate revocation list revoking the serials of revoked,
+// PEM encoded. Every CRL revokes all the certificates revoked so far: pass the entries
+// of the current CRL (see ParseCRL) along with the new ones.
+func (ca *CA) CreateCRL(revoked []pkix.RevokedCertificate, validity time.Duration) ([]byte, error) {
+	if validity == 0 {
+		validity = DefaultCRLValidity
+	}
+	issuer := ca.Cert
+	if issuer.KeyUsage == 0 {
+		// A CA without the key usage extension, such as the one of gen_cert.sh, may
+		// sign CRLs (RFC 5280 4.2.1.3), but x509.CreateRevocationList wants the bit.
+		withUsage := *issuer
+		withUsage.KeyUsage = x509.KeyUsageCRLSign
+		issuer = &withUsage
+	}
+	now := time.Now()
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		// the CRL number only goes up
+		Number:              big.NewInt(now.UnixNano()),
+		ThisUpdate:          now.Add(-clockSkew),
+		NextUpdate:          now.Add(validity),
+		RevokedCertificates: revoked,
+	}, issuer, ca.Key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign the CRL: %v", err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der}), nil
+}
+
+// ParseCRL parses a PEM encoded CRL and checks that it is signed by ca.
+func ParseCRL(crlPEM []byte, ca *x509.Certificate) (*x509.RevocationList, error) {
+	block, _ := pem.Decode(crlPEM)
+	if block == nil || block.Type != "X509 CRL" {
+		return nil, errors.New("no X509 CRL PEM block")
+	}
+	crl, err := x509.ParseRevocationList(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	if err := crl.CheckSignatureFrom(ca); err != nil {
+		return nil, fmt.Errorf("the CRL is not signed by the CA: %v", err)
+	}
+	return crl, nil
+}
+
+// StatusFunc asks a responder whether a certificate is revoked, a stand-in for OCSP.
+type StatusFunc func(cert *x509.Certificate) (revoked bool, err error)
+
+// RevocationChecker rejects the certificates revoked by the CA at handshake time. Plug
+// VerifyConnection in the tls.Config of the server to check the client certificates.
+//
+// The CRL is read from a file reloaded every interval, a CRL which fails to load (bad
+// signature, partial file) is logged and the current one is kept. A CRL past its next
+// update is still enforced, with a warning logged once: renew it with cmd/certgen.
+//
+// Status, when set, is also asked about the certificates the CRL doesn't revoke, so that
+// a revocation applies before the next CRL reload. Its errors are logged and the CRL
+// decision stands, a responder down doesn't lock every client out.
+type RevocationChecker struct {
+	crlFile string
+	ca      *x509.Certificate
+	status  StatusFunc
+
+	mu      sync.RWMutex
+	crlPEM  []byte
+	crl     *x509.RevocationList
+	revoked map[string]time.Time // revocation time per serial
+
+	// the current CRL was logged past its next update, owned by run
+	staleLogged bool
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// NewRevocationChecker loads the CRL signed by ca and reloads it every interval,
+// DefaultReloadInterval if 0. status may be nil. Call Close to stop reloading.
+func NewRevocationChecker(crlFile string, ca *x509.Certificate, interval time.Duration, status StatusFunc) (*RevocationChecker, error) {
+	if interval == 0 {
+		interval = DefaultReloadInterval
+	}
+	c := &RevocationChecker{crlFile: crlFile, ca: ca, status: status, done: make(chan struct{})}
+	if _, err := c.reload(); err != nil {
+		return nil, fmt.Errorf("failed to load the CRL %s: %v", crlFile, err)
+	}
+	c.logStale()
+	c.wg.Add(1)
+	go c.run(interval)
+	return c, nil
+}
+
+func (c *RevocationChecker) run(interval time.Duration) {
+	defer c.wg.Done()
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+			reloaded, err := c.reload()
+			if err != nil {
+				log.Printf("[pki] keeping the current CRL, failed to reload %s: %v", c.crlFile, err)
+			} else if reloaded {
+				c.mu.RLock()
+				log.Printf("[pki] reloaded %s : CRL number %v, %d revoked certificates, next update %s",
+					c.crlFile, c.crl.Number, len(c.revoked), c.crl.NextUpdate.Format(time.RFC3339))
+				c.mu.RUnlock()
+			}
+			c.logStale()
+		}
+	}
+}
+
+// logStale warns once that the CRL is past its next update, again only after a reload
+// brought a CRL which was not. It reports whether it logged.
+func (c *RevocationChecker) logStale() bool {
+	c.mu.RLock()
+	stale := time.Now().After(c.crl.NextUpdate)
+	c.mu.RUnlock()
+	logged := stale && !c.staleLogged
+	if logged {
+		log.Printf("[pki] the CRL %s is past its next update, renew it", c.crlFile)
+	}
+	c.staleLogged = stale
+	return logged
+}
+
+func (c *RevocationChecker) reload() (bool, error) {
+	crlPEM, err := os.ReadFile(c.crlFile)
+	if err != nil {
+		return false, err
+	}
+	c.mu.RLock()
+	unchanged := c.crl != nil && bytes.Equal(crlPEM, c.crlPEM)
+	c.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	crl, err := ParseCRL(crlPEM, c.ca)
+	if err != nil {
+		return false, err
+	}
+	var current *big.Int
+	c.mu.RLock()
+	if c.crl != nil {
+		current = c.crl.Number
+	}
+	c.mu.RUnlock()
+	if current != nil && crl.Number != nil && crl.Number.Cmp(current) < 0 {
+		return false, fmt.Errorf("CRL number %v is older than the current %v", crl.Number, current)
+	}
+	revoked := make(map[string]time.Time, len(crl.RevokedCertificates))
+	for _, r := range crl.RevokedCertificates {
+		revoked[r.SerialNumber.String()] = r.RevocationTime
+	}
+	c.mu.Lock()
+	c.crlPEM, c.crl, c.revoked = crlPEM, crl, revoked
+	c.mu.Unlock()
+	return true, nil
+}
+
+// VerifyConnection implements tls.Config.VerifyConnection, it runs once the chain of
+// the peer is verified.
+func (c *RevocationChecker) VerifyConnection(cs tls.ConnectionState) error {
+	if len(cs.VerifiedChains) == 0 || len(cs.VerifiedChains[0]) == 0 {
+		// no certificate, tls.Config.ClientAuth decides whether it's fine
+		return nil
+	}
+	return c.Check(cs.VerifiedChains[0][0])
+}
+
+// Check returns an error if cert is revoked.
+func (c *RevocationChecker) Check(cert *x509.Certificate) error {
+	c.mu.RLock()
+	revokedAt, revoked := c.revoked[cert.SerialNumber.String()]
+	c.mu.RUnlock()
+	if revoked {
+		log.Printf("[pki] rejected certificate serial %x (CN %q): revoked at %s by the CRL",
+			cert.SerialNumber, cert.Subject.CommonName, revokedAt.Format(time.RFC3339))
+		return fmt.Errorf("certificate serial %x is revoked", cert.SerialNumber)
+	}
+	if c.status == nil {
+		return nil
+	}
+	revoked, err := c.status(cert)
+	if err != nil {
+		log.Printf("[pki] no status for certificate serial %x, relying on the CRL: %v", cert.SerialNumber, err)
+		return nil
+	}
+	if revoked {
+		log.Printf("[pki] rejected certificate serial %x (CN %q): revoked according to the status responder",
+			cert.SerialNumber, cert.Subject.CommonName)
+		return fmt.Errorf("certificate serial %x is revoked", cert.SerialNumber)
+	}
+	return nil
+}
+
+// Close stops reloading the CRL.
+func (c *RevocationChecker) Close() {
+	close(c.done)
+	c.wg.Wait()
+}
+
+// StatusHandler is a local stand-in for an OCSP responder: GET /<hex serial> answers
+// "good" or "revoked" from the CRL file, read at every request so that a revocation
+// applies as soon as the CA writes the CRL.
+func StatusHandler(crlFile string, ca *x509.Certificate) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		serial, ok := new(big.Int).SetString(strings.TrimPrefix(r.URL.Path, "/"), 16)
+		if !ok {
+			http.Error(w, "invalid serial number", http.StatusBadRequest)
+			return
+		}
+		crlPEM, err := os.ReadFile(crlFile)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		crl, err := ParseCRL(crlPEM, ca)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		for _, revoked := range crl.RevokedCertificates {
+			if revoked.SerialNumber.Cmp(serial) == 0 {
+				fmt.Fprint(w, "revoked")
+				return
+			}
+		}
+		fmt.Fprint(w, "good")
+	})
+}
+
+// HTTPStatus returns a StatusFunc asking the StatusHandler served at url.
+func HTTPStatus(url string) StatusFunc {
+	client := &http.Client{Timeout: 2 * time.Second}
+	return func(cert *x509.Certificate) (bool, error) {
+		resp, err := client.Get(fmt.Sprintf("%s/%x", strings.TrimSuffix(url, "/"), cert.SerialNumber))
+		if err != nil {
+			return false, err
+		}
+		defer resp.Body.Close()
+		var body bytes.Buffer
+		if _, err := body.ReadFrom(resp.Body); err != nil {
+			return false, err
+		}
+		switch status := strings.TrimSpace(body.String()); {
+		case resp.StatusCode != http.StatusOK:
+			return false, fmt.Errorf("status responder: %s: %s", resp.Status, status)
+		case status == "revoked":
+			return true, nil
+		case status == "good":
+			return false, nil
+		default:
+			return false, fmt.Errorf("status responder: unexpected answer %q", status)
+		}
+	}
+}
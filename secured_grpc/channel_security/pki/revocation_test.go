@@ -0,0 +1,245 @@
+package pki
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func issueCert(t *testing.T, ca *CA, opts LeafOptions) (tls.Certificate, *x509.Certificate) {
+	certPEM, keyPEM, err := ca.Issue(opts)
+	if err != nil {
+		t.Fatalf("Issue failed: %v", err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatalf("X509KeyPair failed: %v", err)
+	}
+	return pair, parse(t, certPEM, keyPEM)
+}
+
+func writeCRL(t *testing.T, ca *CA, file string, revoked ...*x509.Certificate) {
+	var entries []pkix.RevokedCertificate
+	for _, cert := range revoked {
+		entries = append(entries, pkix.RevokedCertificate{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()})
+	}
+	crlPEM, err := ca.CreateCRL(entries, time.Hour)
+	if err != nil {
+		t.Fatalf("CreateCRL failed: %v", err)
+	}
+	if err := WriteFile(file, crlPEM, 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+}
+
+func TestParseCRL(t *testing.T) {
+	ca, other := newTestCA(t), newTestCA(t)
+	_, cert := issueCert(t, ca, LeafOptions{CommonName: "client", Client: true})
+	crlPEM, err := ca.CreateCRL([]pkix.RevokedCertificate{{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()}}, 0)
+	if err != nil {
+		t.Fatalf("CreateCRL failed: %v", err)
+	}
+	crl, err := ParseCRL(crlPEM, ca.Cert)
+	if err != nil {
+		t.Fatalf("ParseCRL failed: %v", err)
+	}
+	if len(crl.RevokedCertificates) != 1 || crl.RevokedCertificates[0].SerialNumber.Cmp(cert.SerialNumber) != 0 {
+		t.Errorf("revoked certificates = %v, want serial %x", crl.RevokedCertificates, cert.SerialNumber)
+	}
+	if _, err := ParseCRL(crlPEM, other.Cert); err == nil {
+		t.Errorf("ParseCRL with another CA succeeded, want error")
+	}
+	if _, err := ParseCRL(ca.CertPEM(), ca.Cert); err == nil {
+		t.Errorf("ParseCRL of a certificate succeeded, want error")
+	}
+}
+
+// A client certificate revoked by a reloaded CRL fails the handshake, the others still connect.
+func TestRevocationChecker(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	serverPair, _ := issueCert(t, ca, LeafOptions{CommonName: "server", DNSNames: []string{"localhost"}, Server: true})
+	revokedPair, revokedCert := issueCert(t, ca, LeafOptions{CommonName: "revoked", Client: true})
+	goodPair, _ := issueCert(t, ca, LeafOptions{CommonName: "good", Client: true})
+
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, ca, crlFile)
+	checker, err := NewRevocationChecker(crlFile, ca.Cert, 10*time.Millisecond, nil)
+	if err != nil {
+		t.Fatalf("NewRevocationChecker failed: %v", err)
+	}
+	defer checker.Close()
+
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates:     []tls.Certificate{serverPair},
+		ClientAuth:       tls.RequireAndVerifyClientCert,
+		ClientCAs:        pool(ca),
+		VerifyConnection: checker.VerifyConnection,
+	})
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer lis.Close()
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.(*tls.Conn).Handshake()
+				conn.Write([]byte("ok"))
+			}()
+		}
+	}()
+
+	dial := func(client tls.Certificate) error {
+		conn, err := tls.Dial("tcp", lis.Addr().String(), &tls.Config{
+			ServerName:   "localhost",
+			RootCAs:      pool(ca),
+			Certificates: []tls.Certificate{client},
+		})
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+		// with TLS 1.3 the client learns that the server rejected its certificate at the first read
+		_, err = conn.Read(make([]byte, 2))
+		return err
+	}
+
+	if err := dial(revokedPair); err != nil {
+		t.Fatalf("dial before the revocation failed: %v", err)
+	}
+
+	writeCRL(t, ca, crlFile, revokedCert)
+	deadline := time.Now().Add(5 * time.Second)
+	for checker.Check(revokedCert) == nil {
+		if time.Now().After(deadline) {
+			t.Fatalf("the new CRL was not reloaded")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := dial(revokedPair); err == nil {
+		t.Errorf("dial with the revoked certificate succeeded, want a handshake failure")
+	}
+	if err := dial(goodPair); err != nil {
+		t.Errorf("dial with a valid certificate failed: %v", err)
+	}
+}
+
+// A CRL which fails to load is not applied: the checker keeps the current one.
+func TestRevocationChecker_KeepsCurrentOnError(t *testing.T) {
+	dir := t.TempDir()
+	ca, other := newTestCA(t), newTestCA(t)
+	_, cert := issueCert(t, ca, LeafOptions{CommonName: "client", Client: true})
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, ca, crlFile, cert)
+	checker, err := NewRevocationChecker(crlFile, ca.Cert, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewRevocationChecker failed: %v", err)
+	}
+	defer checker.Close()
+
+	// signed by another CA
+	writeCRL(t, other, crlFile)
+	if _, err := checker.reload(); err == nil {
+		t.Errorf("reload of a CRL of another CA succeeded, want error")
+	}
+	if checker.Check(cert) == nil {
+		t.Errorf("certificate accepted after a failed reload")
+	}
+
+	if _, err := NewRevocationChecker(filepath.Join(dir, "missing.pem"), ca.Cert, time.Hour, nil); err == nil {
+		t.Errorf("NewRevocationChecker without a CRL succeeded, want error")
+	}
+}
+
+// A CRL past its next update is logged once, not at every handshake, and again once
+// a fresh CRL went stale in turn.
+func TestRevocationChecker_LogsStaleOnce(t *testing.T) {
+	ca := newTestCA(t)
+	_, cert := issueCert(t, ca, LeafOptions{CommonName: "client", Client: true})
+	crlFile := filepath.Join(t.TempDir(), "crl.pem")
+	writeStale := func() {
+		crlPEM, err := ca.CreateCRL([]pkix.RevokedCertificate{{SerialNumber: cert.SerialNumber, RevocationTime: time.Now()}}, time.Nanosecond)
+		if err != nil {
+			t.Fatalf("CreateCRL failed: %v", err)
+		}
+		if err := WriteFile(crlFile, crlPEM, 0o644); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+	}
+	writeStale()
+	checker, err := NewRevocationChecker(crlFile, ca.Cert, time.Hour, nil)
+	if err != nil {
+		t.Fatalf("NewRevocationChecker failed: %v", err)
+	}
+	defer checker.Close()
+
+	// logged when loaded
+	if checker.logStale() {
+		t.Errorf("the stale CRL was logged again")
+	}
+	if checker.Check(cert) == nil {
+		t.Errorf("certificate accepted by a stale CRL, want it still enforced")
+	}
+
+	writeCRL(t, ca, crlFile)
+	if _, err := checker.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if checker.logStale() {
+		t.Errorf("a fresh CRL was logged as stale")
+	}
+	writeStale()
+	if _, err := checker.reload(); err != nil {
+		t.Fatalf("reload failed: %v", err)
+	}
+	if !checker.logStale() {
+		t.Errorf("the CRL gone stale after a fresh one was not logged")
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCA(t)
+	_, revoked := issueCert(t, ca, LeafOptions{CommonName: "revoked", Client: true})
+	_, good := issueCert(t, ca, LeafOptions{CommonName: "good", Client: true})
+	crlFile := filepath.Join(dir, "crl.pem")
+	writeCRL(t, ca, crlFile, revoked)
+
+	srv := httptest.NewServer(StatusHandler(crlFile, ca.Cert))
+	defer srv.Close()
+	status := HTTPStatus(srv.URL)
+	if got, err := status(revoked); err != nil || !got {
+		t.Errorf("status(revoked) = %v, %v, want true", got, err)
+	}
+	if got, err := status(good); err != nil || got {
+		t.Errorf("status(good) = %v, %v, want false", got, err)
+	}
+
+	// the status responder revokes certificates the CRL of the checker doesn't know yet,
+	// and its errors don't reject anything
+	emptyCRL := filepath.Join(dir, "empty.pem")
+	writeCRL(t, ca, emptyCRL)
+	checker, err := NewRevocationChecker(emptyCRL, ca.Cert, time.Hour, status)
+	if err != nil {
+		t.Fatalf("NewRevocationChecker failed: %v", err)
+	}
+	defer checker.Close()
+	if checker.Check(revoked) == nil {
+		t.Errorf("certificate revoked by the status responder accepted")
+	}
+	checker.status = func(*x509.Certificate) (bool, error) { return false, errors.New("responder down") }
+	if err := checker.Check(revoked); err != nil {
+		t.Errorf("Check with the responder down = %v, want nil", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"rpcerrors"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// identity is who the client is, read from the certificate it authenticated with.
+type identity struct {
+	// name is matched against the allowlist: the SPIFFE ID of the certificate
+	// (spiffe://trust-domain/path) if it has one, else "cn:<subject common name>",
+	// else "dns:<first DNS SAN>".
+	name        string
+	certificate *x509.Certificate
+}
+
+type identityKey struct{}
+
+// identityFromContext returns the identity of the client, set by the authorization interceptors.
+func identityFromContext(ctx context.Context) (identity, bool) {
+	id, ok := ctx.Value(identityKey{}).(identity)
+	return id, ok
+}
+
+// peerIdentity reads the identity of the client from the certificate verified by the TLS handshake.
+func peerIdentity(ctx context.Context) (identity, error) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return identity{}, status.Error(codes.Unauthenticated, "no peer")
+	}
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok {
+		return identity{}, status.Error(codes.Unauthenticated, "not a TLS connection")
+	}
+	// VerifiedChains is only set for a certificate verified against ClientCAs,
+	// the first certificate of a chain is the one of the client.
+	chains := tlsInfo.State.VerifiedChains
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return identity{}, status.Error(codes.Unauthenticated, "no verified client certificate")
+	}
+	cert := chains[0][0]
+	name := identityName(cert)
+	if name == "" {
+		return identity{}, status.Error(codes.Unauthenticated, "the client certificate has no SPIFFE ID, common name or DNS name")
+	}
+	return identity{name: name, certificate: cert}, nil
+}
+
+func identityName(cert *x509.Certificate) string {
+	for _, u := range cert.URIs {
+		if u.Scheme == "spiffe" {
+			return u.String()
+		}
+	}
+	if cert.Subject.CommonName != "" {
+		return "cn:" + cert.Subject.CommonName
+	}
+	if len(cert.DNSNames) > 0 {
+		return "dns:" + cert.DNSNames[0]
+	}
+	return ""
+}
+
+// allowlist maps a full method name to the identities allowed to call it, "*" allows
+// every client with a verified certificate. A method missing from the allowlist is denied.
+//
+//	{"/ecommerce.ProductInfo/addProduct": ["spiffe://ecommerce.example/product-admin", "cn:product-client"]}
+type allowlist map[string][]string
+
+func loadAllowlist(file string) (allowlist, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var a allowlist
+	if err := json.Unmarshal(data, &a); err != nil {
+		return nil, fmt.Errorf("invalid allowlist %s: %v", file, err)
+	}
+	return a, nil
+}
+
+func (a allowlist) allows(method, name string) bool {
+	for _, allowed := range a[method] {
+		if allowed == "*" || allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize returns the context of a call with the identity of the client, or the
+// error rejecting the call.
+func (a allowlist) authorize(ctx context.Context, method string) (context.Context, error) {
+	id, err := peerIdentity(ctx)
+	if err != nil {
+		log.Printf("[authz] %s rejected: %v", method, err)
+		return nil, err
+	}
+	if !a.allows(method, id.name) {
+		log.Printf("[authz] %s denied to %s", method, id.name)
+		// the ErrorInfo tells the client which identity the allowlist refused
+		return nil, rpcerrors.Error(codes.PermissionDenied, "IDENTITY_NOT_ALLOWED", rpcerrors.Domain,
+			fmt.Sprintf("%s is not allowed to call %s", id.name, method), map[string]string{"identity": id.name, "method": method})
+	}
+	return context.WithValue(ctx, identityKey{}, id), nil
+}
+
+// authzUnaryInterceptor only lets the clients of the allowlist call a method, and passes
+// their identity to the handler (see identityFromContext).
+func authzUnaryInterceptor(a allowlist) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.authorize(ctx, info.FullMethod)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// authzStreamInterceptor is authzUnaryInterceptor for the streaming methods.
+func authzStreamInterceptor(a allowlist) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.authorize(ss.Context(), info.FullMethod)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &identityStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// identityStream is a grpc.ServerStream whose context holds the identity of the client.
+type identityStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *identityStream) Context() context.Context { return s.ctx }
+
+// authorizePage only serves the page h to the clients with a verified certificate whose
+// identity is allowed to call every method of service, the page shows what they return.
+func (a allowlist) authorizePage(service *grpc.ServiceDesc, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		if r.TLS != nil && len(r.TLS.VerifiedChains) > 0 && len(r.TLS.VerifiedChains[0]) > 0 {
+			name = identityName(r.TLS.VerifiedChains[0][0])
+		}
+		if name == "" {
+			log.Printf("[authz] %s rejected: no verified client certificate with an identity", r.URL.Path)
+			http.Error(w, "no verified client certificate with an identity", http.StatusUnauthorized)
+			return
+		}
+		for _, m := range service.Methods {
+			if method := "/" + service.ServiceName + "/" + m.MethodName; !a.allows(method, name) {
+				log.Printf("[authz] %s denied to %s", r.URL.Path, name)
+				http.Error(w, fmt.Sprintf("%s is not allowed to call %s", name, method), http.StatusForbidden)
+				return
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"rpcerrors"
+	"testing"
+
+	"google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	addProduct = "/ecommerce.ProductInfo/addProduct"
+	getProduct = "/ecommerce.ProductInfo/getProduct"
+)
+
+// peerContext returns the context of a call from a client which authenticated with cert,
+// or without a certificate if cert is nil.
+func peerContext(cert *x509.Certificate) context.Context {
+	state := tls.ConnectionState{}
+	if cert != nil {
+		state.VerifiedChains = [][]*x509.Certificate{{cert}}
+	}
+	return peer.NewContext(context.Background(), &peer.Peer{AuthInfo: credentials.TLSInfo{State: state}})
+}
+
+func TestIdentityName(t *testing.T) {
+	spiffe, _ := url.Parse("spiffe://ecommerce.example/product-client")
+	for _, tt := range []struct {
+		cert *x509.Certificate
+		want string
+	}{
+		{&x509.Certificate{URIs: []*url.URL{spiffe}, Subject: pkix.Name{CommonName: "product-client"}}, "spiffe://ecommerce.example/product-client"},
+		{&x509.Certificate{Subject: pkix.Name{CommonName: "product-client"}, DNSNames: []string{"localhost"}}, "cn:product-client"},
+		{&x509.Certificate{DNSNames: []string{"localhost"}}, "dns:localhost"},
+		{&x509.Certificate{}, ""},
+	} {
+		if got := identityName(tt.cert); got != tt.want {
+			t.Errorf("identityName(%v) = %q, want %q", tt.cert.Subject, got, tt.want)
+		}
+	}
+}
+
+func TestAuthzUnaryInterceptor(t *testing.T) {
+	a := allowlist{
+		addProduct: {"cn:product-admin"},
+		getProduct: {"*"},
+	}
+	admin := &x509.Certificate{Subject: pkix.Name{CommonName: "product-admin"}}
+	reader := &x509.Certificate{Subject: pkix.Name{CommonName: "product-reader"}}
+
+	for _, tt := range []struct {
+		name   string
+		ctx    context.Context
+		method string
+		want   codes.Code
+	}{
+		{"allowed identity", peerContext(admin), addProduct, codes.OK},
+		{"wildcard", peerContext(reader), getProduct, codes.OK},
+		{"other identity", peerContext(reader), addProduct, codes.PermissionDenied},
+		{"method not listed", peerContext(admin), "/ecommerce.ProductInfo/deleteProduct", codes.PermissionDenied},
+		{"no client certificate", peerContext(nil), getProduct, codes.Unauthenticated},
+		{"no peer", context.Background(), getProduct, codes.Unauthenticated},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var handled identity
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				handled, _ = identityFromContext(ctx)
+				return nil, nil
+			}
+			_, err := authzUnaryInterceptor(a)(tt.ctx, nil, &grpc.UnaryServerInfo{FullMethod: tt.method}, handler)
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("code = %v, want %v (%v)", got, tt.want, err)
+			}
+			if tt.want == codes.OK && handled.name == "" {
+				t.Errorf("the handler got no identity")
+			}
+			if tt.want == codes.PermissionDenied && rpcerrors.Decode(err).Reason() != "IDENTITY_NOT_ALLOWED" {
+				t.Errorf("PermissionDenied without the reason IDENTITY_NOT_ALLOWED: %s", rpcerrors.Decode(err))
+			}
+		})
+	}
+}
+
+func TestLoadAllowlist(t *testing.T) {
+	a, err := loadAllowlist(authzFile)
+	if err != nil {
+		t.Fatalf("loadAllowlist failed: %v", err)
+	}
+	// the client certificate of gen_cert.sh only has the DNS name localhost
+	if !a.allows(addProduct, "dns:localhost") || !a.allows(getProduct, "cn:anyone") {
+		t.Errorf("%s doesn't allow the example client", authzFile)
+	}
+	// the channelz service is listed method by method, for the admin only
+	for _, m := range channelzgrpc.Channelz_ServiceDesc.Methods {
+		method := "/" + channelzgrpc.Channelz_ServiceDesc.ServiceName + "/" + m.MethodName
+		if !a.allows(method, "cn:product-admin") || a.allows(method, "dns:localhost") {
+			t.Errorf("%s doesn't allow %s to the admin only", authzFile, method)
+		}
+	}
+}
+
+func TestAuthorizePage(t *testing.T) {
+	a := allowlist{
+		"/test.Admin/Get":  {"cn:product-admin"},
+		"/test.Admin/List": {"cn:product-admin", "cn:product-reader"},
+	}
+	service := &grpc.ServiceDesc{ServiceName: "test.Admin", Methods: []grpc.MethodDesc{{MethodName: "Get"}, {MethodName: "List"}}}
+	page := a.authorizePage(service, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("page"))
+	}))
+	admin := &x509.Certificate{Subject: pkix.Name{CommonName: "product-admin"}}
+	reader := &x509.Certificate{Subject: pkix.Name{CommonName: "product-reader"}}
+
+	for _, tt := range []struct {
+		name string
+		tls  *tls.ConnectionState
+		want int
+	}{
+		{"allowed identity", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{admin}}}, http.StatusOK},
+		// allowed to call some of the methods only
+		{"other identity", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{reader}}}, http.StatusForbidden},
+		{"no identity", &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{{}}}}, http.StatusUnauthorized},
+		{"no client certificate", &tls.ConnectionState{}, http.StatusUnauthorized},
+		{"plain HTTP", nil, http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/channelz", nil)
+			r.TLS = tt.tls
+			w := httptest.NewRecorder()
+			page.ServeHTTP(w, r)
+			if w.Code != tt.want {
+				t.Errorf("GET /channelz = %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
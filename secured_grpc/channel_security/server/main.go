@@ -1,16 +1,20 @@
 package main
 
 import (
+	"admin"
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"errors"
+	"flag"
 	"github.com/google/uuid"
 	"google.golang.org/grpc"
+	channelzgrpc "google.golang.org/grpc/channelz/grpc_channelz_v1"
 	"google.golang.org/grpc/credentials"
 	"io/ioutil"
 	"log"
 	"net"
+	"pki"
+	"rpcerrors"
 	pb "server/ecommerce"
 )
 
@@ -19,6 +23,15 @@ var (
 	crtFile = "cert/server.crt"
 	keyFile = "cert/server.key"
 	caFile  = "cert/ca.crt"
+	// authzFile lists the client identities allowed to call each method.
+	authzFile = "authz.json"
+	// crlFile revokes client certificates, written by pki/cmd/certgen.
+	crlFile = "cert/crl.pem"
+	// statusURL is the revocation status responder (pki/cmd/certgen -serve-status),
+	// e.g. "http://localhost:8090", none if empty.
+	statusURL = ""
+
+	adminAddr = flag.String("admin", "", "register the channelz service and serve the channelz page on this address, e.g. :8081 on the loopback interface, none if empty; another host is served over mTLS")
 )
 
 type server struct {
@@ -37,6 +50,10 @@ func (s *server) AddProduct(ctx context.Context, in *pb.Product) (*pb.ProductID,
 		s.productMap = make(map[string]*pb.Product)
 	}
 	s.productMap[in.Id] = in
+	// The authorization interceptor passes the identity of the client, for the audit.
+	if id, ok := identityFromContext(ctx); ok {
+		log.Printf("Product %s added by %s (certificate serial %x)", in.Id, id.name, id.certificate.SerialNumber)
+	}
 	return &pb.ProductID{Value: in.Id}, nil
 }
 
@@ -46,16 +63,24 @@ func (s *server) GetProduct(ctx context.Context, in *pb.ProductID) (*pb.Product,
 	if exists {
 		return value, nil
 	}
-	return nil, errors.New("Product does not exist for the ID" + in.Value)
+	return nil, rpcerrors.NotFound("Product", in.Value)
 }
 
 func main() {
-	// Read and parse a public/private key pair and create
-	// a certificate to enable TLS.
-	certificate, err := tls.LoadX509KeyPair(crtFile, keyFile)
+	flag.Parse()
+	// Read and parse a public/private key pair to enable TLS, and reload it when
+	// the files are rotated (e.g. by pki/cmd/certgen) without restarting the server.
+	certificate, err := pki.NewReloader(crtFile, keyFile, pki.DefaultReloadInterval)
 	if err != nil {
 		log.Fatalf("Failed to load key pair: %s", err)
 	}
+	defer certificate.Close()
+
+	// Load the client identities allowed to call each method.
+	authz, err := loadAllowlist(authzFile)
+	if err != nil {
+		log.Fatalf("failed to load the allowlist: %v", err)
+	}
 
 	// Create a certificate pool from the CA.
 	certPool := x509.NewCertPool()
@@ -69,16 +94,40 @@ func main() {
 		log.Fatalf("failed to append ca certificate")
 	}
 
+	// Reject the revoked client certificates at handshake time, the CRL is reloaded
+	// when the CA revokes more certificates.
+	caCert, err := pki.ParseCertificate(ca)
+	if err != nil {
+		log.Fatalf("failed to parse ca certificate: %s", err)
+	}
+	var status pki.StatusFunc
+	if statusURL != "" {
+		status = pki.HTTPStatus(statusURL)
+	}
+	revocation, err := pki.NewRevocationChecker(crlFile, caCert, pki.DefaultReloadInterval, status)
+	if err != nil {
+		log.Fatalf("failed to load the CRL: %s", err)
+	}
+	defer revocation.Close()
+
+	tlsConfig := &tls.Config{
+		ClientAuth: tls.RequireAndVerifyClientCert,
+		// The certificate is picked at each handshake, the connections
+		// established with a rotated one keep going.
+		GetCertificate: certificate.GetCertificate,
+		ClientCAs:      certPool,
+		// Runs once the client certificate is verified against ClientCAs.
+		VerifyConnection: revocation.VerifyConnection,
+	}
 	// Enable TLS for all incoming connections by creating TLS credentials.
 	opts := []grpc.ServerOption{
 		// Enable TLS for all incoming connections.
-		grpc.Creds(
-			credentials.NewTLS(&tls.Config{
-				ClientAuth:   tls.RequireAndVerifyClientCert,
-				Certificates: []tls.Certificate{certificate},
-				ClientCAs:    certPool,
-			},
-			)),
+		grpc.Creds(credentials.NewTLS(tlsConfig)),
+		// Only let the allowed client identities call each method.
+		// The allowed calls get the messages of their errors in the languages of
+		// the accept-language metadata.
+		grpc.ChainUnaryInterceptor(authzUnaryInterceptor(authz), rpcerrors.UnaryServerInterceptor(rpcerrors.DefaultLocalizer)),
+		grpc.StreamInterceptor(authzStreamInterceptor(authz)),
 	}
 	// Create a new gRPC server instance by passing TLS server credentials.
 	s := grpc.NewServer(opts...)
@@ -86,6 +135,11 @@ func main() {
 	// Register the implemented service to the newly created
 	// gRPC server by calling generated APIs.
 	pb.RegisterProductInfoServer(s, &server{})
+	if *adminAddr != "" {
+		// The channelz calls go through the allowlist like the others.
+		admin.Register(s)
+		go func() { log.Fatal(serveAdmin(*adminAddr, tlsConfig, authz)) }()
+	}
 
 	lis, err := net.Listen("tcp", port)
 	if err != nil {
@@ -98,3 +152,26 @@ func main() {
 		log.Fatalf("failed to serve: %v", err)
 	}
 }
+
+// serveAdmin serves the channelz page on addr, on the loopback interface if addr has no
+// host. The page shows the peers and the calls of the server: on another host it is
+// served over mTLS with tlsConfig, to the identities allowed to call the channelz service.
+func serveAdmin(addr string, tlsConfig *tls.Config, authz allowlist) error {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if host == "" {
+		host = "127.0.0.1"
+		addr = net.JoinHostPort(host, port)
+	}
+	s := admin.NewServer(addr)
+	if ip := net.ParseIP(host); host == "localhost" || ip != nil && ip.IsLoopback() {
+		log.Printf("serving the channelz page on http://%s%s", addr, admin.Path)
+		return s.ListenAndServe()
+	}
+	s.TLSConfig = tlsConfig
+	s.Handler = authz.authorizePage(&channelzgrpc.Channelz_ServiceDesc, s.Handler)
+	log.Printf("serving the channelz page on https://%s%s", addr, admin.Path)
+	return s.ListenAndServeTLS("", "")
+}